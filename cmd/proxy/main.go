@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
@@ -10,6 +11,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/andress1014/meli-proxy/internal/admin"
 	"github.com/andress1014/meli-proxy/internal/config"
 	"github.com/andress1014/meli-proxy/internal/logger"
 	"github.com/andress1014/meli-proxy/internal/metrics"
@@ -27,7 +29,11 @@ func main() {
 	}
 
 	// Configuración
-	cfg := config.Load()
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Logger
 	log := logger.New(cfg.LogLevel)
@@ -37,27 +43,157 @@ func main() {
 		zap.Int("gomaxprocs", runtime.GOMAXPROCS(0)),
 		zap.String("version", "1.0.0-optimized"))
 
+	// IP del cliente: los headers de forwarding solo se aceptan de proxies de confianza
+	proxyHeader, _ := ratelimit.ParseProxyHeader(cfg.TrustedProxyHeader)
+	ratelimit.SetTrustedProxies(cfg.TrustedProxies, proxyHeader)
+	if len(cfg.TrustedProxies) == 0 {
+		log.Info("no trusted proxies configured, client IP is taken from the connection")
+	}
+
+	// Normalización de paths para keys y labels de métricas
+	if err := ratelimit.SetPathTemplates(cfg.PathTemplates); err != nil {
+		log.Error("invalid path templates", zap.Error(err))
+		os.Exit(1)
+	}
+	ratelimit.SetIDDetection(cfg.PathIDDetection)
+
+	// Identidad del cliente para los límites: credencial o IP
+	identity, err := ratelimit.NewIdentityResolver(cfg.IdentitySource, cfg.IdentityClients, cfg.IdentityDefaultTier)
+	if err != nil {
+		log.Error("invalid identity source", zap.Error(err))
+		os.Exit(1)
+	}
+	identity.SetTrustUpstreamJWT(cfg.IdentityTrustUpstreamJWT && !cfg.JWTEnabled)
+	ratelimit.SetIdentityResolver(identity)
+	if identity.Source() != ratelimit.IdentitySourceIP {
+		log.Info("rate limit identity from credentials",
+			zap.String("source", cfg.IdentitySource),
+			zap.Int("clients", len(cfg.IdentityClients)),
+			zap.Int("tiers", len(cfg.IdentityTiers)))
+	} else if cfg.JWTEnabled {
+		log.Warn("JWT tier claim is ignored with IP identity, set IDENTITY_SOURCE=jwt:<claim> to limit per token subject")
+	}
+
 	// Métricas
 	metricsServer := metrics.NewServer(cfg.MetricsPort)
 
 	// Rate limiter
 	var rateLimiter ratelimit.Limiter
-	var err error
 	
-	if cfg.RedisEnabled {
+	switch cfg.RateLimitBackend {
+	case "redis":
 		rateLimiter, err = ratelimit.NewRedisLimiter(cfg.RedisURL)
 		if err != nil {
 			log.Error("failed to create Redis rate limiter", zap.Error(err))
 			os.Exit(1)
 		}
-	} else {
+	case "sentinel":
+		rateLimiter, err = ratelimit.NewSentinelLimiter(ratelimit.SentinelConfig{
+			MasterName:       cfg.RedisSentinelMaster,
+			SentinelAddrs:    cfg.RedisSentinelAddrs,
+			SentinelPassword: cfg.RedisSentinelPassword,
+			Password:         cfg.RedisPassword,
+			MaxRetries:       cfg.RedisMaxRetries,
+			DialTimeout:      cfg.RedisDialTimeout,
+			ReadTimeout:      cfg.RedisReadTimeout,
+			WriteTimeout:     cfg.RedisWriteTimeout,
+			PoolSize:         cfg.RedisPoolSize,
+			MinIdleConns:     cfg.RedisMinIdleConns,
+			MaxConnAge:       cfg.RedisMaxConnAge,
+			PoolTimeout:      cfg.RedisPoolTimeout,
+			IdleTimeout:      cfg.RedisIdleTimeout,
+		}, log)
+		if err != nil {
+			log.Error("failed to create Redis sentinel rate limiter", zap.Error(err))
+			os.Exit(1)
+		}
+	case "cluster":
+		rateLimiter, err = ratelimit.NewClusterLimiter(ratelimit.ClusterConfig{
+			Addrs:        cfg.RedisClusterAddrs,
+			Password:     cfg.RedisPassword,
+			MaxRetries:   cfg.RedisMaxRetries,
+			DialTimeout:  cfg.RedisDialTimeout,
+			ReadTimeout:  cfg.RedisReadTimeout,
+			WriteTimeout: cfg.RedisWriteTimeout,
+			PoolSize:     cfg.RedisPoolSize,
+			MinIdleConns: cfg.RedisMinIdleConns,
+			MaxConnAge:   cfg.RedisMaxConnAge,
+			PoolTimeout:  cfg.RedisPoolTimeout,
+			IdleTimeout:  cfg.RedisIdleTimeout,
+		}, log)
+		if err != nil {
+			log.Error("failed to create Redis cluster rate limiter", zap.Error(err))
+			os.Exit(1)
+		}
+	case "memory":
+		log.Info("using in-memory rate limiter (single instance)")
+		rateLimiter = ratelimit.NewMemoryLimiter(0)
+	case "dummy":
 		log.Info("using dummy rate limiter (no limiting)")
 		rateLimiter = ratelimit.NewDummyLimiter()
+	default:
+		log.Error("unknown rate limit backend", zap.String("backend", cfg.RateLimitBackend))
+		os.Exit(1)
+	}
+
+	// Cliente Redis del backend (antes de envolverlo) para los overrides compartidos
+	redisProvider, _ := rateLimiter.(ratelimit.RedisClientProvider)
+
+	// Circuit breaker: si Redis cae se usa un limiter local sin esperar timeouts.
+	// El limiter local es el mismo que usa el middleware con la política local.
+	var fallback *ratelimit.MemoryLimiter
+	if cfg.BreakerEnabled && cfg.RateLimitBackend != "memory" && cfg.RateLimitBackend != "dummy" {
+		fallback = ratelimit.NewMemoryLimiter(0)
+		defer fallback.Close()
+		rateLimiter = ratelimit.NewCircuitBreakerLimiter(rateLimiter, fallback, ratelimit.BreakerConfig{
+			Name:             cfg.RateLimitBackend,
+			FailureThreshold: cfg.BreakerThreshold,
+			ProbeInterval:    cfg.BreakerProbeInterval,
+			Instances:        cfg.ProxyInstances,
+		}, log)
+		log.Info("rate limit circuit breaker enabled",
+			zap.Int("threshold", cfg.BreakerThreshold),
+			zap.Duration("probe_interval", cfg.BreakerProbeInterval))
 	}
 	defer rateLimiter.Close()
 
 	// Proxy server
 	proxyServer := proxy.NewServer(cfg, rateLimiter, log)
+	if fallback != nil {
+		proxyServer.RateLimitMiddleware().SetFallback(fallback)
+	}
+	defer proxyServer.RateLimitMiddleware().Close()
+
+	// Recarga en caliente del archivo de reglas (cambios en disco o SIGHUP)
+	if cfg.RulesFile != "" {
+		reloader := config.NewRulesReloader(cfg.RulesFile, cfg.RulesReloadInterval, proxyServer.RateLimitMiddleware().SetRules, log)
+		reloader.Start()
+		defer reloader.Stop()
+		log.Info("rate limit rules loaded",
+			zap.String("file", cfg.RulesFile),
+			zap.Int("rules", len(cfg.Rules)),
+			zap.Duration("reload_interval", cfg.RulesReloadInterval))
+	}
+
+	// Overrides de límites en Redis compartidos por todas las instancias
+	var overrides *ratelimit.OverrideStore
+	if cfg.OverridesEnabled && redisProvider != nil {
+		overrides = ratelimit.NewOverrideStore(redisProvider.RedisClient(), cfg.OverridesKey, proxyServer.RateLimitMiddleware().SetOverrides, log)
+		startCtx, cancelStart := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := overrides.Start(startCtx); err != nil {
+			log.Warn("failed to load rate limit overrides, will retry in background", zap.Error(err))
+		}
+		cancelStart()
+		defer overrides.Stop()
+	}
+
+	// API de administración (solo con ADMIN_TOKEN)
+	var adminServer *admin.Server
+	if cfg.AdminToken != "" {
+		adminServer = admin.NewServer(cfg.AdminPort, cfg.AdminToken, proxyServer.RateLimitMiddleware(), rateLimiter, overrides, log)
+	} else {
+		log.Info("admin API disabled, set ADMIN_TOKEN to enable it")
+	}
 
 	// HTTP Server optimizado para alta carga
 	mainServer := &http.Server{
@@ -82,6 +218,15 @@ func main() {
 		}
 	}()
 
+	if adminServer != nil {
+		go func() {
+			log.Info("starting admin server", zap.String("port", cfg.AdminPort))
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Error("admin server failed", zap.Error(err))
+			}
+		}()
+	}
+
 	go func() {
 		log.Info("starting main server", zap.String("port", cfg.Port))
 		if err := mainServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -109,5 +254,11 @@ func main() {
 		log.Error("metrics server shutdown error", zap.Error(err))
 	}
 
+	if adminServer != nil {
+		if err := adminServer.Shutdown(ctx); err != nil {
+			log.Error("admin server shutdown error", zap.Error(err))
+		}
+	}
+
 	log.Info("servers shutdown complete")
 }
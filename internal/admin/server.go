@@ -0,0 +1,466 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/andress1014/meli-proxy/internal/middleware"
+	"github.com/andress1014/meli-proxy/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
+// Tamaño máximo del body de un override
+const maxOverrideBody = 64 << 10
+
+// Server expone la API de administración del rate limiter en un puerto propio.
+// Todos los endpoints requieren Authorization: Bearer <token>.
+//
+//	GET    /admin/rules              reglas efectivas (overrides y archivo)
+//	GET    /admin/limits?ip=&path=   cupo consumido y restante de cada key
+//	DELETE /admin/limits?ip=&path=   resetea las keys
+//	GET    /admin/overrides          overrides activos
+//	PUT    /admin/overrides/{id}     crea o reemplaza un override (?ttl=10m)
+//	DELETE /admin/overrides/{id}     elimina un override
+//	GET    /admin/paths?path=        templates, patrones detectados por ID y prueba de un path
+type Server struct {
+	server    *http.Server
+	token     string
+	rateLimit *middleware.RateLimitMiddleware
+	limiter   ratelimit.Limiter
+	overrides *ratelimit.OverrideStore
+	logger    *zap.Logger
+}
+
+// NewServer crea el servidor de administración. overrides es nil si están
+// apagados o el backend no es Redis; en ese caso los endpoints de overrides responden 503.
+func NewServer(port, token string, rateLimit *middleware.RateLimitMiddleware, limiter ratelimit.Limiter, overrides *ratelimit.OverrideStore, logger *zap.Logger) *Server {
+	s := &Server{
+		token:     token,
+		rateLimit: rateLimit,
+		limiter:   limiter,
+		overrides: overrides,
+		logger:    logger,
+	}
+
+	s.server = &http.Server{
+		Addr:              ":" + port,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 2 * time.Second,
+	}
+	return s
+}
+
+// Handler devuelve las rutas de la API con autenticación
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/rules", s.handleRules)
+	mux.HandleFunc("/admin/limits", s.handleLimits)
+	mux.HandleFunc("/admin/overrides", s.handleOverrides)
+	mux.HandleFunc("/admin/overrides/", s.handleOverride)
+	mux.HandleFunc("/admin/paths", s.handlePaths)
+	return s.authenticate(mux)
+}
+
+func (s *Server) ListenAndServe() error {
+	return s.server.ListenAndServe()
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || s.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "Missing or invalid admin token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ruleView es la representación JSON de una regla u override
+type ruleView struct {
+	Name      string            `json:"name"`
+	Scope     string            `json:"scope"`
+	IP        string            `json:"ip,omitempty"`
+	Path      string            `json:"path,omitempty"`
+	Method    string            `json:"method,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Limit     int               `json:"limit"`
+	Window    string            `json:"window"`
+	Stacked   []windowView      `json:"stacked,omitempty"`
+	Algorithm string            `json:"algorithm,omitempty"`
+	Burst     int               `json:"burst,omitempty"`
+	Line      int               `json:"line,omitempty"`
+	ExpiresAt *time.Time        `json:"expires_at,omitempty"`
+}
+
+// windowView es una ventana apilada de una regla
+type windowView struct {
+	Limit  int    `json:"limit"`
+	Window string `json:"window"`
+}
+
+func newRuleView(rule ratelimit.Rule) ruleView {
+	view := ruleView{
+		Name:      rule.Name,
+		Scope:     rule.Scope,
+		IP:        rule.Match.IP,
+		Path:      rule.Match.Path,
+		Method:    rule.Match.Method,
+		Limit:     rule.Limit,
+		Window:    rule.Window.String(),
+		Algorithm: string(rule.Algorithm),
+		Burst:     rule.Burst,
+		Line:      rule.Line,
+	}
+	if len(rule.Match.Headers) > 0 {
+		view.Headers = rule.Match.Headers
+	}
+	for _, window := range rule.Stacked {
+		view.Stacked = append(view.Stacked, windowView{Limit: window.Limit, Window: window.Window.String()})
+	}
+	if !rule.ExpiresAt.IsZero() {
+		expiresAt := rule.ExpiresAt
+		view.ExpiresAt = &expiresAt
+	}
+	return view
+}
+
+func ruleViews(rules []ratelimit.Rule) []ruleView {
+	views := make([]ruleView, 0, len(rules))
+	for _, rule := range rules {
+		views = append(views, newRuleView(rule))
+	}
+	return views
+}
+
+// handleRules lista las reglas en el orden en que se evalúan
+func (s *Server) handleRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"overrides": ruleViews(s.rateLimit.Overrides()),
+		"rules":     ruleViews(s.rateLimit.Rules()),
+	})
+}
+
+// handlePaths muestra cómo se normalizan los paths: los templates activos, los
+// patrones que generó la detección de IDs y, con ?path=, el resultado para ese path
+func (s *Server) handlePaths(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	detector := ratelimit.ActiveIDDetector()
+	response := map[string]interface{}{
+		"templates":    ratelimit.PathTemplates(),
+		"id_detection": detector != nil,
+		"detected":     []ratelimit.DetectedPath{},
+	}
+	if detector != nil {
+		response["detected"] = detector.Detected()
+	}
+	if path := r.URL.Query().Get("path"); path != "" {
+		response["path"] = map[string]string{
+			"original":   path,
+			"normalized": ratelimit.PreviewNormalizePath(path),
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// limitView es el estado de una key del limiter
+type limitView struct {
+	Type      string    `json:"type"`
+	Key       string    `json:"key"`
+	Limit     int       `json:"limit"`
+	Window    string    `json:"window"`
+	Algorithm string    `json:"algorithm"`
+	Burst     int       `json:"burst,omitempty"`
+	Count     int       `json:"count"`
+	Remaining int       `json:"remaining"`
+	Allowed   bool      `json:"allowed"`
+	ResetTime time.Time `json:"reset_time"`
+}
+
+// handleLimits consulta (GET) o resetea (DELETE) las keys de una IP o cliente y/o path.
+// Con solo ip se usa la key de IP, con solo path la del path y con ambos las tres;
+// identity o api_key reemplazan la IP por las keys del cliente (ver limitsFor).
+func (s *Server) handleLimits(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodDelete)
+		return
+	}
+
+	inspector, ok := s.limiter.(ratelimit.Inspector)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "not_supported", ratelimit.ErrInspectNotSupported.Error())
+		return
+	}
+
+	types, limits, err := s.limitsFor(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		keys := make([]string, 0, len(types))
+		for _, limitType := range sortedTypes(types) {
+			keys = append(keys, types[limitType])
+		}
+		if err := inspector.Reset(r.Context(), keys...); err != nil {
+			s.logger.Error("admin reset failed", zap.Strings("keys", keys), zap.Error(err))
+			writeError(w, http.StatusBadGateway, "backend_error", err.Error())
+			return
+		}
+		s.logger.Info("rate limit keys reset via admin API", zap.Strings("keys", keys))
+		writeJSON(w, http.StatusOK, map[string]interface{}{"reset": keys})
+		return
+	}
+
+	results, err := inspector.Peek(r.Context(), limits)
+	if err != nil {
+		s.logger.Error("admin peek failed", zap.Error(err))
+		writeError(w, http.StatusBadGateway, "backend_error", err.Error())
+		return
+	}
+
+	views := make([]limitView, 0, len(types))
+	for _, limitType := range sortedTypes(types) {
+		key := types[limitType]
+		config, result := limits[key], results[key]
+		if result == nil {
+			continue
+		}
+
+		algorithm := config.Algorithm
+		if algorithm == "" {
+			algorithm = ratelimit.AlgorithmSlidingWindow
+		}
+		views = append(views, limitView{
+			Type:      limitType,
+			Key:       key,
+			Limit:     config.Limit,
+			Window:    config.Window.String(),
+			Algorithm: string(algorithm),
+			Burst:     config.Burst,
+			Count:     capacity(config) - result.Remaining,
+			Remaining: result.Remaining,
+			Allowed:   result.Allowed,
+			ResetTime: result.ResetTime,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"limits": views})
+}
+
+// limitsFor arma un request equivalente al del cliente para obtener las mismas
+// keys y límites que aplicaría el middleware. Con identity (tipo:hash) o api_key
+// las keys de cliente son las de esa identidad (client::, client_path:: y cuotas).
+func (s *Server) limitsFor(r *http.Request) (map[string]string, map[string]ratelimit.LimitConfig, error) {
+	query := r.URL.Query()
+	ip := strings.TrimSpace(query.Get("ip"))
+	path := strings.TrimSpace(query.Get("path"))
+	identity, tier, err := clientIdentity(query.Get("identity"), query.Get("api_key"))
+	if err != nil {
+		return nil, nil, err
+	}
+	client := ip != "" || identity != ""
+	if !client && path == "" {
+		return nil, nil, errors.New("ip, identity, api_key or path is required")
+	}
+	if ip != "" && net.ParseIP(ip) == nil {
+		return nil, nil, errors.New("invalid ip")
+	}
+	if path != "" && !strings.HasPrefix(path, "/") {
+		return nil, nil, errors.New("path must start with /")
+	}
+
+	method := strings.ToUpper(query.Get("method"))
+	if method == "" {
+		method = http.MethodGet
+	}
+	target := path
+	if target == "" {
+		target = "/"
+	}
+	req, err := http.NewRequestWithContext(r.Context(), method, target, nil)
+	if err != nil {
+		return nil, nil, errors.New("invalid path")
+	}
+	req.RemoteAddr = net.JoinHostPort(ip, "0")
+
+	derived := ratelimit.PreviewKeys(req)
+	if identity != "" {
+		derived.Identity, derived.Tier = identity, tier
+	}
+	keys, limits := s.rateLimit.LimitConfigsFor(req, derived)
+
+	wanted := make(map[string]string, len(keys))
+	for limitType, key := range keys {
+		// Las ventanas apiladas (ip:1s) siguen el criterio de su scope
+		scope, _, _ := strings.Cut(limitType, ":")
+		switch {
+		case scope == "ip" && client,
+			scope == "path" && path != "",
+			scope == "ip_path" && client && path != "",
+			strings.HasPrefix(limitType, "quota_") && client:
+			wanted[limitType] = key
+		}
+	}
+
+	selected := make(map[string]ratelimit.LimitConfig, len(wanted))
+	for _, key := range wanted {
+		selected[key] = limits[key]
+	}
+	return wanted, selected, nil
+}
+
+// clientIdentity resuelve identity o api_key con el resolver de IDENTITY_SOURCE;
+// sin ninguno de los dos devuelve "" (las keys de cliente son las de la IP)
+func clientIdentity(identity, apiKey string) (string, string, error) {
+	identity, apiKey = strings.TrimSpace(identity), strings.TrimSpace(apiKey)
+	if identity == "" && apiKey == "" {
+		return "", "", nil
+	}
+	if identity != "" && apiKey != "" {
+		return "", "", errors.New("use either identity or api_key, not both")
+	}
+	resolver := ratelimit.ActiveIdentityResolver()
+	if resolver == nil {
+		return "", "", errors.New("identity requires IDENTITY_SOURCE other than ip")
+	}
+
+	if apiKey != "" {
+		identity, tier, ok := resolver.Lookup(apiKey)
+		if !ok {
+			return "", "", errors.New("unknown api_key")
+		}
+		return identity, tier, nil
+	}
+	tier, ok := resolver.Tier(identity)
+	if !ok {
+		return "", "", errors.New("invalid identity")
+	}
+	return identity, tier, nil
+}
+
+// capacity es el cupo máximo de la key: el burst en token bucket y GCRA, si no el límite
+func capacity(config ratelimit.LimitConfig) int {
+	if config.Burst > 0 && (config.Algorithm == ratelimit.AlgorithmTokenBucket || config.Algorithm == ratelimit.AlgorithmGCRA) {
+		return config.Burst
+	}
+	return config.Limit
+}
+
+func sortedTypes(types map[string]string) []string {
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// handleOverrides lista los overrides activos en esta instancia
+func (s *Server) handleOverrides(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"overrides": ruleViews(s.rateLimit.Overrides()),
+	})
+}
+
+// handleOverride crea, reemplaza o elimina el override /admin/overrides/{id}
+func (s *Server) handleOverride(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/admin/overrides/")
+	if id == "" || strings.Contains(id, "/") {
+		writeError(w, http.StatusNotFound, "not_found", "Override id is required")
+		return
+	}
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		writeMethodNotAllowed(w, http.MethodPut, http.MethodDelete)
+		return
+	}
+	if s.overrides == nil {
+		writeError(w, http.StatusServiceUnavailable, "overrides_unavailable", "Overrides require RATE_LIMIT_OVERRIDES_ENABLED=true and a Redis backend")
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if err := s.overrides.Delete(r.Context(), id); err != nil {
+			s.logger.Error("admin override delete failed", zap.String("id", id), zap.Error(err))
+			writeError(w, http.StatusBadGateway, "backend_error", err.Error())
+			return
+		}
+		s.logger.Info("rate limit override deleted via admin API", zap.String("id", id))
+		writeJSON(w, http.StatusOK, map[string]interface{}{"id": id, "deleted": true})
+		return
+	}
+
+	var ttl time.Duration
+	if value := r.URL.Query().Get("ttl"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid_request", "ttl must be a positive duration")
+			return
+		}
+		ttl = parsed
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxOverrideBody))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Failed to read body")
+		return
+	}
+
+	rule, err := ratelimit.ParseOverride(id, data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_override", err.Error())
+		return
+	}
+	if err := s.overrides.Set(r.Context(), id, data, ttl); err != nil {
+		s.logger.Error("admin override store failed", zap.String("id", id), zap.Error(err))
+		writeError(w, http.StatusBadGateway, "backend_error", err.Error())
+		return
+	}
+
+	if ttl > 0 {
+		rule.ExpiresAt = time.Now().Add(ttl)
+	}
+	s.logger.Info("rate limit override stored via admin API",
+		zap.String("id", id),
+		zap.Duration("ttl", ttl))
+	writeJSON(w, http.StatusOK, newRuleView(rule))
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]string{"error": code, "message": message})
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter, methods ...string) {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+}
@@ -0,0 +1,251 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andress1014/meli-proxy/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// Tamaño mínimo de las claves RSA aceptadas
+const minRSABits = 2048
+
+// Tamaño máximo de un JWKS remoto
+const maxJWKSBody = 1 << 20
+
+// Intervalo mínimo entre descargas del JWKS por kids desconocidos
+const maxRefetchInterval = 30 * time.Second
+
+// KeySet son las claves públicas RS256 de un JWKS, indexadas por kid. Se carga
+// una vez desde un archivo o se descarga de una URL y se cachea durante ttl.
+//
+// Con URL, al vencer el cache se sigue usando el JWKS anterior mientras se
+// descarga el nuevo en background. Un kid desconocido (rotación de claves)
+// fuerza una descarga, como mucho una cada min(ttl, 30s) para que tokens
+// inventados no saturen al proveedor.
+type KeySet struct {
+	keys atomic.Pointer[map[string]*rsa.PublicKey]
+
+	url        string
+	ttl        time.Duration
+	client     *http.Client
+	logger     *zap.Logger
+	mu         sync.Mutex   // serializa las descargas
+	fetched    atomic.Int64 // unix nano de la última descarga exitosa
+	attempted  time.Time    // última descarga, exitosa o no; protegido por mu
+	refreshing atomic.Bool
+}
+
+// LoadKeySetFile carga un JWKS desde un archivo; no se vuelve a leer
+func LoadKeySetFile(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	ks := &KeySet{}
+	ks.keys.Store(&keys)
+	return ks, nil
+}
+
+// NewRemoteKeySet crea un KeySet que descarga el JWKS de url. No descarga nada
+// hasta el primer Refresh o la primera búsqueda de una clave.
+func NewRemoteKeySet(url string, ttl time.Duration, client *http.Client, logger *zap.Logger) *KeySet {
+	return &KeySet{url: url, ttl: ttl, client: client, logger: logger}
+}
+
+// Refresh descarga el JWKS remoto y reemplaza las claves. Si falla se mantienen
+// las anteriores. Sin URL no hace nada.
+func (ks *KeySet) Refresh(ctx context.Context) error {
+	if ks.url == "" {
+		return nil
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	return ks.fetch(ctx)
+}
+
+// Key devuelve la clave del kid. Sin kid solo se acepta si el JWKS tiene una única clave.
+func (ks *KeySet) Key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	if ks.url != "" {
+		if ks.keys.Load() == nil {
+			ks.refetch(ctx)
+		} else if ks.expired() && ks.refreshing.CompareAndSwap(false, true) {
+			go func() {
+				defer ks.refreshing.Store(false)
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+				ks.Refresh(ctx)
+			}()
+		}
+	}
+
+	if key := ks.lookup(kid); key != nil {
+		return key, nil
+	}
+	// kid desconocido: puede que el proveedor haya rotado las claves. Si otra
+	// descarga estaba en curso, ya puede haberlas traído.
+	if ks.url != "" {
+		ks.refetch(ctx)
+		if key := ks.lookup(kid); key != nil {
+			return key, nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+// Len devuelve la cantidad de claves cargadas
+func (ks *KeySet) Len() int {
+	if keys := ks.keys.Load(); keys != nil {
+		return len(*keys)
+	}
+	return 0
+}
+
+func (ks *KeySet) lookup(kid string) *rsa.PublicKey {
+	keys := ks.keys.Load()
+	if keys == nil {
+		return nil
+	}
+	if kid == "" && len(*keys) == 1 {
+		for _, key := range *keys {
+			return key
+		}
+	}
+	return (*keys)[kid]
+}
+
+func (ks *KeySet) expired() bool {
+	return time.Since(time.Unix(0, ks.fetched.Load())) >= ks.ttl
+}
+
+// refetch descarga el JWKS si pasó el intervalo mínimo desde el último intento
+func (ks *KeySet) refetch(ctx context.Context) {
+	interval := ks.ttl
+	if interval > maxRefetchInterval {
+		interval = maxRefetchInterval
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if time.Since(ks.attempted) >= interval {
+		ks.fetch(ctx)
+	}
+}
+
+// fetch descarga y parsea el JWKS; se llama con mu tomado
+func (ks *KeySet) fetch(ctx context.Context) error {
+	ks.attempted = time.Now()
+
+	keys, err := ks.download(ctx)
+	metrics.RecordJWKSRefresh(err == nil)
+	if err != nil {
+		if ks.logger != nil {
+			ks.logger.Warn("JWKS refresh failed", zap.String("url", ks.url), zap.Error(err))
+		}
+		return err
+	}
+
+	ks.keys.Store(&keys)
+	ks.fetched.Store(time.Now().UnixNano())
+	return nil
+}
+
+func (ks *KeySet) download(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := ks.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSBody))
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// ParseJWKS devuelve las claves RSA de firma de un JWKS ({"keys": [...]}).
+// Las claves de otro tipo, uso o algoritmo se ignoran.
+func ParseJWKS(data []byte) (map[string]*rsa.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") || (jwk.Alg != "" && jwk.Alg != "RS256") {
+			continue
+		}
+		key, err := rsaPublicKey(jwk)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWKS key %q: %w", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("invalid JWKS: no RS256 signing keys")
+	}
+	return keys, nil
+}
+
+func rsaPublicKey(jwk jsonWebKey) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, errors.New("invalid modulus")
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil || len(e) == 0 || len(e) > 4 {
+		return nil, errors.New("invalid exponent")
+	}
+
+	exponent := 0
+	for _, b := range e {
+		exponent = exponent<<8 | int(b)
+	}
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}
+	if key.N.BitLen() < minRSABits {
+		return nil, fmt.Errorf("key must have at least %d bits", minRSABits)
+	}
+	if exponent < 3 || exponent%2 == 0 {
+		return nil, errors.New("invalid exponent")
+	}
+	return key, nil
+}
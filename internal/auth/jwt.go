@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errores de validación de un token; todos terminan en 401
+var (
+	ErrMissingToken         = errors.New("missing bearer token")
+	ErrMalformedToken       = errors.New("malformed token")
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrUnknownKey           = errors.New("unknown signing key")
+	ErrInvalidSignature     = errors.New("invalid signature")
+	ErrTokenExpired         = errors.New("token expired")
+	ErrTokenNotYetValid     = errors.New("token not yet valid")
+	ErrInvalidIssuer        = errors.New("invalid issuer")
+	ErrInvalidAudience      = errors.New("invalid audience")
+)
+
+// Claims es el payload de un token ya verificado
+type Claims map[string]interface{}
+
+// String devuelve un claim string o numérico como texto, o "" si no existe
+func (c Claims) String(name string) string {
+	switch value := c[name].(type) {
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	}
+	return ""
+}
+
+// VerifierConfig define las claves y los claims que se exigen. HS256 se valida
+// solo con Secret y RS256 solo con Keys, así un token no puede elegir con qué
+// material se verifica su firma.
+type VerifierConfig struct {
+	Secret   []byte
+	Keys     *KeySet
+	Issuer   string        // iss exigido, si no está vacío
+	Audience string        // valor que debe estar en aud, si no está vacío
+	Leeway   time.Duration // tolerancia de reloj para exp y nbf
+}
+
+// Verifier valida JWTs firmados con HS256 o RS256
+type Verifier struct {
+	config VerifierConfig
+	now    func() time.Time
+}
+
+func NewVerifier(config VerifierConfig) *Verifier {
+	return &Verifier{config: config, now: time.Now}
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify valida la firma, exp, nbf, iss y aud del token y devuelve sus claims.
+// ctx se usa si hay que buscar la clave en el JWKS remoto.
+func (v *Verifier) Verify(ctx context.Context, token string) (Claims, error) {
+	headerPart, rest, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrMalformedToken
+	}
+	payloadPart, signaturePart, ok := strings.Cut(rest, ".")
+	if !ok || strings.Contains(signaturePart, ".") {
+		return nil, ErrMalformedToken
+	}
+
+	var h header
+	if err := decodeSegment(headerPart, &h); err != nil {
+		return nil, ErrMalformedToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(signaturePart)
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	if err := v.verifySignature(ctx, h, token[:len(headerPart)+1+len(payloadPart)], signature); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(payloadPart, &claims); err != nil {
+		return nil, ErrMalformedToken
+	}
+	if err := v.validateClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *Verifier) verifySignature(ctx context.Context, h header, signingInput string, signature []byte) error {
+	switch h.Alg {
+	case "HS256":
+		if len(v.config.Secret) == 0 {
+			return ErrUnsupportedAlgorithm
+		}
+		mac := hmac.New(sha256.New, v.config.Secret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return ErrInvalidSignature
+		}
+		return nil
+	case "RS256":
+		if v.config.Keys == nil {
+			return ErrUnsupportedAlgorithm
+		}
+		key, err := v.config.Keys.Key(ctx, h.Kid)
+		if err != nil {
+			return err
+		}
+		digest := sha256.Sum256([]byte(signingInput))
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+	return ErrUnsupportedAlgorithm
+}
+
+func (v *Verifier) validateClaims(claims Claims) error {
+	now := v.now()
+
+	if exp, ok, err := numericDate(claims, "exp"); err != nil {
+		return err
+	} else if ok && !now.Before(exp.Add(v.config.Leeway)) {
+		return ErrTokenExpired
+	}
+	if nbf, ok, err := numericDate(claims, "nbf"); err != nil {
+		return err
+	} else if ok && now.Add(v.config.Leeway).Before(nbf) {
+		return ErrTokenNotYetValid
+	}
+
+	if v.config.Issuer != "" && claims.String("iss") != v.config.Issuer {
+		return ErrInvalidIssuer
+	}
+	if v.config.Audience != "" && !hasAudience(claims["aud"], v.config.Audience) {
+		return ErrInvalidAudience
+	}
+	return nil
+}
+
+// numericDate lee un claim de fecha en segundos desde epoch
+func numericDate(claims Claims, name string) (time.Time, bool, error) {
+	value, exists := claims[name]
+	if !exists {
+		return time.Time{}, false, nil
+	}
+	number, ok := value.(json.Number)
+	if !ok {
+		return time.Time{}, false, ErrMalformedToken
+	}
+	seconds, err := strconv.ParseFloat(number.String(), 64)
+	if err != nil {
+		return time.Time{}, false, ErrMalformedToken
+	}
+	whole, fraction := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(fraction*1e9)), true, nil
+}
+
+// hasAudience acepta aud como string o como lista de strings
+func hasAudience(aud interface{}, audience string) bool {
+	switch value := aud.(type) {
+	case string:
+		return value == audience
+	case []interface{}:
+		for _, item := range value {
+			if item == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// BearerToken devuelve el token de Authorization: Bearer <token>, o "" si no hay
+func BearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+type contextKey int
+
+const claimsKey contextKey = iota
+
+// WithClaims guarda en el contexto los claims de un token verificado
+func WithClaims(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(ctx, claimsKey, claims)
+}
+
+// ClaimsFromContext devuelve los claims verificados del request, si los hay
+func ClaimsFromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(claimsKey).(Claims)
+	return claims, ok
+}
@@ -1,9 +1,15 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"net/netip"
 	"os"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/andress1014/meli-proxy/internal/ratelimit"
 )
 
 type Config struct {
@@ -14,14 +20,126 @@ type Config struct {
 	LogLevel    string
 	RedisEnabled bool
 
-	// Rate limiting configuration
-	DefaultRPS      int
-	IPRateLimit     map[string]int
-	PathRateLimit   map[string]int
-	IPPathRateLimit map[string]int
+	// Backend del rate limiter: redis, sentinel, cluster, memory o dummy
+	RateLimitBackend string
+
+	// Redis Cluster y pool de conexiones (0 = default del limiter)
+	RedisClusterAddrs []string
+	RedisPassword     string
+	RedisPoolSize     int
+	RedisMinIdleConns int
+	RedisMaxRetries   int
+	RedisDialTimeout  time.Duration
+	RedisReadTimeout  time.Duration
+	RedisWriteTimeout time.Duration
+	RedisPoolTimeout  time.Duration
+	RedisIdleTimeout  time.Duration
+	RedisMaxConnAge   time.Duration
+
+	// Redis Sentinel: nombre del master y direcciones de los sentinels
+	RedisSentinelMaster   string
+	RedisSentinelAddrs    []string
+	RedisSentinelPassword string
+
+	// Rate limiting configuration: DefaultLimit requests por DefaultWindow.
+	// DefaultRPS es el nombre anterior de DefaultLimit y se mantiene por compatibilidad.
+	DefaultLimit       int
+	DefaultWindow      time.Duration
+	DefaultIPPathLimit int // 0 = la mitad del límite del cliente
+	DefaultRPS         int
+	IPRateLimit        map[string]int
+	PathRateLimit      map[string]int
+	IPPathRateLimit    map[string]int
+
+	// Agrega el método HTTP a todas las keys (cada método con su propio cupo)
+	KeyByMethod bool
+
+	// Formato de los headers de rate limit: legacy (X-RateLimit-*), standard
+	// (RateLimit y RateLimit-Policy del draft de la IETF) o both
+	RateLimitHeaders string
+
+	// Identidad del cliente: ip, header:<nombre>, bearer o jwt:<claim>.
+	// IdentityClients asigna un tier a cada credencial y IdentityTiers el límite de cada tier.
+	IdentitySource      string
+	IdentityTiers       map[string]int
+	IdentityClients     map[string]string
+	IdentityDefaultTier string
+	// Con jwt:<claim> y sin JWTEnabled, confiar en tokens ya validados por un gateway
+	IdentityTrustUpstreamJWT bool
+
+	// Cuotas diarias y mensuales por cliente además de los límites por minuto
+	// (0 = sin cuota); las de cada tier reemplazan a las default
+	QuotaDaily        int
+	QuotaMonthly      int
+	TierDailyQuotas   map[string]int
+	TierMonthlyQuotas map[string]int
+
+	// Validación de JWTs: HS256 con JWTSecret y/o RS256 con un JWKS local o remoto.
+	// JWTTierClaim elige el tier (de IdentityTiers) del token verificado.
+	JWTEnabled      bool
+	JWTSecret       string
+	JWTJWKSFile     string
+	JWTJWKSURL      string
+	JWTJWKSCacheTTL time.Duration
+	JWTIssuer       string
+	JWTAudience     string
+	JWTLeeway       time.Duration
+	JWTRequired     bool
+	JWTTierClaim    string
+
+	// Templates de normalización de paths (/orders/{id}) que se suman a los integrados
+	PathTemplates []string
+	// Reemplaza por * los segmentos con forma de ID en paths sin template
+	PathIDDetection bool
+
+	// Reglas declarativas del archivo RATE_LIMIT_RULES_FILE; tienen prioridad
+	// sobre los mapas de variables de entorno
+	RulesFile           string
+	Rules               []ratelimit.Rule
+	RulesReloadInterval time.Duration
+
+	// Overrides compartidos en Redis (hash + canal <key>:changed)
+	OverridesEnabled bool
+	OverridesKey     string
+
+	// Algoritmo por regla: default global y overrides por path
+	DefaultAlgorithm string
+	PathAlgorithms   map[string]string
+	PathBursts       map[string]int
+
+	// Política ante errores del backend (open, closed, local): default y por path.
+	// ProxyInstances reparte el límite global cuando se usa el limiter local.
+	FailPolicy       string
+	PathFailPolicies map[string]string
+	ProxyInstances   int
+
+	// Circuit breaker alrededor del backend: tras BreakerThreshold errores
+	// consecutivos se usa el limiter local y se prueba el backend cada BreakerProbeInterval
+	BreakerEnabled       bool
+	BreakerThreshold     int
+	BreakerProbeInterval time.Duration
+
+	// Allowlist (sin rate limiting) y denylist (403) por IP o CIDR, de la
+	// variable de entorno y/o de un archivo con el formato de ips.csv
+	IPAllowListFile string
+	IPDenyListFile  string
+	IPAllowList     []netip.Prefix
+	IPDenyList      []netip.Prefix
+
+	// Proxies de confianza (IP o CIDR) y el único header que escriben
+	// (x-forwarded-for, forwarded o x-real-ip): solo de ellos se acepta para
+	// obtener la IP del cliente
+	TrustedProxies     []netip.Prefix
+	TrustedProxyHeader string
+
+	// API de administración en su propio puerto, autenticada con AdminToken
+	AdminPort  string
+	AdminToken string
 }
 
-func Load() *Config {
+// Load lee la configuración de variables de entorno y el archivo de reglas.
+// Devuelve error si el archivo de reglas no existe o es inválido.
+func Load() (*Config, error) {
 	cfg := &Config{
 		Port:         getEnv("PORT", "8080"),
 		MetricsPort:  getEnv("METRICS_PORT", "9090"),
@@ -32,12 +150,181 @@ func Load() *Config {
 		DefaultRPS:   getEnvInt("DEFAULT_RPS", 100),      // Rate limit por defecto
 	}
 
+	// Redis Cluster y pool de conexiones
+	cfg.RedisClusterAddrs = parseList(getEnv("REDIS_CLUSTER_ADDRS", ""))
+	cfg.RedisPassword = getEnv("REDIS_PASSWORD", "")
+	cfg.RedisPoolSize = getEnvInt("REDIS_POOL_SIZE", 0)
+	cfg.RedisMinIdleConns = getEnvInt("REDIS_MIN_IDLE_CONNS", 0)
+	cfg.RedisMaxRetries = getEnvInt("REDIS_MAX_RETRIES", 0)
+	cfg.RedisDialTimeout = getEnvDuration("REDIS_DIAL_TIMEOUT", 0)
+	cfg.RedisReadTimeout = getEnvDuration("REDIS_READ_TIMEOUT", 0)
+	cfg.RedisWriteTimeout = getEnvDuration("REDIS_WRITE_TIMEOUT", 0)
+	cfg.RedisPoolTimeout = getEnvDuration("REDIS_POOL_TIMEOUT", 0)
+	cfg.RedisIdleTimeout = getEnvDuration("REDIS_IDLE_TIMEOUT", 0)
+	cfg.RedisMaxConnAge = getEnvDuration("REDIS_MAX_CONN_AGE", 0)
+
+	// Redis Sentinel
+	cfg.RedisSentinelMaster = getEnv("REDIS_SENTINEL_MASTER", "")
+	cfg.RedisSentinelAddrs = parseList(getEnv("REDIS_SENTINEL_ADDRS", ""))
+	cfg.RedisSentinelPassword = getEnv("REDIS_SENTINEL_PASSWORD", "")
+
+	// Backend explícito; si no se define se respeta REDIS_ENABLED
+	cfg.RateLimitBackend = strings.ToLower(getEnv("RATE_LIMIT_BACKEND", ""))
+	if cfg.RateLimitBackend == "" {
+		if cfg.RedisEnabled && cfg.RedisSentinelMaster != "" {
+			cfg.RateLimitBackend = "sentinel"
+		} else if cfg.RedisEnabled && len(cfg.RedisClusterAddrs) > 0 {
+			cfg.RateLimitBackend = "cluster"
+		} else if cfg.RedisEnabled {
+			cfg.RateLimitBackend = "redis"
+		} else {
+			cfg.RateLimitBackend = "dummy"
+		}
+	}
+
+	// Límite por defecto: DEFAULT_LIMIT requests por RATE_LIMIT_WINDOW (DEFAULT_RPS sigue aceptándose)
+	cfg.DefaultLimit = getEnvInt("DEFAULT_LIMIT", cfg.DefaultRPS)
+	cfg.DefaultRPS = cfg.DefaultLimit
+	cfg.DefaultWindow = getEnvDuration("RATE_LIMIT_WINDOW", time.Minute)
+	cfg.DefaultIPPathLimit = getEnvInt("IP_PATH_DEFAULT_LIMIT", 0)
+	if cfg.DefaultWindow < time.Millisecond {
+		return nil, fmt.Errorf("invalid RATE_LIMIT_WINDOW %s: must be at least 1ms", cfg.DefaultWindow)
+	}
+
 	// Cargar configuraciones de rate limiting desde variables de entorno
 	cfg.IPRateLimit = parseRateLimitMap(getEnv("IP_RATE_LIMITS", ""))
 	cfg.PathRateLimit = parseRateLimitMap(getEnv("PATH_RATE_LIMITS", ""))
 	cfg.IPPathRateLimit = parseRateLimitMap(getEnv("IP_PATH_RATE_LIMITS", ""))
+	cfg.KeyByMethod = getEnvBool("RATE_LIMIT_KEY_BY_METHOD", false)
+	cfg.RateLimitHeaders = getEnv("RATE_LIMIT_HEADERS", string(ratelimit.HeadersLegacy))
+	if _, err := ratelimit.ParseHeaderMode(cfg.RateLimitHeaders); err != nil {
+		return nil, fmt.Errorf("invalid RATE_LIMIT_HEADERS: %w", err)
+	}
+
+	// Identidad por credencial con tiers; sin credencial se limita por IP
+	cfg.IdentitySource = getEnv("IDENTITY_SOURCE", ratelimit.IdentitySourceIP)
+	cfg.IdentityTiers = parseRateLimitMap(getEnv("IDENTITY_TIERS", ""))
+	cfg.IdentityClients = parseStringMap(getEnv("IDENTITY_CLIENTS", ""))
+	cfg.IdentityDefaultTier = getEnv("IDENTITY_DEFAULT_TIER", "")
+	cfg.IdentityTrustUpstreamJWT = getEnvBool("IDENTITY_JWT_TRUST_UPSTREAM", false)
+	cfg.QuotaDaily = getEnvInt("QUOTA_DAILY", 0)
+	cfg.QuotaMonthly = getEnvInt("QUOTA_MONTHLY", 0)
+	cfg.TierDailyQuotas = parseRateLimitMap(getEnv("QUOTA_TIER_DAILY", ""))
+	cfg.TierMonthlyQuotas = parseRateLimitMap(getEnv("QUOTA_TIER_MONTHLY", ""))
+	if err := cfg.validateIdentity(); err != nil {
+		return nil, fmt.Errorf("invalid identity config: %w", err)
+	}
+
+	// Validación de JWTs antes de reenviar al target
+	cfg.JWTEnabled = getEnvBool("JWT_ENABLED", false)
+	cfg.JWTSecret = getEnv("JWT_HS256_SECRET", "")
+	cfg.JWTJWKSFile = getEnv("JWT_JWKS_FILE", "")
+	cfg.JWTJWKSURL = getEnv("JWT_JWKS_URL", "")
+	cfg.JWTJWKSCacheTTL = getEnvDuration("JWT_JWKS_CACHE_TTL", 10*time.Minute)
+	cfg.JWTIssuer = getEnv("JWT_ISSUER", "")
+	cfg.JWTAudience = getEnv("JWT_AUDIENCE", "")
+	cfg.JWTLeeway = getEnvDuration("JWT_LEEWAY", 30*time.Second)
+	cfg.JWTRequired = getEnvBool("JWT_REQUIRED", true)
+	cfg.JWTTierClaim = getEnv("JWT_TIER_CLAIM", "plan")
+	if cfg.JWTEnabled {
+		if cfg.JWTSecret == "" && cfg.JWTJWKSFile == "" && cfg.JWTJWKSURL == "" {
+			return nil, errors.New("invalid JWT config: JWT_HS256_SECRET, JWT_JWKS_FILE or JWT_JWKS_URL is required")
+		}
+		if cfg.JWTJWKSFile != "" && cfg.JWTJWKSURL != "" {
+			return nil, errors.New("invalid JWT config: JWT_JWKS_FILE and JWT_JWKS_URL are mutually exclusive")
+		}
+	}
+	// Sin verificación local el claim de jwt:<claim> lo elegiría el cliente
+	if source, _, _ := strings.Cut(cfg.IdentitySource, ":"); strings.EqualFold(strings.TrimSpace(source), ratelimit.IdentitySourceJWT) &&
+		!cfg.JWTEnabled && !cfg.IdentityTrustUpstreamJWT {
+		return nil, errors.New("invalid identity config: IDENTITY_SOURCE=jwt:<claim> requires JWT_ENABLED=true (or IDENTITY_JWT_TRUST_UPSTREAM=true behind a gateway that validates tokens)")
+	}
+
+	// Templates de normalización de paths; se validan acá para fallar al iniciar
+	cfg.PathTemplates = parseList(getEnv("PATH_TEMPLATES", ""))
+	if _, err := ratelimit.NewPathNormalizer(cfg.PathTemplates); err != nil {
+		return nil, err
+	}
+	cfg.PathIDDetection = getEnvBool("PATH_ID_DETECTION", false)
+
+	// Algoritmo de rate limiting (sliding_window, token_bucket)
+	cfg.DefaultAlgorithm = getEnv("RATE_LIMIT_ALGORITHM", "sliding_window")
+	cfg.PathAlgorithms = parseStringMap(getEnv("PATH_RATE_LIMIT_ALGORITHMS", ""))
+	cfg.PathBursts = parseRateLimitMap(getEnv("PATH_RATE_LIMIT_BURSTS", ""))
+
+	// Política ante errores del backend del limiter
+	cfg.FailPolicy = getEnv("RATE_LIMIT_FAIL_POLICY", "open")
+	cfg.PathFailPolicies = parseStringMap(getEnv("PATH_RATE_LIMIT_FAIL_POLICIES", ""))
+	cfg.ProxyInstances = getEnvInt("PROXY_INSTANCES", 1)
+
+	// Circuit breaker del limiter
+	cfg.BreakerEnabled = getEnvBool("RATE_LIMIT_BREAKER_ENABLED", false)
+	cfg.BreakerThreshold = getEnvInt("RATE_LIMIT_BREAKER_THRESHOLD", 5)
+	cfg.BreakerProbeInterval = getEnvDuration("RATE_LIMIT_BREAKER_PROBE_INTERVAL", 5*time.Second)
+
+	// Archivo de reglas (YAML o JSON)
+	cfg.RulesFile = getEnv("RATE_LIMIT_RULES_FILE", "")
+	cfg.RulesReloadInterval = getEnvDuration("RATE_LIMIT_RULES_RELOAD_INTERVAL", 5*time.Second)
+
+	if cfg.RulesFile != "" {
+		rules, err := ratelimit.LoadRulesFile(cfg.RulesFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limit rules: %w", err)
+		}
+		cfg.Rules = rules
+	}
+
+	// Overrides compartidos entre instancias
+	cfg.OverridesEnabled = getEnvBool("RATE_LIMIT_OVERRIDES_ENABLED", false)
+	cfg.OverridesKey = getEnv("RATE_LIMIT_OVERRIDES_KEY", ratelimit.DefaultOverridesKey)
 
-	return cfg
+	// Allowlist y denylist de IPs
+	cfg.IPAllowListFile = getEnv("IP_ALLOWLIST_FILE", "")
+	cfg.IPDenyListFile = getEnv("IP_DENYLIST_FILE", "")
+	var err error
+	if cfg.IPAllowList, err = loadIPList("IP_ALLOWLIST", cfg.IPAllowListFile); err != nil {
+		return nil, fmt.Errorf("invalid IP allowlist: %w", err)
+	}
+	if cfg.IPDenyList, err = loadIPList("IP_DENYLIST", cfg.IPDenyListFile); err != nil {
+		return nil, fmt.Errorf("invalid IP denylist: %w", err)
+	}
+	if cfg.TrustedProxies, err = loadIPList("TRUSTED_PROXIES", ""); err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+	cfg.TrustedProxyHeader = getEnv("TRUSTED_PROXY_HEADER", string(ratelimit.ProxyHeaderXForwardedFor))
+	if _, err := ratelimit.ParseProxyHeader(cfg.TrustedProxyHeader); err != nil {
+		return nil, fmt.Errorf("invalid TRUSTED_PROXY_HEADER: %w", err)
+	}
+
+	// API de administración: solo se levanta si hay token
+	cfg.AdminPort = getEnv("ADMIN_PORT", "9091")
+	cfg.AdminToken = getEnv("ADMIN_TOKEN", "")
+
+	return cfg, nil
+}
+
+// validateIdentity verifica la fuente y que los tiers usados (clientes, default
+// y cuotas) estén definidos en IDENTITY_TIERS
+func (c *Config) validateIdentity() error {
+	if _, err := ratelimit.NewIdentityResolver(c.IdentitySource, nil, ""); err != nil {
+		return err
+	}
+	if _, exists := c.IdentityTiers[c.IdentityDefaultTier]; c.IdentityDefaultTier != "" && !exists {
+		return fmt.Errorf("unknown default tier %q", c.IdentityDefaultTier)
+	}
+	for _, tier := range c.IdentityClients {
+		if _, exists := c.IdentityTiers[tier]; !exists {
+			return fmt.Errorf("unknown tier %q", tier)
+		}
+	}
+	for _, quotas := range []map[string]int{c.TierDailyQuotas, c.TierMonthlyQuotas} {
+		for tier := range quotas {
+			if _, exists := c.IdentityTiers[tier]; !exists {
+				return fmt.Errorf("unknown tier %q in quotas", tier)
+			}
+		}
+	}
+	return nil
 }
 
 func getEnv(key, defaultValue string) string {
@@ -56,6 +343,15 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	return defaultValue
+}
+
 func getEnvBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
@@ -65,20 +361,65 @@ func getEnvBool(key string, defaultValue bool) bool {
 	return defaultValue
 }
 
-// parseRateLimitMap parsea strings como "key1:100,key2:200"
+// parseRateLimitMap parsea strings como "key1:100,key2:200".
+// Se separa en el último ':' para soportar keys como "192.168.1.100::/categories/*".
 func parseRateLimitMap(input string) map[string]int {
 	result := make(map[string]int)
+	for key, value := range parseStringMap(input) {
+		if limit, err := strconv.Atoi(value); err == nil {
+			result[key] = limit
+		}
+	}
+	return result
+}
+
+// parseStringMap parsea strings como "key1:value1,key2:value2".
+// El valor es lo que sigue al último ':' para permitir keys con ':'.
+func parseStringMap(input string) map[string]string {
+	result := make(map[string]string)
 	if input == "" {
 		return result
 	}
 
 	pairs := strings.Split(input, ",")
 	for _, pair := range pairs {
-		kv := strings.Split(strings.TrimSpace(pair), ":")
-		if len(kv) == 2 {
-			if limit, err := strconv.Atoi(strings.TrimSpace(kv[1])); err == nil {
-				result[strings.TrimSpace(kv[0])] = limit
-			}
+		pair = strings.TrimSpace(pair)
+		idx := strings.LastIndex(pair, ":")
+		if idx <= 0 || idx == len(pair)-1 {
+			continue
+		}
+		result[strings.TrimSpace(pair[:idx])] = strings.TrimSpace(pair[idx+1:])
+	}
+	return result
+}
+
+// loadIPList combina las entradas de la variable env (separadas por coma) con las del archivo
+func loadIPList(env, file string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range parseList(getEnv(env, "")) {
+		prefix, err := ratelimit.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", env, err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	if file != "" {
+		fromFile, err := ratelimit.LoadIPListFile(file)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, fromFile...)
+	}
+	return prefixes, nil
+}
+
+// parseList parsea strings como "a,b,c" ignorando elementos vacíos
+func parseList(input string) []string {
+	var result []string
+	for _, item := range strings.Split(input, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
 		}
 	}
 	return result
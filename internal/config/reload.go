@@ -0,0 +1,153 @@
+package config
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/andress1014/meli-proxy/internal/metrics"
+	"github.com/andress1014/meli-proxy/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
+// RulesReloader vuelve a cargar el archivo de reglas cuando cambia su contenido
+// (revisándolo cada interval) o al recibir SIGHUP, y entrega las reglas nuevas a apply.
+// Un cambio en disco se aplica cuando el contenido se mantiene estable dos ticks.
+// Si el archivo nuevo es inválido se mantienen las reglas anteriores.
+type RulesReloader struct {
+	file     string
+	interval time.Duration
+	apply    func([]ratelimit.Rule)
+	logger   *zap.Logger
+
+	mu      sync.Mutex
+	hash    [sha256.Size]byte
+	pending [sha256.Size]byte // contenido nuevo visto en el tick anterior
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewRulesReloader crea un reloader para file. Con interval <= 0 solo se recarga con SIGHUP.
+func NewRulesReloader(file string, interval time.Duration, apply func([]ratelimit.Rule), logger *zap.Logger) *RulesReloader {
+	rr := &RulesReloader{
+		file:     file,
+		interval: interval,
+		apply:    apply,
+		logger:   logger,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	// Las reglas actuales ya las cargó Load; solo se recuerda el contenido
+	if data, err := os.ReadFile(file); err == nil {
+		rr.hash = sha256.Sum256(data)
+	}
+
+	return rr
+}
+
+// Start comienza a observar el archivo y SIGHUP en background
+func (rr *RulesReloader) Start() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	if rr.interval > 0 {
+		ticker = time.NewTicker(rr.interval)
+		tick = ticker.C
+	}
+
+	go func() {
+		defer close(rr.done)
+		defer signal.Stop(hup)
+		if ticker != nil {
+			defer ticker.Stop()
+		}
+
+		for {
+			select {
+			case <-rr.stop:
+				return
+			case <-hup:
+				rr.logger.Info("SIGHUP received, reloading rate limit rules", zap.String("file", rr.file))
+				rr.Reload()
+			case <-tick:
+				rr.reloadIfChanged()
+			}
+		}
+	}()
+}
+
+// Stop detiene el reloader
+func (rr *RulesReloader) Stop() {
+	rr.closeOnce.Do(func() {
+		close(rr.stop)
+		<-rr.done
+	})
+}
+
+// Reload fuerza la recarga del archivo aunque no haya cambiado
+func (rr *RulesReloader) Reload() error {
+	data, err := os.ReadFile(rr.file)
+	if err != nil {
+		return rr.fail(fmt.Errorf("failed to read rules file: %w", err))
+	}
+	return rr.load(data)
+}
+
+func (rr *RulesReloader) reloadIfChanged() {
+	data, err := os.ReadFile(rr.file)
+	if err != nil {
+		// Puede estar siendo reemplazado; se reintenta en el próximo tick
+		rr.logger.Debug("rules file not readable", zap.String("file", rr.file), zap.Error(err))
+		return
+	}
+
+	// Solo se recarga cuando el contenido nuevo se mantiene igual en dos ticks
+	// seguidos, para no leer un archivo a medio escribir
+	hash := sha256.Sum256(data)
+	rr.mu.Lock()
+	changed := hash != rr.hash
+	stable := hash == rr.pending
+	rr.pending = hash
+	rr.mu.Unlock()
+	if !changed || !stable {
+		return
+	}
+
+	rr.load(data)
+}
+
+func (rr *RulesReloader) load(data []byte) error {
+	// Se recuerda el contenido aunque sea inválido para no loguear el mismo error en cada tick
+	rr.mu.Lock()
+	rr.hash = sha256.Sum256(data)
+	rr.mu.Unlock()
+
+	rules, err := ratelimit.ParseRules(rr.file, data)
+	if err != nil {
+		return rr.fail(err)
+	}
+
+	rr.apply(rules)
+	metrics.RecordConfigReload(true)
+	rr.logger.Info("rate limit rules reloaded",
+		zap.String("file", rr.file),
+		zap.Int("rules", len(rules)))
+	return nil
+}
+
+func (rr *RulesReloader) fail(err error) error {
+	metrics.RecordConfigReload(false)
+	rr.logger.Error("rate limit rules reload failed, keeping previous rules",
+		zap.String("file", rr.file),
+		zap.Error(err))
+	return err
+}
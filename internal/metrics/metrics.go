@@ -54,6 +54,111 @@ var (
 		},
 		[]string{"path"},
 	)
+
+	// Eventos de failover de Redis Sentinel
+	redisFailoverEvents = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "meli_proxy_redis_failover_events_total",
+			Help: "Total number of Redis Sentinel failover events by type",
+		},
+		[]string{"master", "event"},
+	)
+
+	// 1 mientras hay un failover en curso
+	redisFailoverInProgress = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "meli_proxy_redis_failover_in_progress",
+			Help: "Whether a Redis Sentinel failover is in progress (1) or not (0)",
+		},
+		[]string{"master"},
+	)
+
+	// Requests permitidos sin verificar límites porque el backend no respondía
+	rateLimitFailOpen = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "meli_proxy_rate_limit_fail_open_total",
+			Help: "Total number of rate limit checks that failed open",
+		},
+		[]string{"reason"},
+	)
+
+	// Errores del backend del limiter según la política aplicada
+	rateLimitBackendErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "meli_proxy_rate_limit_backend_errors_total",
+			Help: "Total number of rate limit backend errors by applied fail policy",
+		},
+		[]string{"policy"},
+	)
+
+	// Estado del circuit breaker del limiter (0 = cerrado, 1 = abierto)
+	rateLimitBreakerState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "meli_proxy_rate_limit_breaker_state",
+			Help: "Rate limiter circuit breaker state (0 = closed, 1 = open)",
+		},
+		[]string{"limiter"},
+	)
+
+	// Recargas de configuración en caliente
+	configReloads = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "meli_proxy_config_reloads_total",
+			Help: "Total number of rate limit configuration reloads by result",
+		},
+		[]string{"result"},
+	)
+
+	// 1 si la última recarga fue exitosa, 0 si falló
+	configLastReloadSuccess = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "meli_proxy_config_last_reload_successful",
+			Help: "Whether the last rate limit configuration reload succeeded",
+		},
+	)
+
+	// Requests rechazados por la denylist de IPs
+	ipDenied = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "meli_proxy_ip_denied_total",
+			Help: "Total number of requests rejected by the IP denylist",
+		},
+	)
+
+	// Requests de la allowlist que no pasan por el rate limiter
+	ipAllowlisted = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "meli_proxy_ip_allowlisted_total",
+			Help: "Total number of requests exempted from rate limiting by the IP allowlist",
+		},
+	)
+
+	// Cantidad de entradas (IP o CIDR) de cada lista
+	ipListEntries = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "meli_proxy_ip_list_entries",
+			Help: "Number of IP/CIDR entries in each access list",
+		},
+		[]string{"list"},
+	)
+
+	// Requests rechazados con 401 por el middleware JWT, por motivo
+	jwtRejected = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "meli_proxy_jwt_rejected_total",
+			Help: "Total number of requests rejected by JWT validation",
+		},
+		[]string{"reason"},
+	)
+
+	// Recargas del JWKS remoto
+	jwksRefreshes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "meli_proxy_jwks_refreshes_total",
+			Help: "Total number of JWKS refreshes",
+		},
+		[]string{"result"},
+	)
 )
 
 func init() {
@@ -63,6 +168,18 @@ func init() {
 	prometheus.MustRegister(requestDuration)
 	prometheus.MustRegister(requestsInProgress)
 	prometheus.MustRegister(requestsPerSecond)
+	prometheus.MustRegister(redisFailoverEvents)
+	prometheus.MustRegister(redisFailoverInProgress)
+	prometheus.MustRegister(rateLimitFailOpen)
+	prometheus.MustRegister(rateLimitBackendErrors)
+	prometheus.MustRegister(rateLimitBreakerState)
+	prometheus.MustRegister(configReloads)
+	prometheus.MustRegister(configLastReloadSuccess)
+	prometheus.MustRegister(ipDenied)
+	prometheus.MustRegister(ipAllowlisted)
+	prometheus.MustRegister(ipListEntries)
+	prometheus.MustRegister(jwtRejected)
+	prometheus.MustRegister(jwksRefreshes)
 }
 
 type Server struct {
@@ -122,3 +239,56 @@ func DecRequestsInProgress(method, path string) {
 func UpdateRequestsPerSecond(path string, rps float64) {
 	requestsPerSecond.WithLabelValues(path).Set(rps)
 }
+
+func RecordRedisFailoverEvent(master, event string) {
+	redisFailoverEvents.WithLabelValues(master, event).Inc()
+}
+
+func SetRedisFailoverInProgress(master string, inProgress bool) {
+	redisFailoverInProgress.WithLabelValues(master).Set(float64(boolToInt(inProgress)))
+}
+
+func RecordRateLimitFailOpen(reason string) {
+	rateLimitFailOpen.WithLabelValues(reason).Inc()
+}
+
+func RecordRateLimitBackendError(policy string) {
+	rateLimitBackendErrors.WithLabelValues(policy).Inc()
+}
+
+func SetRateLimitBreakerState(limiter string, state int32) {
+	rateLimitBreakerState.WithLabelValues(limiter).Set(float64(state))
+}
+
+func RecordConfigReload(success bool) {
+	result := "failure"
+	if success {
+		result = "success"
+	}
+	configReloads.WithLabelValues(result).Inc()
+	configLastReloadSuccess.Set(float64(boolToInt(success)))
+}
+
+func RecordIPDenied() {
+	ipDenied.Inc()
+}
+
+func RecordIPAllowlisted() {
+	ipAllowlisted.Inc()
+}
+
+func SetIPListEntries(list string, entries int) {
+	ipListEntries.WithLabelValues(list).Set(float64(entries))
+}
+
+func RecordJWTRejected(reason string) {
+	jwtRejected.WithLabelValues(reason).Inc()
+}
+
+func RecordJWKSRefresh(success bool) {
+	result := "failure"
+	if success {
+		result = "success"
+	}
+	jwksRefreshes.WithLabelValues(result).Inc()
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+
+	"github.com/andress1014/meli-proxy/internal/config"
+	"github.com/andress1014/meli-proxy/internal/metrics"
+	"github.com/andress1014/meli-proxy/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
+type contextKey int
+
+// rateLimitExemptKey marca en el contexto los requests que no pasan por el rate limiter
+const rateLimitExemptKey contextKey = iota
+
+// Acción de una entrada de las listas de acceso
+type accessAction int
+
+const (
+	accessAllow accessAction = iota
+	accessDeny
+)
+
+// AccessListMiddleware aplica la allowlist y la denylist de IPs antes del rate limiting.
+// Las IPs de la denylist reciben 403 y las de la allowlist no consumen cupo.
+// Si una IP está en ambas gana el prefijo más específico, y a igual prefijo la denylist.
+type AccessListMiddleware struct {
+	list   *ratelimit.IPTrie[accessAction]
+	logger *zap.Logger
+}
+
+func NewAccessListMiddleware(cfg *config.Config, logger *zap.Logger) *AccessListMiddleware {
+	list := ratelimit.NewIPTrie[accessAction]()
+	for _, prefix := range cfg.IPAllowList {
+		list.InsertPrefix(prefix, accessAllow)
+	}
+	// La denylist se inserta después para que reemplace prefijos repetidos
+	for _, prefix := range cfg.IPDenyList {
+		list.InsertPrefix(prefix, accessDeny)
+	}
+
+	metrics.SetIPListEntries("allow", len(cfg.IPAllowList))
+	metrics.SetIPListEntries("deny", len(cfg.IPDenyList))
+	if list.Len() > 0 {
+		logger.Info("IP access lists loaded",
+			zap.Int("allow", len(cfg.IPAllowList)),
+			zap.Int("deny", len(cfg.IPDenyList)))
+	}
+
+	return &AccessListMiddleware{list: list, logger: logger}
+}
+
+func (m *AccessListMiddleware) Handler(next http.Handler) http.Handler {
+	// Sin listas no hay nada que evaluar
+	if m.list.Len() == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := ratelimit.ExtractIP(r)
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		action, found := m.list.LookupAddr(addr)
+		if !found {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if action == accessDeny {
+			metrics.RecordIPDenied()
+			// Debug para no inundar los logs con tráfico bloqueado; el contador ya lo refleja
+			m.logger.Debug("request denied by IP denylist",
+				zap.String("ip", ip),
+				zap.String("path", r.URL.Path))
+			writeForbiddenResponse(w)
+			return
+		}
+
+		metrics.RecordIPAllowlisted()
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), rateLimitExemptKey, true)))
+	})
+}
+
+// rateLimitExempt indica si el request viene de una IP de la allowlist
+func rateLimitExempt(r *http.Request) bool {
+	exempt, _ := r.Context().Value(rateLimitExemptKey).(bool)
+	return exempt
+}
+
+func writeForbiddenResponse(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+
+	response := `{"error":"forbidden","message":"Access denied"}`
+	w.Write([]byte(response))
+}
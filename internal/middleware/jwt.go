@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/andress1014/meli-proxy/internal/auth"
+	"github.com/andress1014/meli-proxy/internal/config"
+	"github.com/andress1014/meli-proxy/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// Timeout de las descargas del JWKS remoto
+const jwksTimeout = 5 * time.Second
+
+// JWTMiddleware valida el bearer token antes de reenviar el request. Los tokens
+// inválidos reciben 401; los válidos siguen con sus claims en el contexto, donde
+// el rate limiter lee el claim del tier (JWT_TIER_CLAIM).
+type JWTMiddleware struct {
+	verifier *auth.Verifier
+	required bool
+	logger   *zap.Logger
+}
+
+// NewJWTMiddleware arma el verificador con las claves configuradas. Si la
+// validación está deshabilitada, Handler no hace nada.
+func NewJWTMiddleware(cfg *config.Config, logger *zap.Logger) (*JWTMiddleware, error) {
+	m := &JWTMiddleware{required: cfg.JWTRequired, logger: logger}
+	if !cfg.JWTEnabled {
+		return m, nil
+	}
+
+	verifierConfig := auth.VerifierConfig{
+		Secret:   []byte(cfg.JWTSecret),
+		Issuer:   cfg.JWTIssuer,
+		Audience: cfg.JWTAudience,
+		Leeway:   cfg.JWTLeeway,
+	}
+	switch {
+	case cfg.JWTJWKSFile != "":
+		keys, err := auth.LoadKeySetFile(cfg.JWTJWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		verifierConfig.Keys = keys
+	case cfg.JWTJWKSURL != "":
+		keys := auth.NewRemoteKeySet(cfg.JWTJWKSURL, cfg.JWTJWKSCacheTTL, &http.Client{Timeout: jwksTimeout}, logger)
+		// Si el proveedor no responde al iniciar se reintenta con el primer token
+		ctx, cancel := context.WithTimeout(context.Background(), jwksTimeout)
+		defer cancel()
+		if err := keys.Refresh(ctx); err != nil {
+			logger.Warn("JWKS not available at startup", zap.String("url", cfg.JWTJWKSURL), zap.Error(err))
+		}
+		verifierConfig.Keys = keys
+	}
+
+	m.verifier = auth.NewVerifier(verifierConfig)
+	logger.Info("JWT validation enabled",
+		zap.Bool("hs256", cfg.JWTSecret != ""),
+		zap.Bool("rs256", verifierConfig.Keys != nil),
+		zap.Bool("required", cfg.JWTRequired),
+		zap.String("tier_claim", cfg.JWTTierClaim))
+	return m, nil
+}
+
+func (m *JWTMiddleware) Handler(next http.Handler) http.Handler {
+	if m.verifier == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := auth.BearerToken(r)
+		if token == "" {
+			if !m.required {
+				// Sin token el request sigue como anónimo (límite por IP)
+				next.ServeHTTP(w, r)
+				return
+			}
+			m.writeUnauthorized(w, auth.ErrMissingToken)
+			return
+		}
+
+		claims, err := m.verifier.Verify(r.Context(), token)
+		if err != nil {
+			m.logger.Debug("invalid JWT",
+				zap.Error(err),
+				zap.String("path", r.URL.Path))
+			m.writeUnauthorized(w, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithClaims(r.Context(), claims)))
+	})
+}
+
+// writeUnauthorized responde 401 con el mismo formato JSON que el 429
+func (m *JWTMiddleware) writeUnauthorized(w http.ResponseWriter, err error) {
+	reason := rejectReason(err)
+	metrics.RecordJWTRejected(reason)
+
+	challenge := `Bearer error="invalid_token"`
+	if errors.Is(err, auth.ErrMissingToken) {
+		challenge = "Bearer"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("WWW-Authenticate", challenge)
+	w.WriteHeader(http.StatusUnauthorized)
+
+	response := fmt.Sprintf(`{"error":"%s","message":"%s"}`, reason, unauthorizedMessages[reason])
+	w.Write([]byte(response))
+}
+
+// Mensajes de los 401 por motivo; no incluyen datos del token
+var unauthorizedMessages = map[string]string{
+	"missing_token": "Bearer token required",
+	"token_expired": "Token expired",
+	"invalid_token": "Invalid token",
+}
+
+// rejectReason es el código de error del 401 y el label de la métrica
+func rejectReason(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrMissingToken):
+		return "missing_token"
+	case errors.Is(err, auth.ErrTokenExpired):
+		return "token_expired"
+	}
+	return "invalid_token"
+}
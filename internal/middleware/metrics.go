@@ -41,7 +41,7 @@ func (m *MetricsMiddleware) Handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		path := ratelimit.NormalizePath(r.URL.Path)
-		method := r.Method
+		method := ratelimit.KeyMethod(r.Method)
 
 		// Incrementar requests en progreso
 		metrics.IncRequestsInProgress(method, path)
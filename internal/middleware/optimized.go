@@ -2,11 +2,8 @@ package middleware
 
 import (
 	"context"
-	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
-	"sync"
 	"time"
 
 	"go.uber.org/zap"
@@ -15,37 +12,24 @@ import (
 	"github.com/andress1014/meli-proxy/internal/ratelimit"
 )
 
-// OptimizedMiddleware para alta carga - 50K RPS
+// OptimizedMiddleware para alta carga - 50K RPS.
+//
+// Deprecated: hace fail open ante cualquier error del limiter sin respetar
+// RATE_LIMIT_FAIL_POLICY y el proxy no lo usa. Usar RateLimitMiddleware.
 type OptimizedMiddleware struct {
 	rateLimiter    *ratelimit.OptimizedRedisLimiter
 	asyncCollector *metrics.AsyncCollector
 	logger         *zap.Logger
-	// Pre-allocated pools para reducir allocations
-	pathPool        sync.Pool
-	clientIPPool    sync.Pool
-	combinedKeyPool sync.Pool
 }
 
+// NewOptimizedMiddleware crea un OptimizedMiddleware.
+//
+// Deprecated: ver OptimizedMiddleware.
 func NewOptimizedMiddleware(rateLimiter *ratelimit.OptimizedRedisLimiter, asyncCollector *metrics.AsyncCollector, logger *zap.Logger) *OptimizedMiddleware {
 	return &OptimizedMiddleware{
 		rateLimiter:    rateLimiter,
 		asyncCollector: asyncCollector,
 		logger:         logger,
-		pathPool: sync.Pool{
-			New: func() interface{} {
-				return make([]byte, 0, 256) // Pre-allocate para paths
-			},
-		},
-		clientIPPool: sync.Pool{
-			New: func() interface{} {
-				return make([]byte, 0, 16) // Pre-allocate para IPs
-			},
-		},
-		combinedKeyPool: sync.Pool{
-			New: func() interface{} {
-				return make([]byte, 0, 512) // Pre-allocate para keys combinadas
-			},
-		},
 	}
 }
 
@@ -53,14 +37,12 @@ func (om *OptimizedMiddleware) Handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		startTime := time.Now()
 
-		// Extraer IP optimizado (sin allocations innecesarias)
-		clientIP := om.extractClientIPOptimized(r)
-
-		// Normalizar path optimizado
-		normalizedPath := om.normalizePathOptimized(r.URL.Path)
+		// IP y path con la misma derivación que RateLimitMiddleware (sin allocations)
+		keys := ratelimit.DeriveKeys(r)
+		clientIP, normalizedPath := keys.IP, keys.Path
 
 		// Verificar rate limits en paralelo (no secuencial)
-		allowed, remaining, err := om.checkRateLimitsOptimized(r.Context(), clientIP, normalizedPath)
+		allowed, remaining, err := om.checkRateLimitsOptimized(r.Context(), keys)
 		if err != nil {
 			om.logger.Error("rate limit check failed",
 				zap.String("error", err.Error()),
@@ -77,7 +59,7 @@ func (om *OptimizedMiddleware) Handler(next http.Handler) http.Handler {
 
 			// Record 429 async
 			duration := time.Since(startTime)
-			om.asyncCollector.RecordRequestAsync(r.Method, normalizedPath, 429, duration)
+			om.asyncCollector.RecordRequestAsync(ratelimit.KeyMethod(r.Method), normalizedPath, 429, duration)
 			return
 		}
 
@@ -89,7 +71,7 @@ func (om *OptimizedMiddleware) Handler(next http.Handler) http.Handler {
 
 		// Record metrics async (no blocking)
 		duration := time.Since(startTime)
-		om.asyncCollector.RecordRequestAsync(r.Method, normalizedPath, wrapper.statusCode, duration)
+		om.asyncCollector.RecordRequestAsync(ratelimit.KeyMethod(r.Method), normalizedPath, wrapper.statusCode, duration)
 
 		// Record successful rate limit async
 		if allowed {
@@ -98,65 +80,10 @@ func (om *OptimizedMiddleware) Handler(next http.Handler) http.Handler {
 	})
 }
 
-// extractClientIPOptimized - Optimizado para alta carga
-func (om *OptimizedMiddleware) extractClientIPOptimized(r *http.Request) string {
-	// Usar buffer pool para reducir allocations
-	buffer := om.clientIPPool.Get().([]byte)
-	defer om.clientIPPool.Put(buffer[:0])
-
-	// Prioridad: X-Forwarded-For, X-Real-IP, RemoteAddr
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		if idx := strings.Index(xff, ","); idx > 0 {
-			return strings.TrimSpace(xff[:idx])
-		}
-		return strings.TrimSpace(xff)
-	}
-
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
-	}
-
-	// Extract IP from RemoteAddr (formato "IP:port")
-	if colonIdx := strings.LastIndex(r.RemoteAddr, ":"); colonIdx > 0 {
-		return r.RemoteAddr[:colonIdx]
-	}
-
-	return r.RemoteAddr
-}
-
-// normalizePathOptimized - Sin regex para alta performance
-func (om *OptimizedMiddleware) normalizePathOptimized(path string) string {
-	// Pool buffer para reducir allocations
-	buffer := om.pathPool.Get().([]byte)
-	defer om.pathPool.Put(buffer[:0])
-
-	// Normalización simple y rápida
-	if len(path) == 0 || path == "/" {
-		return "/"
-	}
-
-	// Convertir a lowercase in-place
-	normalizedPath := strings.ToLower(path)
-
-	// Remover trailing slash (excepto root)
-	if len(normalizedPath) > 1 && normalizedPath[len(normalizedPath)-1] == '/' {
-		normalizedPath = normalizedPath[:len(normalizedPath)-1]
-	}
-
-	return normalizedPath
-}
-
 // checkRateLimitsOptimized - Verificación optimizada con cache local
-func (om *OptimizedMiddleware) checkRateLimitsOptimized(ctx context.Context, clientIP, path string) (bool, int, error) {
-	// Usar pool para key combinada
-	keyBuffer := om.combinedKeyPool.Get().([]byte)
-	defer om.combinedKeyPool.Put(keyBuffer[:0])
-
-	// Build combined key efficiently
-	combinedKey := fmt.Sprintf("%s:%s", clientIP, path)
-
-	// Usar cache local optimizado
-	result, err := om.rateLimiter.CheckLimitOptimized(ctx, combinedKey, 100, time.Minute)
+func (om *OptimizedMiddleware) checkRateLimitsOptimized(ctx context.Context, keys ratelimit.RequestKeys) (bool, int, error) {
+	// Usar cache local optimizado con la misma key ip_path que RateLimitMiddleware
+	result, err := om.rateLimiter.CheckLimitOptimized(ctx, keys.IPPathKey(), 100, time.Minute)
 	if err != nil {
 		return false, 0, err
 	}
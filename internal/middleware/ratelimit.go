@@ -2,10 +2,16 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"net/netip"
+	"sort"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/andress1014/meli-proxy/internal/auth"
 	"github.com/andress1014/meli-proxy/internal/config"
 	"github.com/andress1014/meli-proxy/internal/metrics"
 	"github.com/andress1014/meli-proxy/internal/ratelimit"
@@ -13,130 +19,621 @@ import (
 )
 
 type RateLimitMiddleware struct {
-	limiter ratelimit.Limiter
-	config  *config.Config
-	logger  *zap.Logger
+	limiter          ratelimit.Limiter
+	config           *config.Config
+	logger           *zap.Logger
+	defaultAlgorithm ratelimit.Algorithm
+	pathAlgorithms   map[string]ratelimit.Algorithm
+	headerMode       ratelimit.HeaderMode
+
+	// Política ante errores del limiter y limiter local para FailLocal
+	failPolicy       ratelimit.FailPolicy
+	pathFailPolicies map[string]ratelimit.FailPolicy
+	fallback         *ratelimit.MemoryLimiter
+	ownsFallback     bool
+
+	// Límites de IP_RATE_LIMITS e IP_PATH_RATE_LIMITS por IP o CIDR (longest prefix match);
+	// los de ip_path se indexan por path normalizado
+	ipLimits     *ratelimit.IPTrie[int]
+	ipPathLimits map[string]*ratelimit.IPTrie[int]
+
+	// Reglas del archivo y overrides de Redis, indexadas por scope; se reemplazan
+	// atómicamente en cada recarga
+	rules     atomic.Pointer[ratelimit.RuleSet]
+	overrides atomic.Pointer[ratelimit.RuleSet]
 }
 
 func NewRateLimitMiddleware(limiter ratelimit.Limiter, cfg *config.Config, logger *zap.Logger) *RateLimitMiddleware {
-	return &RateLimitMiddleware{
-		limiter: limiter,
-		config:  cfg,
-		logger:  logger,
+	m := &RateLimitMiddleware{
+		limiter:          limiter,
+		config:           cfg,
+		logger:           logger,
+		defaultAlgorithm: ratelimit.AlgorithmSlidingWindow,
+		pathAlgorithms:   make(map[string]ratelimit.Algorithm),
+		headerMode:       ratelimit.HeadersLegacy,
+		failPolicy:       ratelimit.FailOpen,
+		pathFailPolicies: make(map[string]ratelimit.FailPolicy),
+		ipLimits:         ratelimit.NewIPTrie[int](),
+		ipPathLimits:     make(map[string]*ratelimit.IPTrie[int]),
+	}
+	m.SetRules(cfg.Rules)
+
+	for cidr, limit := range cfg.IPRateLimit {
+		if err := m.ipLimits.Insert(cidr, limit); err != nil {
+			logger.Warn("invalid IP rate limit", zap.String("ip", cidr), zap.Error(err))
+		}
+	}
+	for key, limit := range cfg.IPPathRateLimit {
+		// Formato ip::path; la IP puede ser IPv6 así que se corta en el último "::/"
+		idx := strings.LastIndex(key, "::/")
+		if idx < 0 {
+			logger.Warn("invalid IP+path rate limit, expected ip::path", zap.String("key", key))
+			continue
+		}
+		cidr, path := key[:idx], key[idx+2:]
+		trie, exists := m.ipPathLimits[path]
+		if !exists {
+			trie = ratelimit.NewIPTrie[int]()
+			m.ipPathLimits[path] = trie
+		}
+		if err := trie.Insert(cidr, limit); err != nil {
+			logger.Warn("invalid IP+path rate limit", zap.String("key", key), zap.Error(err))
+		}
 	}
+	m.SetOverrides(nil)
+
+	// Resolver algoritmos una sola vez; valores inválidos caen al default
+	if algorithm, err := ratelimit.ParseAlgorithm(cfg.DefaultAlgorithm); err == nil {
+		m.defaultAlgorithm = algorithm
+	} else {
+		logger.Warn("invalid default rate limit algorithm", zap.Error(err))
+	}
+	for path, name := range cfg.PathAlgorithms {
+		algorithm, err := ratelimit.ParseAlgorithm(name)
+		if err != nil {
+			logger.Warn("invalid rate limit algorithm for path", zap.String("path", path), zap.Error(err))
+			continue
+		}
+		m.pathAlgorithms[path] = algorithm
+	}
+
+	if mode, err := ratelimit.ParseHeaderMode(cfg.RateLimitHeaders); err == nil {
+		m.headerMode = mode
+	} else {
+		logger.Warn("invalid rate limit header mode", zap.Error(err))
+	}
+
+	if policy, err := ratelimit.ParseFailPolicy(cfg.FailPolicy); err == nil {
+		m.failPolicy = policy
+	} else {
+		logger.Warn("invalid default rate limit fail policy", zap.Error(err))
+	}
+	needsFallback := m.failPolicy == ratelimit.FailLocal
+	for path, name := range cfg.PathFailPolicies {
+		policy, err := ratelimit.ParseFailPolicy(name)
+		if err != nil {
+			logger.Warn("invalid rate limit fail policy for path", zap.String("path", path), zap.Error(err))
+			continue
+		}
+		m.pathFailPolicies[path] = policy
+		if policy == ratelimit.FailLocal {
+			needsFallback = true
+		}
+	}
+
+	// El limiter local solo se crea si alguna regla lo usa
+	if needsFallback {
+		m.fallback = ratelimit.NewMemoryLimiter(0)
+		m.ownsFallback = true
+	}
+
+	return m
+}
+
+// SetFallback reemplaza el limiter local propio por uno compartido (el del
+// circuit breaker), para que una instancia lleve un solo contador local. El
+// compartido lo cierra quien lo creó. Se llama antes de servir requests.
+func (m *RateLimitMiddleware) SetFallback(fallback *ratelimit.MemoryLimiter) {
+	if m.ownsFallback {
+		m.fallback.Close()
+	}
+	m.fallback, m.ownsFallback = fallback, false
+}
+
+// Close libera el limiter local de fallback, si es propio
+func (m *RateLimitMiddleware) Close() error {
+	if !m.ownsFallback {
+		return nil
+	}
+	return m.fallback.Close()
 }
 
 func (m *RateLimitMiddleware) Handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Las IPs de la allowlist no tienen límite
+		if rateLimitExempt(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
 		defer cancel()
 
 		// Obtener keys para rate limiting
-		keys := ratelimit.GetLimitKeys(r)
-		ip := ratelimit.ExtractIP(r)
-		path := ratelimit.NormalizePath(r.URL.Path)
+		derived := ratelimit.DeriveKeys(r)
+		keys := derived.LimitKeys()
+		ip, path := derived.IP, derived.Path
 
 		// Configurar límites
-		limits := m.buildLimitConfigs(keys, ip, path)
+		limits := m.buildLimitConfigs(r, keys, derived)
 
 		// Verificar límites
 		results, err := m.limiter.CheckMultipleLimits(ctx, limits)
+		if errors.Is(err, ratelimit.ErrBreakerOpen) {
+			// El breaker ya verificó con el limiter local; los paths fail-closed
+			// siguen rechazando mientras el principal no responde
+			if m.failPolicyFor(path) == ratelimit.FailClosed {
+				metrics.RecordRateLimitBackendError(string(ratelimit.FailClosed))
+				m.writeUnavailableResponse(w)
+				return
+			}
+			err = nil
+		}
 		if err != nil {
+			policy := m.failPolicyFor(path)
 			m.logger.Error("rate limit check failed",
 				zap.Error(err),
 				zap.String("ip", ip),
-				zap.String("path", path))
-			// En caso de error, permitir el request (fail open)
-			next.ServeHTTP(w, r)
-			return
+				zap.String("path", path),
+				zap.String("fail_policy", string(policy)))
+			metrics.RecordRateLimitBackendError(string(policy))
+
+			switch policy {
+			case ratelimit.FailClosed:
+				m.writeUnavailableResponse(w)
+				return
+			case ratelimit.FailLocal:
+				results, err = m.checkLocal(ctx, limits)
+				if err != nil {
+					m.logger.Error("local rate limit check failed", zap.Error(err))
+					next.ServeHTTP(w, r)
+					return
+				}
+			default:
+				// Fail open: permitir el request
+				reason := "backend_error"
+				if errors.Is(err, ratelimit.ErrFailover) {
+					reason = "sentinel_failover"
+				}
+				metrics.RecordRateLimitFailOpen(reason)
+				next.ServeHTTP(w, r)
+				return
+			}
 		}
 
 		// Verificar si algún límite fue excedido
-		for limitType, result := range results {
-			if !result.Allowed {
-				// Registrar métrica de bloqueo
-				metrics.RecordRateLimitBlocked(limitType, keys[limitType])
-
-				// Log del bloqueo
-				m.logger.Warn("rate limit exceeded",
-					zap.String("limit_type", limitType),
-					zap.String("key", keys[limitType]),
-					zap.String("ip", ip),
-					zap.String("path", path))
-
-				// Responder con 429
-				m.writeRateLimitResponse(w, result)
-				return
+		var blocked *ratelimit.LimitResult
+		var blockedType string
+		for limitType, key := range keys {
+			result, ok := results[key]
+			if !ok || result.Allowed {
+				continue
+			}
+
+			// Registrar métrica de bloqueo
+			metrics.RecordRateLimitBlocked(limitType, key)
+
+			// Log del bloqueo
+			m.logger.Warn("rate limit exceeded",
+				zap.String("limit_type", limitType),
+				zap.String("key", key),
+				zap.String("ip", ip),
+				zap.String("path", path))
+
+			// Con varios límites excedidos el cliente debe esperar al más lento
+			if blocked == nil || retryAfterSeconds(result) > retryAfterSeconds(blocked) {
+				blocked, blockedType = result, limitType
 			}
 		}
 
+		if blocked != nil {
+			// Responder con 429
+			m.writeRateLimitResponse(w, keys, limits, results, blockedType)
+			return
+		}
+
 		// Agregar headers informativos
-		m.addRateLimitHeaders(w, results)
+		m.addRateLimitHeaders(w, keys, limits, results)
 
 		// Continuar con el próximo handler
 		next.ServeHTTP(w, r)
 	})
 }
 
-func (m *RateLimitMiddleware) buildLimitConfigs(keys map[string]string, ip, path string) map[string]ratelimit.LimitConfig {
-	window := 60 * time.Second // 1 minuto por defecto
+// buildLimitConfigs arma los límites indexados por la key de Redis (ip::, path::, ip_path::).
+// Los overrides de Redis y las reglas del archivo tienen prioridad; si ninguna coincide
+// se usan el tier de la identidad, los mapas de env y DefaultLimit, todos con
+// DefaultWindow. Si el scope lleva el método (ver methodKey) también se actualiza su
+// key en keys. Las ventanas apiladas de una regla se agregan a keys como ip:1s, y las
+// cuotas diarias y mensuales del cliente como quota_day y quota_month.
+func (m *RateLimitMiddleware) buildLimitConfigs(r *http.Request, keys map[string]string, derived ratelimit.RequestKeys) map[string]ratelimit.LimitConfig {
+	ip, path := derived.IP, derived.Path
+	tier := m.tierFor(r, derived)
+	window := m.defaultWindow()
 	limits := make(map[string]ratelimit.LimitConfig)
 
+	// El algoritmo del path aplica a los límites path e ip_path
+	pathAlgorithm := m.defaultAlgorithm
+	if algorithm, exists := m.pathAlgorithms[path]; exists {
+		pathAlgorithm = algorithm
+	}
+
+	// IP parseada una sola vez para las búsquedas por CIDR
+	addr, _ := netip.ParseAddr(ip)
+
 	// Límite por IP
-	ipLimit := m.config.DefaultRPS
-	if customLimit, exists := m.config.IPRateLimit[ip]; exists {
-		ipLimit = customLimit
+	if rule := m.matchRule(ratelimit.ScopeIP, r, ip, path); rule != nil {
+		m.addRuleLimits(limits, keys, ratelimit.ScopeIP, rule, r.Method, m.defaultAlgorithm)
+	} else {
+		ipLimit := m.defaultLimit()
+		if derived.Identity != "" {
+			// Con credencial el límite es el del tier; los límites por IP no aplican
+			ipLimit = m.tierLimit(tier)
+		} else if customLimit, exists := m.ipLimits.LookupAddr(addr); exists {
+			ipLimit = customLimit
+		}
+		limits[m.methodKey(keys, ratelimit.ScopeIP, nil, r.Method)] = ratelimit.LimitConfig{Limit: ipLimit, Window: window, Algorithm: m.defaultAlgorithm}
 	}
-	limits["ip"] = ratelimit.LimitConfig{Limit: ipLimit, Window: window}
 
 	// Límite por Path
-	pathLimit := m.config.DefaultRPS
-	if customLimit, exists := m.config.PathRateLimit[path]; exists {
-		pathLimit = customLimit
+	if rule := m.matchRule(ratelimit.ScopePath, r, ip, path); rule != nil {
+		m.addRuleLimits(limits, keys, ratelimit.ScopePath, rule, r.Method, pathAlgorithm)
+	} else {
+		pathLimit := m.defaultLimit()
+		if customLimit, exists := m.config.PathRateLimit[path]; exists {
+			pathLimit = customLimit
+		}
+		limits[m.methodKey(keys, ratelimit.ScopePath, nil, r.Method)] = ratelimit.LimitConfig{
+			Limit:     pathLimit,
+			Window:    window,
+			Algorithm: pathAlgorithm,
+			Burst:     m.config.PathBursts[path],
+		}
 	}
-	limits["path"] = ratelimit.LimitConfig{Limit: pathLimit, Window: window}
 
 	// Límite por IP+Path
-	ipPathKey := ip + "::" + path
-	ipPathLimit := m.config.DefaultRPS / 2 // Más restrictivo
-	if customLimit, exists := m.config.IPPathRateLimit[ipPathKey]; exists {
-		ipPathLimit = customLimit
+	if rule := m.matchRule(ratelimit.ScopeIPPath, r, ip, path); rule != nil {
+		m.addRuleLimits(limits, keys, ratelimit.ScopeIPPath, rule, r.Method, pathAlgorithm)
+	} else {
+		ipPathLimit := m.defaultLimit() / 2 // Más restrictivo
+		if m.config.DefaultIPPathLimit > 0 {
+			ipPathLimit = m.config.DefaultIPPathLimit
+		}
+		if derived.Identity != "" {
+			ipPathLimit = m.tierLimit(tier) / 2
+		} else if trie, exists := m.ipPathLimits[path]; exists {
+			if customLimit, exists := trie.LookupAddr(addr); exists {
+				ipPathLimit = customLimit
+			}
+		}
+		limits[m.methodKey(keys, ratelimit.ScopeIPPath, nil, r.Method)] = ratelimit.LimitConfig{Limit: ipPathLimit, Window: window, Algorithm: pathAlgorithm}
+	}
+
+	// Cuotas de largo plazo del cliente, además de los límites por minuto
+	now := time.Now()
+	for _, period := range ratelimit.QuotaPeriods {
+		if quota := m.quotaFor(period, tier); quota > 0 {
+			key := derived.QuotaKey(period, now)
+			keys["quota_"+string(period)] = key
+			limits[key] = ratelimit.QuotaConfig(period, quota, now)
+		}
 	}
-	limits["ip_path"] = ratelimit.LimitConfig{Limit: ipPathLimit, Window: window}
 
 	return limits
 }
 
-func (m *RateLimitMiddleware) writeRateLimitResponse(w http.ResponseWriter, result *ratelimit.LimitResult) {
+// quotaFor devuelve la cuota del tier para el período, o la default (0 = sin cuota)
+func (m *RateLimitMiddleware) quotaFor(period ratelimit.QuotaPeriod, tier string) int {
+	quotas, quota := m.config.TierDailyQuotas, m.config.QuotaDaily
+	if period == ratelimit.QuotaMonthly {
+		quotas, quota = m.config.TierMonthlyQuotas, m.config.QuotaMonthly
+	}
+	if tierQuota, exists := quotas[tier]; exists {
+		return tierQuota
+	}
+	return quota
+}
+
+// tierFor devuelve el tier del claim JWT_TIER_CLAIM (ej: plan) del token verificado
+// si está definido en IDENTITY_TIERS; si no, el tier de la identidad. Con identidad
+// por IP el claim se ignora: el cupo es de la IP, no del token.
+func (m *RateLimitMiddleware) tierFor(r *http.Request, derived ratelimit.RequestKeys) string {
+	if derived.Identity == "" {
+		return derived.Tier
+	}
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok && m.config.JWTTierClaim != "" {
+		if tier := claims.String(m.config.JWTTierClaim); tier != "" {
+			if _, exists := m.config.IdentityTiers[tier]; exists {
+				return tier
+			}
+		}
+	}
+	return derived.Tier
+}
+
+// tierLimit devuelve el límite del tier de IDENTITY_TIERS, o el default si no existe
+func (m *RateLimitMiddleware) tierLimit(tier string) int {
+	if limit, exists := m.config.IdentityTiers[tier]; exists {
+		return limit
+	}
+	return m.defaultLimit()
+}
+
+// defaultLimit devuelve DefaultLimit, o DefaultRPS si la configuración no pasó por Load
+func (m *RateLimitMiddleware) defaultLimit() int {
+	if m.config.DefaultLimit > 0 {
+		return m.config.DefaultLimit
+	}
+	return m.config.DefaultRPS
+}
+
+// defaultWindow devuelve la ventana de los límites que no vienen de reglas (1m si no se define)
+func (m *RateLimitMiddleware) defaultWindow() time.Duration {
+	if m.config.DefaultWindow > 0 {
+		return m.config.DefaultWindow
+	}
+	return time.Minute
+}
+
+// addRuleLimits agrega el límite de la regla y uno por cada ventana apilada, con la
+// ventana en la key (ip:1s::<ip>) para que cada una tenga su propio contador
+func (m *RateLimitMiddleware) addRuleLimits(limits map[string]ratelimit.LimitConfig, keys map[string]string, scope string, rule *ratelimit.Rule, method string, algorithm ratelimit.Algorithm) {
+	key := m.methodKey(keys, scope, rule, method)
+	limits[key] = ruleLimitConfig(rule, algorithm)
+
+	for _, config := range rule.StackedConfigs() {
+		if config.Algorithm == "" {
+			config.Algorithm = algorithm
+		}
+		stackedKey := ratelimit.WindowKey(key, config.Window)
+		keys[scope+":"+ratelimit.FormatWindow(config.Window)] = stackedKey
+		limits[stackedKey] = config
+	}
+}
+
+// methodKey devuelve la key del scope. Lleva el método si la regla que aplica
+// filtra por método (su cupo no se comparte con los otros métodos) o si
+// RATE_LIMIT_KEY_BY_METHOD lo agrega a todas las keys; en ese caso los métodos
+// no estándar comparten la key OTHER (ver ratelimit.KeyMethod).
+func (m *RateLimitMiddleware) methodKey(keys map[string]string, scope string, rule *ratelimit.Rule, method string) string {
+	switch {
+	case rule != nil && rule.Match.Method != "":
+		keys[scope] = ratelimit.MethodKey(keys[scope], rule.Match.Method)
+	case m.config.KeyByMethod:
+		keys[scope] = ratelimit.MethodKey(keys[scope], ratelimit.KeyMethod(method))
+	}
+	return keys[scope]
+}
+
+// LimitConfigs devuelve las keys del request por tipo (ip, path, ip_path, ventanas
+// apiladas y cuotas) y la configuración que se les aplicaría, sin verificar ni consumir
+// cupo ni registrar el path en la detección de IDs
+func (m *RateLimitMiddleware) LimitConfigs(r *http.Request) (map[string]string, map[string]ratelimit.LimitConfig) {
+	return m.LimitConfigsFor(r, ratelimit.PreviewKeys(r))
+}
+
+// LimitConfigsFor es LimitConfigs con las keys ya derivadas, por ejemplo con la
+// identidad de un cliente consultado desde la API de administración
+func (m *RateLimitMiddleware) LimitConfigsFor(r *http.Request, derived ratelimit.RequestKeys) (map[string]string, map[string]ratelimit.LimitConfig) {
+	keys := derived.LimitKeys()
+	return keys, m.buildLimitConfigs(r, keys, derived)
+}
+
+// SetRules reemplaza las reglas activas. Los requests en curso terminan con las
+// reglas que ya leyeron; los siguientes usan las nuevas.
+func (m *RateLimitMiddleware) SetRules(rules []ratelimit.Rule) {
+	m.rules.Store(ratelimit.NewRuleSet(rules))
+}
+
+// Rules devuelve las reglas activas
+func (m *RateLimitMiddleware) Rules() []ratelimit.Rule {
+	return m.rules.Load().Rules()
+}
+
+// SetOverrides reemplaza los overrides compartidos (tienen prioridad sobre las reglas)
+func (m *RateLimitMiddleware) SetOverrides(overrides []ratelimit.Rule) {
+	m.overrides.Store(ratelimit.NewRuleSet(overrides))
+}
+
+// Overrides devuelve los overrides activos
+func (m *RateLimitMiddleware) Overrides() []ratelimit.Rule {
+	return m.overrides.Load().Rules()
+}
+
+// matchRule devuelve el override o la regla del scope que aplica al request (ver
+// RuleSet.Match); los overrides tienen prioridad
+func (m *RateLimitMiddleware) matchRule(scope string, r *http.Request, ip, path string) *ratelimit.Rule {
+	if rule := m.overrides.Load().Match(scope, r, ip, path); rule != nil {
+		return rule
+	}
+	return m.rules.Load().Match(scope, r, ip, path)
+}
+
+// ruleLimitConfig usa el algoritmo de la regla o el que corresponde al scope si no define uno
+func ruleLimitConfig(rule *ratelimit.Rule, algorithm ratelimit.Algorithm) ratelimit.LimitConfig {
+	config := rule.LimitConfig()
+	if config.Algorithm == "" {
+		config.Algorithm = algorithm
+	}
+	return config
+}
+
+// failPolicyFor devuelve la política del path o la default
+func (m *RateLimitMiddleware) failPolicyFor(path string) ratelimit.FailPolicy {
+	if policy, exists := m.pathFailPolicies[path]; exists {
+		return policy
+	}
+	return m.failPolicy
+}
+
+// checkLocal verifica los límites en memoria con la parte del límite global
+// que le corresponde a esta instancia
+func (m *RateLimitMiddleware) checkLocal(ctx context.Context, limits map[string]ratelimit.LimitConfig) (map[string]*ratelimit.LimitResult, error) {
+	local := make(map[string]ratelimit.LimitConfig, len(limits))
+	for key, config := range limits {
+		local[key] = ratelimit.LocalShare(config, m.config.ProxyInstances)
+	}
+	return m.fallback.CheckMultipleLimits(ctx, local)
+}
+
+// writeUnavailableResponse rechaza el request cuando el limiter no responde (fail closed)
+func (m *RateLimitMiddleware) writeUnavailableResponse(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", "1")
+	w.WriteHeader(http.StatusServiceUnavailable)
+
+	response := `{"error":"rate_limit_unavailable","message":"Rate limiter unavailable"}`
+	w.Write([]byte(response))
+}
+
+// writeRateLimitResponse responde 429; los headers describen el límite que rechazó
+// el request (blockedType) y Retry-After es el tiempo hasta que vuelva a haber cupo
+func (m *RateLimitMiddleware) writeRateLimitResponse(w http.ResponseWriter, keys map[string]string, limits map[string]ratelimit.LimitConfig, results map[string]*ratelimit.LimitResult, blockedType string) {
+	result := results[keys[blockedType]]
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
-	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(result.ResetTime.Unix(), 10))
+	if m.headerMode.Legacy() {
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(result.ResetTime.Unix(), 10))
+		m.addQuotaHeaders(w, limits, results)
+	}
+	if m.headerMode.Standard() {
+		m.addStandardHeaders(w, keys, limits, results, blockedType)
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(result)))
 	w.WriteHeader(http.StatusTooManyRequests)
 
 	response := `{"error":"rate_limit_exceeded","message":"Too many requests"}`
 	w.Write([]byte(response))
 }
 
-func (m *RateLimitMiddleware) addRateLimitHeaders(w http.ResponseWriter, results map[string]*ratelimit.LimitResult) {
-	// Usar el límite más restrictivo para los headers
-	minRemaining := -1
-	var earliestReset time.Time
+// addRateLimitHeaders agrega los headers de RATE_LIMIT_HEADERS a un request permitido
+func (m *RateLimitMiddleware) addRateLimitHeaders(w http.ResponseWriter, keys map[string]string, limits map[string]ratelimit.LimitConfig, results map[string]*ratelimit.LimitResult) {
+	if m.headerMode.Legacy() {
+		m.addLegacyHeaders(w, limits, results)
+	}
+	if m.headerMode.Standard() {
+		m.addStandardHeaders(w, keys, limits, results, "")
+	}
+}
 
-	for _, result := range results {
-		if minRemaining == -1 || result.Remaining < minRemaining {
-			minRemaining = result.Remaining
+// addLegacyHeaders agrega X-RateLimit-* con la key más cercana a agotarse (con
+// ventanas apiladas puede ser la de 1s o la de 1m); las cuotas van aparte
+func (m *RateLimitMiddleware) addLegacyHeaders(w http.ResponseWriter, limits map[string]ratelimit.LimitConfig, results map[string]*ratelimit.LimitResult) {
+	var restrictive string
+	for key, result := range results {
+		if ratelimit.IsQuotaKey(key) {
+			continue
 		}
-		if earliestReset.IsZero() || result.ResetTime.Before(earliestReset) {
-			earliestReset = result.ResetTime
+		if restrictive == "" || closerToExhaustion(result, results[restrictive]) {
+			restrictive = key
 		}
 	}
 
-	// Add standard rate limit headers
-	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(m.config.DefaultRPS))
-	if minRemaining >= 0 {
-		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(minRemaining))
+	if restrictive == "" {
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(m.defaultLimit()))
+	} else {
+		result := results[restrictive]
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limits[restrictive].Limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(result.ResetTime.Unix(), 10))
+	}
+
+	m.addQuotaHeaders(w, limits, results)
+}
+
+// addStandardHeaders agrega RateLimit-Policy con una política por tipo de límite
+// (ip, path, ip_path, ventanas apiladas y cuotas) y RateLimit con la política
+// binding, o la más cercana a agotarse si binding es vacío
+func (m *RateLimitMiddleware) addStandardHeaders(w http.ResponseWriter, keys map[string]string, limits map[string]ratelimit.LimitConfig, results map[string]*ratelimit.LimitResult, binding string) {
+	types := make([]string, 0, len(keys))
+	for limitType, key := range keys {
+		if _, ok := results[key]; ok {
+			types = append(types, limitType)
+		}
+	}
+	if len(types) == 0 {
+		return
 	}
-	if !earliestReset.IsZero() {
-		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(earliestReset.Unix(), 10))
+	sort.Strings(types)
+
+	now := time.Now()
+	pick := binding == ""
+	policies := make([]string, 0, len(types))
+	for _, limitType := range types {
+		config := limits[keys[limitType]]
+		policies = append(policies, ratelimit.PolicyItem(limitType, config.Limit, policyWindow(limitType, config, now)))
+		if pick && (binding == "" || closerToExhaustion(results[keys[limitType]], results[keys[binding]])) {
+			binding = limitType
+		}
+	}
+
+	result := results[keys[binding]]
+	reset := result.ResetTime.Sub(now)
+	if !result.Allowed && result.RetryAfter > 0 {
+		reset = result.RetryAfter
+	}
+	w.Header().Set("RateLimit-Policy", strings.Join(policies, ", "))
+	w.Header().Set("RateLimit", ratelimit.RateLimitItem(binding, result.Remaining, reset))
+}
+
+// policyWindow es la ventana de la política; la de una cuota es el período completo
+// y no lo que falta para que termine
+func policyWindow(limitType string, config ratelimit.LimitConfig, now time.Time) time.Duration {
+	if period, ok := strings.CutPrefix(limitType, "quota_"); ok {
+		return ratelimit.QuotaPeriod(period).Length(now)
+	}
+	return config.Window
+}
+
+// closerToExhaustion indica si a tiene menos cupo que b; a igual cupo, el que tarda
+// más en reiniciarse
+func closerToExhaustion(a, b *ratelimit.LimitResult) bool {
+	return a.Remaining < b.Remaining || (a.Remaining == b.Remaining && a.ResetTime.After(b.ResetTime))
+}
+
+// addQuotaHeaders agrega X-RateLimit-Quota-* con la cuota más cercana a agotarse
+// (límite, restante y reset en unix); sin cuotas no agrega nada
+func (m *RateLimitMiddleware) addQuotaHeaders(w http.ResponseWriter, limits map[string]ratelimit.LimitConfig, results map[string]*ratelimit.LimitResult) {
+	var quotaKey string
+	for key, result := range results {
+		if !ratelimit.IsQuotaKey(key) {
+			continue
+		}
+		if quotaKey == "" || result.Remaining < results[quotaKey].Remaining {
+			quotaKey = key
+		}
+	}
+	if quotaKey == "" {
+		return
+	}
+
+	result := results[quotaKey]
+	w.Header().Set("X-RateLimit-Quota-Limit", strconv.Itoa(limits[quotaKey].Limit))
+	w.Header().Set("X-RateLimit-Quota-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("X-RateLimit-Quota-Reset", strconv.FormatInt(result.ResetTime.Unix(), 10))
+}
+
+// retryAfterSeconds usa el RetryAfter exacto del algoritmo si existe y
+// si no, el tiempo hasta ResetTime. Redondea hacia arriba y nunca es menor a 1.
+func retryAfterSeconds(result *ratelimit.LimitResult) int {
+	wait := result.RetryAfter
+	if wait <= 0 {
+		wait = time.Until(result.ResetTime)
+	}
+
+	seconds := int((wait + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
 	}
+	return seconds
 }
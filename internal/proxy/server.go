@@ -24,6 +24,9 @@ type Server struct {
 	config     *config.Config
 	logger     *zap.Logger
 	middleware []func(http.Handler) http.Handler
+	rateLimit  *middleware.RateLimitMiddleware
+	access     *middleware.AccessListMiddleware
+	jwt        *middleware.JWTMiddleware
 	startTime  time.Time
 	client     *http.Client
 }
@@ -81,9 +84,17 @@ func NewServer(cfg *config.Config, rateLimiter ratelimit.Limiter, logger *zap.Lo
 	}
 
 	// Setup middleware chain
+	rateLimit := middleware.NewRateLimitMiddleware(rateLimiter, cfg, logger)
+	access := middleware.NewAccessListMiddleware(cfg, logger)
+	jwt, err := middleware.NewJWTMiddleware(cfg, logger)
+	if err != nil {
+		logger.Fatal("invalid JWT config", zap.Error(err))
+	}
 	middlewares := []func(http.Handler) http.Handler{
 		middleware.NewMetricsMiddleware().Handler,
-		middleware.NewRateLimitMiddleware(rateLimiter, cfg, logger).Handler,
+		access.Handler,
+		jwt.Handler,
+		rateLimit.Handler,
 	}
 
 	return &Server{
@@ -91,11 +102,19 @@ func NewServer(cfg *config.Config, rateLimiter ratelimit.Limiter, logger *zap.Lo
 		config:     cfg,
 		logger:     logger,
 		middleware: middlewares,
+		rateLimit:  rateLimit,
+		access:     access,
+		jwt:        jwt,
 		startTime:  time.Now(),
 		client:     client,
 	}
 }
 
+// RateLimitMiddleware expone el middleware de rate limiting (ej: para recargar reglas)
+func (s *Server) RateLimitMiddleware() *middleware.RateLimitMiddleware {
+	return s.rateLimit
+}
+
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Log incoming request
 	s.logger.Info("incoming request",
@@ -176,9 +195,9 @@ func (s *Server) Handler() http.Handler {
 			return
 		}
 
-		// Handle no-rate-limit routes
+		// Handle no-rate-limit routes (la denylist y el JWT aplican igual)
 		if s.isNoRateLimitRoute(r.URL.Path) {
-			s.ServeNoRateLimit(w, r)
+			s.access.Handler(s.jwt.Handler(http.HandlerFunc(s.ServeNoRateLimit))).ServeHTTP(w, r)
 			return
 		}
 
@@ -215,7 +234,7 @@ func (s *Server) ServeNoRateLimit(w http.ResponseWriter, r *http.Request) {
 
 		// Record metrics for error
 		duration := time.Since(startTime)
-		s.recordMetrics(r.Method, "/no-ratelimit/*", "500", duration)
+		s.recordMetrics(ratelimit.KeyMethod(r.Method), "/no-ratelimit/*", "500", duration)
 		return
 	}
 
@@ -247,7 +266,7 @@ func (s *Server) ServeNoRateLimit(w http.ResponseWriter, r *http.Request) {
 
 		// Record metrics for error
 		duration := time.Since(startTime)
-		s.recordMetrics(r.Method, "/no-ratelimit/*", "502", duration)
+		s.recordMetrics(ratelimit.KeyMethod(r.Method), "/no-ratelimit/*", "502", duration)
 		return
 	}
 	defer resp.Body.Close()
@@ -271,7 +290,7 @@ func (s *Server) ServeNoRateLimit(w http.ResponseWriter, r *http.Request) {
 	// Record metrics for successful request
 	duration := time.Since(startTime)
 	statusCode := resp.StatusCode
-	s.recordMetrics(r.Method, "/no-ratelimit/*", strconv.Itoa(statusCode), duration)
+	s.recordMetrics(ratelimit.KeyMethod(r.Method), "/no-ratelimit/*", strconv.Itoa(statusCode), duration)
 
 	// Log request without rate limit info
 	s.logger.Info("No-rate-limit request served",
@@ -0,0 +1,42 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Algorithm identifica el algoritmo de rate limiting que usa una regla
+type Algorithm string
+
+const (
+	// AlgorithmSlidingWindow es el sliding window log sobre ZSET (default)
+	AlgorithmSlidingWindow Algorithm = "sliding_window"
+	// AlgorithmTokenBucket permite ráfagas de hasta Burst requests y recarga a Limit/Window
+	AlgorithmTokenBucket Algorithm = "token_bucket"
+	// AlgorithmGCRA guarda un único TAT por key y calcula el Retry-After exacto
+	AlgorithmGCRA Algorithm = "gcra"
+	// AlgorithmSlidingWindowCounter aproxima la ventana con dos buckets fijos (memoria O(1))
+	AlgorithmSlidingWindowCounter Algorithm = "sliding_window_counter"
+	// AlgorithmFixedWindow cuenta requests en una ventana que empieza con el primero
+	// y se reinicia al vencer (cuotas diarias y mensuales)
+	AlgorithmFixedWindow Algorithm = "fixed_window"
+)
+
+// ParseAlgorithm convierte un string de configuración en un Algorithm válido.
+// Un string vacío devuelve el algoritmo por defecto (sliding window).
+func ParseAlgorithm(name string) (Algorithm, error) {
+	switch Algorithm(strings.ToLower(strings.TrimSpace(name))) {
+	case "", AlgorithmSlidingWindow:
+		return AlgorithmSlidingWindow, nil
+	case AlgorithmTokenBucket:
+		return AlgorithmTokenBucket, nil
+	case AlgorithmGCRA:
+		return AlgorithmGCRA, nil
+	case AlgorithmSlidingWindowCounter:
+		return AlgorithmSlidingWindowCounter, nil
+	case AlgorithmFixedWindow:
+		return AlgorithmFixedWindow, nil
+	default:
+		return "", fmt.Errorf("unknown rate limit algorithm %q", name)
+	}
+}
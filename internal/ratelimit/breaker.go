@@ -0,0 +1,233 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andress1014/meli-proxy/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// Estados del circuit breaker (también son los valores del gauge)
+const (
+	BreakerClosed int32 = 0 // se usa el limiter principal
+	BreakerOpen   int32 = 1 // se usa el limiter local hasta que el principal se recupere
+)
+
+// ErrBreakerOpen acompaña los resultados del limiter local mientras el breaker está
+// abierto, para que el caller pueda aplicar su política de fallo (ej: fail-closed)
+var ErrBreakerOpen = errors.New("rate limit circuit breaker is open")
+
+// probeKey se usa para probar limiters que no implementan HealthChecker
+const probeKey = "breaker::probe"
+
+// BreakerConfig configura el circuit breaker alrededor del limiter principal
+type BreakerConfig struct {
+	Name             string        `json:"name"`              // label del gauge (ej: redis)
+	FailureThreshold int           `json:"failure_threshold"` // errores consecutivos para abrir
+	ProbeInterval    time.Duration `json:"probe_interval"`    // cada cuánto se prueba el principal
+	ProbeTimeout     time.Duration `json:"probe_timeout"`
+	Instances        int           `json:"instances"` // reparto del límite en el limiter local
+}
+
+// CircuitBreakerLimiter envuelve un Limiter (normalmente Redis). Tras
+// FailureThreshold errores consecutivos se abre y todas las verificaciones van
+// a un MemoryLimiter con la parte del límite de esta instancia, sin esperar
+// timeouts. Mientras está abierto prueba el principal cada ProbeInterval y
+// vuelve a usarlo apenas responde.
+//
+// Con el breaker cerrado los errores se devuelven tal cual para que el caller
+// aplique su política de fallo. Con el breaker abierto se devuelven los
+// resultados locales junto con ErrBreakerOpen.
+type CircuitBreakerLimiter struct {
+	primary      Limiter
+	fallback     *MemoryLimiter
+	ownsFallback bool // el fallback lo creó el breaker y lo cierra en Close
+	config       BreakerConfig
+	logger       *zap.Logger
+
+	state    int32
+	failures int32
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewCircuitBreakerLimiter envuelve primary. fallback es el limiter local, el mismo
+// que usa el middleware con RATE_LIMIT_FAIL_POLICY=local para que una instancia
+// lleve un solo contador local; si es nil el breaker crea uno propio.
+func NewCircuitBreakerLimiter(primary Limiter, fallback *MemoryLimiter, config BreakerConfig, logger *zap.Logger) *CircuitBreakerLimiter {
+	if config.Name == "" {
+		config.Name = "primary"
+	}
+	config.FailureThreshold = getOrDefault(config.FailureThreshold, 5)
+	config.ProbeInterval = getOrDefaultDuration(config.ProbeInterval, 5*time.Second)
+	config.ProbeTimeout = getOrDefaultDuration(config.ProbeTimeout, 500*time.Millisecond)
+
+	ownsFallback := fallback == nil
+	if ownsFallback {
+		fallback = NewMemoryLimiter(0)
+	}
+
+	cb := &CircuitBreakerLimiter{
+		primary:      primary,
+		fallback:     fallback,
+		ownsFallback: ownsFallback,
+		config:       config,
+		logger:       logger,
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	metrics.SetRateLimitBreakerState(config.Name, BreakerClosed)
+
+	go cb.probe()
+
+	return cb
+}
+
+// CheckMultipleLimits usa el limiter principal o el local según el estado del
+// breaker; con el breaker abierto el error es ErrBreakerOpen
+func (cb *CircuitBreakerLimiter) CheckMultipleLimits(ctx context.Context, limits map[string]LimitConfig) (map[string]*LimitResult, error) {
+	if cb.State() == BreakerOpen {
+		results, err := cb.checkFallback(ctx, limits)
+		if err != nil {
+			return nil, err
+		}
+		return results, ErrBreakerOpen
+	}
+
+	results, err := cb.primary.CheckMultipleLimits(ctx, limits)
+	if err != nil {
+		// Las cancelaciones del cliente no cuentan como falla del backend
+		if ctx.Err() == context.Canceled {
+			return nil, err
+		}
+		if atomic.AddInt32(&cb.failures, 1) >= int32(cb.config.FailureThreshold) {
+			cb.trip(err)
+		}
+		return nil, err
+	}
+
+	atomic.StoreInt32(&cb.failures, 0)
+	return results, nil
+}
+
+// Peek consulta el limiter que está en uso según el estado del breaker
+func (cb *CircuitBreakerLimiter) Peek(ctx context.Context, limits map[string]LimitConfig) (map[string]*LimitResult, error) {
+	if cb.State() == BreakerOpen {
+		local := make(map[string]LimitConfig, len(limits))
+		for key, config := range limits {
+			local[key] = LocalShare(config, cb.config.Instances)
+		}
+		return cb.fallback.Peek(ctx, local)
+	}
+
+	inspector, ok := cb.primary.(Inspector)
+	if !ok {
+		return nil, ErrInspectNotSupported
+	}
+	return inspector.Peek(ctx, limits)
+}
+
+// Reset borra las keys en ambos limiters
+func (cb *CircuitBreakerLimiter) Reset(ctx context.Context, keys ...string) error {
+	cb.fallback.Reset(ctx, keys...)
+
+	inspector, ok := cb.primary.(Inspector)
+	if !ok {
+		return ErrInspectNotSupported
+	}
+	return inspector.Reset(ctx, keys...)
+}
+
+// State devuelve BreakerClosed o BreakerOpen
+func (cb *CircuitBreakerLimiter) State() int32 {
+	return atomic.LoadInt32(&cb.state)
+}
+
+// Close detiene el probe y cierra el principal y el local si es propio
+func (cb *CircuitBreakerLimiter) Close() error {
+	cb.closeOnce.Do(func() {
+		close(cb.stop)
+		<-cb.done
+		if cb.ownsFallback {
+			cb.fallback.Close()
+		}
+	})
+	return cb.primary.Close()
+}
+
+func (cb *CircuitBreakerLimiter) checkFallback(ctx context.Context, limits map[string]LimitConfig) (map[string]*LimitResult, error) {
+	local := make(map[string]LimitConfig, len(limits))
+	for key, config := range limits {
+		local[key] = LocalShare(config, cb.config.Instances)
+	}
+	return cb.fallback.CheckMultipleLimits(ctx, local)
+}
+
+func (cb *CircuitBreakerLimiter) trip(err error) {
+	if !atomic.CompareAndSwapInt32(&cb.state, BreakerClosed, BreakerOpen) {
+		return
+	}
+	metrics.SetRateLimitBreakerState(cb.config.Name, BreakerOpen)
+	cb.logger.Warn("rate limit circuit breaker opened, using local limiter",
+		zap.String("limiter", cb.config.Name),
+		zap.Int("consecutive_failures", cb.config.FailureThreshold),
+		zap.Error(err))
+}
+
+func (cb *CircuitBreakerLimiter) reset() {
+	atomic.StoreInt32(&cb.failures, 0)
+	if !atomic.CompareAndSwapInt32(&cb.state, BreakerOpen, BreakerClosed) {
+		return
+	}
+	metrics.SetRateLimitBreakerState(cb.config.Name, BreakerClosed)
+	cb.logger.Info("rate limit circuit breaker closed, primary limiter recovered",
+		zap.String("limiter", cb.config.Name))
+}
+
+// probe verifica periódicamente el limiter principal mientras el breaker está abierto
+func (cb *CircuitBreakerLimiter) probe() {
+	defer close(cb.done)
+
+	ticker := time.NewTicker(cb.config.ProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cb.stop:
+			return
+		case <-ticker.C:
+			if cb.State() != BreakerOpen {
+				continue
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), cb.config.ProbeTimeout)
+			err := cb.healthCheck(ctx)
+			cancel()
+
+			if err != nil {
+				cb.logger.Debug("rate limit primary still unavailable",
+					zap.String("limiter", cb.config.Name),
+					zap.Error(err))
+				continue
+			}
+			cb.reset()
+		}
+	}
+}
+
+// healthCheck usa HealthCheck si el limiter lo implementa y si no una key de prueba
+func (cb *CircuitBreakerLimiter) healthCheck(ctx context.Context) error {
+	if checker, ok := cb.primary.(HealthChecker); ok {
+		return checker.HealthCheck(ctx)
+	}
+	_, err := cb.primary.CheckMultipleLimits(ctx, map[string]LimitConfig{
+		probeKey: {Limit: 1 << 30, Window: time.Second},
+	})
+	return err
+}
@@ -0,0 +1,222 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+)
+
+// ProxyHeader es el header de forwarding que escribe el proxy de confianza
+type ProxyHeader string
+
+const (
+	// ProxyHeaderXForwardedFor es la cadena X-Forwarded-For (nginx con $proxy_add_x_forwarded_for)
+	ProxyHeaderXForwardedFor ProxyHeader = "x-forwarded-for"
+	// ProxyHeaderForwarded es la cadena Forwarded (RFC 7239)
+	ProxyHeaderForwarded ProxyHeader = "forwarded"
+	// ProxyHeaderXRealIP es X-Real-IP; el proxy tiene que pisar el valor que manda el cliente
+	ProxyHeaderXRealIP ProxyHeader = "x-real-ip"
+)
+
+// ParseProxyHeader convierte TRUSTED_PROXY_HEADER en un ProxyHeader; vacío es X-Forwarded-For
+func ParseProxyHeader(name string) (ProxyHeader, error) {
+	switch header := ProxyHeader(strings.ToLower(strings.TrimSpace(name))); header {
+	case "", ProxyHeaderXForwardedFor:
+		return ProxyHeaderXForwardedFor, nil
+	case ProxyHeaderForwarded, ProxyHeaderXRealIP:
+		return header, nil
+	}
+	return "", fmt.Errorf("unknown trusted proxy header %q (expected x-forwarded-for, forwarded or x-real-ip)", name)
+}
+
+// ClientIPResolver obtiene la IP del cliente confiando en el header de
+// forwarding solo cuando lo agrega un proxy de confianza. Se lee únicamente el
+// header configurado: los demás los puede mandar el cliente y el proxy los
+// deja pasar. La cadena se recorre de derecha a izquierda salteando los saltos
+// de confianza: la primera IP que no es de confianza es el cliente. Un cliente
+// no puede falsificar su IP agregando entradas a la izquierda.
+type ClientIPResolver struct {
+	trusted *IPTrie[struct{}]
+	header  ProxyHeader
+}
+
+// NewClientIPResolver crea un resolver que lee el header indicado (vacío es
+// X-Forwarded-For); sin proxies de confianza solo se usa RemoteAddr
+func NewClientIPResolver(trustedProxies []netip.Prefix, header ProxyHeader) *ClientIPResolver {
+	trusted := NewIPTrie[struct{}]()
+	for _, prefix := range trustedProxies {
+		trusted.InsertPrefix(prefix, struct{}{})
+	}
+	if header == "" {
+		header = ProxyHeaderXForwardedFor
+	}
+	return &ClientIPResolver{trusted: trusted, header: header}
+}
+
+// ClientIP devuelve la IP del cliente del request. No hace allocations.
+func (c *ClientIPResolver) ClientIP(r *http.Request) string {
+	peer := remoteIP(r.RemoteAddr)
+	if !c.isTrusted(peer) {
+		return peer
+	}
+
+	switch c.header {
+	case ProxyHeaderForwarded:
+		if values := r.Header.Values("Forwarded"); len(values) > 0 {
+			return c.walkChain(peer, hopIterator{values: values, forwarded: true})
+		}
+	case ProxyHeaderXRealIP:
+		// Un solo valor, el último: es el que escribió el proxy. Se recorre como
+		// una cadena de un salto para no aceptar algo que no es una IP.
+		if values := r.Header.Values("X-Real-IP"); len(values) > 0 {
+			return c.walkChain(peer, hopIterator{values: values[len(values)-1:]})
+		}
+	default:
+		if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+			return c.walkChain(peer, hopIterator{values: values})
+		}
+	}
+	return peer
+}
+
+// walkChain recorre la cadena de derecha a izquierda desde el peer. Si llega a
+// una entrada inválida se queda con el último salto válido, porque lo que está
+// a la izquierda ya no lo agregó un proxy de confianza.
+func (c *ClientIPResolver) walkChain(peer string, hops hopIterator) string {
+	client := peer
+	for {
+		hop, ok := hops.next()
+		if !ok {
+			// Todos los saltos son de confianza: el cliente es el de más a la izquierda
+			return client
+		}
+		addr, ok := parseHop(hop)
+		if !ok {
+			return client
+		}
+		client = hop
+		if _, trusted := c.trusted.LookupAddr(addr); !trusted {
+			return client
+		}
+	}
+}
+
+// parseHop parsea una entrada de la cadena. Descarta antes de parsear lo que
+// no puede ser una IP, porque el error de netip.ParseAddr hace una allocation
+// y los headers malformados los controla el cliente.
+func parseHop(hop string) (netip.Addr, bool) {
+	if hop == "" {
+		return netip.Addr{}, false
+	}
+	for i := 0; i < len(hop); i++ {
+		switch c := hop[i]; {
+		case c >= '0' && c <= '9', c >= 'a' && c <= 'f', c >= 'A' && c <= 'F', c == '.', c == ':':
+		case c == '%':
+			// La zona de una IPv6 admite cualquier caracter
+			i = len(hop)
+		default:
+			return netip.Addr{}, false
+		}
+	}
+	addr, err := netip.ParseAddr(hop)
+	return addr, err == nil
+}
+
+func (c *ClientIPResolver) isTrusted(ip string) bool {
+	if c.trusted.Len() == 0 {
+		return false
+	}
+	_, found := c.trusted.Lookup(ip)
+	return found
+}
+
+// defaultResolver es el que usa ExtractIP; arranca sin proxies de confianza
+var defaultResolver atomic.Pointer[ClientIPResolver]
+
+// SetTrustedProxies configura los proxies de confianza que usa ExtractIP y el
+// header que escriben
+func SetTrustedProxies(trustedProxies []netip.Prefix, header ProxyHeader) {
+	defaultResolver.Store(NewClientIPResolver(trustedProxies, header))
+}
+
+// remoteIP saca el puerto de RemoteAddr ("ip:port" o "[ipv6]:port")
+func remoteIP(remoteAddr string) string {
+	ip, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return ip
+}
+
+// hopIterator recorre de derecha a izquierda las entradas de uno o más headers
+// X-Forwarded-For o Forwarded sin armar slices intermedios
+type hopIterator struct {
+	values    []string // headers que faltan recorrer
+	rest      string   // entradas pendientes del header actual
+	pending   bool     // rest tiene al menos una entrada (puede ser vacía)
+	forwarded bool     // las entradas son elementos de Forwarded (RFC 7239)
+}
+
+func (it *hopIterator) next() (string, bool) {
+	if !it.pending {
+		if len(it.values) == 0 {
+			return "", false
+		}
+		it.rest = it.values[len(it.values)-1]
+		it.values = it.values[:len(it.values)-1]
+		it.pending = true
+	}
+
+	entry := it.rest
+	if idx := strings.LastIndexByte(it.rest, ','); idx >= 0 {
+		entry, it.rest = it.rest[idx+1:], it.rest[:idx]
+	} else {
+		it.pending = false
+	}
+
+	entry = strings.TrimSpace(entry)
+	if it.forwarded {
+		entry = forwardedFor(entry)
+	}
+	return entry, true
+}
+
+// forwardedFor extrae el parámetro for= de un elemento de Forwarded (RFC 7239),
+// por ejemplo: for=192.0.2.60;proto=http o for="[2001:db8::1]:4711". Sin for=
+// devuelve vacío para que cuente como un salto inválido.
+func forwardedFor(element string) string {
+	for element != "" {
+		pair := element
+		if idx := strings.IndexByte(element, ';'); idx >= 0 {
+			pair, element = element[:idx], element[idx+1:]
+		} else {
+			element = ""
+		}
+
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok && strings.EqualFold(strings.TrimSpace(key), "for") {
+			return forwardedNode(strings.TrimSpace(value))
+		}
+	}
+	return ""
+}
+
+// forwardedNode saca comillas, corchetes y puerto de un nodo de Forwarded.
+// Los nodos ofuscados ("_hidden") o "unknown" quedan como están y no parsean como IP.
+func forwardedNode(node string) string {
+	node = strings.Trim(node, `"`)
+	if strings.HasPrefix(node, "[") {
+		if end := strings.Index(node, "]"); end > 0 {
+			return node[1:end]
+		}
+		return node
+	}
+	// IPv4 con puerto; una IPv6 sin corchetes tiene más de un ':'
+	if strings.Count(node, ":") == 1 {
+		node, _, _ = strings.Cut(node, ":")
+	}
+	return node
+}
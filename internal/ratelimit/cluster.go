@@ -2,6 +2,8 @@ package ratelimit
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -31,7 +33,6 @@ type ClusterConfig struct {
 // ClusterLimiter para rate limiting distribuido
 type ClusterLimiter struct {
 	client *redis.ClusterClient
-	script string
 	logger *zap.Logger
 }
 
@@ -68,82 +69,154 @@ func NewClusterLimiter(config ClusterConfig, logger *zap.Logger) (*ClusterLimite
 		return nil, err
 	}
 
-	// Lua script para sliding window atomic
-	luaScript := `
-local key = KEYS[1]
-local window = tonumber(ARGV[1])
-local limit = tonumber(ARGV[2])
-local now = tonumber(ARGV[3])
-
--- Limpiar entradas antiguas
-redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
-
--- Contar entradas actuales
-local current = redis.call('ZCARD', key)
-
-if current < limit then
-    -- Agregar nueva entrada
-    redis.call('ZADD', key, now, now)
-    redis.call('EXPIRE', key, math.ceil(window / 1000))
-    return {1, limit - current - 1}
-else
-    return {0, 0}
-end
-`
-
 	logger.Info("Redis cluster limiter initialized",
 		zap.Strings("addrs", config.Addrs),
 		zap.Int("pool_size", getOrDefault(config.PoolSize, 1000)))
 
 	return &ClusterLimiter{
 		client: rdb,
-		script: luaScript,
 		logger: logger,
 	}, nil
 }
 
 func (cl *ClusterLimiter) CheckLimit(ctx context.Context, key string, limit int, window time.Duration) (*LimitResult, error) {
-	now := time.Now().UnixMilli()
-	windowMs := window.Milliseconds()
-
 	// Usar hash tag para garantizar que todas las keys del mismo usuario
 	// vayan al mismo shard (importante para rate limiting distribuido)
-	clusterKey := cl.addHashTag(key)
-
-	result, err := cl.client.Eval(ctx, cl.script, []string{clusterKey}, windowMs, limit, now).Result()
+	results, err := evalLimits(ctx, cl.client, []limitCheck{
+		{key: cl.addHashTag(key), config: LimitConfig{Limit: limit, Window: window, Algorithm: AlgorithmSlidingWindow}},
+	})
 	if err != nil {
 		return nil, err
 	}
+	return results[0], nil
+}
 
-	values, ok := result.([]interface{})
-	if !ok || len(values) != 2 {
-		return &LimitResult{
-			Allowed:   false,
-			Remaining: 0,
-			ResetTime: time.Now().Add(window),
-		}, nil
+// CheckMultipleLimits agrupa las keys por hash tag; cada grupo se evalúa con el
+// script multi-key en un único round trip. ip e ip_path comparten el tag de la IP,
+// así que caen en el mismo slot; path usa su propio tag para seguir siendo un
+// contador global. Como un script no puede abarcar varios slots, primero se
+// consultan todos los grupos sin registrar nada (peek) y solo si todos permiten
+// el request se registra en cada uno: un rechazo en cualquier grupo no consume
+// cupo de los demás. Si un grupo rechaza, los siguientes no se consultan y sus
+// keys no aparecen en el resultado.
+func (cl *ClusterLimiter) CheckMultipleLimits(ctx context.Context, limits map[string]LimitConfig) (map[string]*LimitResult, error) {
+	type group struct {
+		keys   []string
+		checks []limitCheck
 	}
 
-	allowed := values[0].(int64) == 1
-	remaining := int(values[1].(int64))
+	groups := make(map[string]*group)
+	tags := make([]string, 0, len(limits))
+	for key, config := range limits {
+		tag := ClusterHashTag(key)
+		g, ok := groups[tag]
+		if !ok {
+			g = &group{}
+			groups[tag] = g
+			tags = append(tags, tag)
+		}
+		g.keys = append(g.keys, key)
+		g.checks = append(g.checks, limitCheck{key: cl.addHashTag(key), config: config})
+	}
 
-	return &LimitResult{
-		Allowed:   allowed,
-		Remaining: remaining,
-		ResetTime: time.Now().Add(window),
-	}, nil
+	// Primero los grupos por cliente y al final los contadores globales por path:
+	// si el cliente ya excedió su límite no hace falta consultar el path
+	sort.Slice(tags, func(i, j int) bool {
+		iPath, jPath := strings.HasPrefix(tags[i], "/"), strings.HasPrefix(tags[j], "/")
+		if iPath != jPath {
+			return jPath
+		}
+		return tags[i] < tags[j]
+	})
+
+	results := make(map[string]*LimitResult, len(limits))
+
+	// Un solo grupo ya es atómico dentro del script
+	if len(tags) > 1 {
+		for _, tag := range tags {
+			g := groups[tag]
+			peeked, err := peekLimits(ctx, cl.client, g.checks)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check limits for slot {%s}: %w", tag, err)
+			}
+
+			rejected := false
+			for i, key := range g.keys {
+				results[key] = peeked[i]
+				if !peeked[i].Allowed {
+					rejected = true
+				}
+			}
+			if rejected {
+				return results, nil
+			}
+		}
+	}
+
+	// Todos permiten: registrar el request. Otro request puede consumir el último
+	// cupo entre el peek y el registro; en ese caso el script del grupo lo rechaza.
+	for _, tag := range tags {
+		g := groups[tag]
+		evaluated, err := evalLimits(ctx, cl.client, g.checks)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check limits for slot {%s}: %w", tag, err)
+		}
+		for i, key := range g.keys {
+			results[key] = evaluated[i]
+		}
+	}
+
+	return results, nil
+}
+
+// Peek devuelve el estado de las keys sin registrar un request.
+// A diferencia de CheckMultipleLimits evalúa todos los grupos.
+func (cl *ClusterLimiter) Peek(ctx context.Context, limits map[string]LimitConfig) (map[string]*LimitResult, error) {
+	results := make(map[string]*LimitResult, len(limits))
+	for key, config := range limits {
+		evaluated, err := peekLimits(ctx, cl.client, []limitCheck{{key: cl.addHashTag(key), config: config}})
+		if err != nil {
+			return nil, err
+		}
+		results[key] = evaluated[0]
+	}
+	return results, nil
+}
+
+// Reset borra los contadores de las keys (una por una porque pueden estar en slots distintos)
+func (cl *ClusterLimiter) Reset(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		if err := cl.client.Del(ctx, cl.addHashTag(key)).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // addHashTag asegura que keys relacionadas vayan al mismo shard
 func (cl *ClusterLimiter) addHashTag(key string) string {
-	// Extraer el identificador base (IP o user) para hash tag
-	parts := strings.Split(key, ":")
-	if len(parts) > 0 {
-		base := parts[0]
-		// Usar hash tag de Redis Cluster: {base}:key
-		return "{" + base + "}:" + key
+	if strings.Contains(key, "{") {
+		return key
 	}
-	return key
+	// Usar hash tag de Redis Cluster: {identidad}:key
+	return "{" + ClusterHashTag(key) + "}:" + key
+}
+
+// ClusterHashTag extrae la identidad de una key con formato tipo[:MÉTODO]::identidad[::/path].
+// ip::<ip> e ip_path::<ip>::<path> usan la IP; path::<path> usa el path.
+// Se corta en el último "::/" porque las IPv6 también contienen "::".
+func ClusterHashTag(key string) string {
+	idx := strings.Index(key, "::")
+	if idx < 0 {
+		return key
+	}
+	identity := key[idx+2:]
+	if !strings.HasPrefix(identity, "/") {
+		if end := strings.LastIndex(identity, "::/"); end > 0 {
+			identity = identity[:end]
+		}
+	}
+	return identity
 }
 
 // Health check para cluster
@@ -151,6 +224,11 @@ func (cl *ClusterLimiter) HealthCheck(ctx context.Context) error {
 	return cl.client.Ping(ctx).Err()
 }
 
+// RedisClient devuelve el cliente del cluster
+func (cl *ClusterLimiter) RedisClient() redis.UniversalClient {
+	return cl.client
+}
+
 // Close connections
 func (cl *ClusterLimiter) Close() error {
 	return cl.client.Close()
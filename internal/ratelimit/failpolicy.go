@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FailPolicy define qué hacer con un request cuando el backend del limiter falla
+type FailPolicy string
+
+const (
+	// FailOpen permite el request sin verificar límites (default)
+	FailOpen FailPolicy = "open"
+	// FailClosed rechaza el request
+	FailClosed FailPolicy = "closed"
+	// FailLocal verifica contra un limiter en memoria con la parte del límite
+	// global que le corresponde a esta instancia
+	FailLocal FailPolicy = "local"
+)
+
+// ParseFailPolicy convierte un string de configuración en una FailPolicy válida.
+// Un string vacío devuelve FailOpen.
+func ParseFailPolicy(name string) (FailPolicy, error) {
+	switch FailPolicy(strings.ToLower(strings.TrimSpace(name))) {
+	case "", FailOpen:
+		return FailOpen, nil
+	case FailClosed:
+		return FailClosed, nil
+	case FailLocal:
+		return FailLocal, nil
+	default:
+		return "", fmt.Errorf("unknown rate limit fail policy %q", name)
+	}
+}
+
+// LocalShare reparte un límite global entre instances instancias (mínimo 1 request).
+// Se redondea hacia abajo para que la suma de todas las instancias no supere el global.
+func LocalShare(config LimitConfig, instances int) LimitConfig {
+	if instances <= 1 {
+		return config
+	}
+
+	config.Limit = maxInt(1, config.Limit/instances)
+	if config.Burst > 0 {
+		config.Burst = maxInt(1, config.Burst/instances)
+	}
+	return config
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,44 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// GCRALimiter implementa Limiter con GCRA (generic cell rate algorithm) sobre
+// una única key de Redis por identidad que guarda el TAT (theoretical arrival time).
+// A diferencia del sliding window calcula el tiempo exacto hasta el próximo request permitido.
+type GCRALimiter struct {
+	client redis.UniversalClient
+}
+
+// NewGCRALimiter crea un limiter GCRA sobre un cliente Redis existente
+func NewGCRALimiter(client redis.UniversalClient) *GCRALimiter {
+	return &GCRALimiter{
+		client: client,
+	}
+}
+
+// CheckLimit permite limit requests por window con ráfagas de hasta burst
+// (si burst <= 0 se usa limit).
+func (g *GCRALimiter) CheckLimit(ctx context.Context, key string, limit, burst int, window time.Duration) (*LimitResult, error) {
+	results, err := evalLimits(ctx, g.client, []limitCheck{
+		{key: key, config: LimitConfig{Limit: limit, Window: window, Algorithm: AlgorithmGCRA, Burst: burst}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// CheckMultipleLimits verifica todas las keys con GCRA en un único script
+func (g *GCRALimiter) CheckMultipleLimits(ctx context.Context, limits map[string]LimitConfig) (map[string]*LimitResult, error) {
+	return evalLimitMap(ctx, g.client, limits, AlgorithmGCRA)
+}
+
+// Close cierra la conexión a Redis
+func (g *GCRALimiter) Close() error {
+	return g.client.Close()
+}
@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HeaderMode es el formato de los headers de rate limit de las respuestas
+type HeaderMode string
+
+const (
+	// HeadersLegacy usa X-RateLimit-Limit / -Remaining / -Reset (y X-RateLimit-Quota-*)
+	HeadersLegacy HeaderMode = "legacy"
+	// HeadersStandard usa RateLimit-Policy y RateLimit del draft de la IETF
+	// (draft-ietf-httpapi-ratelimit-headers)
+	HeadersStandard HeaderMode = "standard"
+	// HeadersBoth envía los dos formatos, para migrar clientes de uno a otro
+	HeadersBoth HeaderMode = "both"
+)
+
+// ParseHeaderMode convierte RATE_LIMIT_HEADERS en un HeaderMode; vacío es legacy
+func ParseHeaderMode(name string) (HeaderMode, error) {
+	switch mode := HeaderMode(strings.ToLower(strings.TrimSpace(name))); mode {
+	case "", HeadersLegacy:
+		return HeadersLegacy, nil
+	case HeadersStandard, HeadersBoth:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown rate limit header mode %q (expected legacy, standard or both)", name)
+}
+
+// Legacy indica si se envían los headers X-RateLimit-*
+func (m HeaderMode) Legacy() bool {
+	return m != HeadersStandard
+}
+
+// Standard indica si se envían RateLimit-Policy y RateLimit
+func (m HeaderMode) Standard() bool {
+	return m == HeadersStandard || m == HeadersBoth
+}
+
+// PolicyItem arma un item de RateLimit-Policy: "ip";q=100;w=60. La ventana va en
+// segundos redondeados hacia arriba (mínimo 1).
+func PolicyItem(name string, limit int, window time.Duration) string {
+	return sfString(name) + ";q=" + strconv.Itoa(limit) + ";w=" + strconv.Itoa(maxInt(ceilSeconds(window), 1))
+}
+
+// RateLimitItem arma el item de RateLimit con lo que queda de una política:
+// "ip";r=0;t=30, donde t son los segundos hasta que vuelve a haber cupo
+func RateLimitItem(name string, remaining int, reset time.Duration) string {
+	if remaining < 0 {
+		remaining = 0
+	}
+	return sfString(name) + ";r=" + strconv.Itoa(remaining) + ";t=" + strconv.Itoa(maxInt(ceilSeconds(reset), 0))
+}
+
+// sfString escribe un string de Structured Fields (RFC 8941)
+func sfString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
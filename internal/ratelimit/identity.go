@@ -0,0 +1,204 @@
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/andress1014/meli-proxy/internal/auth"
+)
+
+// Fuentes de identidad del cliente (IDENTITY_SOURCE)
+const (
+	IdentitySourceIP     = "ip"     // sin credencial: el límite es por IP
+	IdentitySourceHeader = "header" // header:X-API-Key
+	IdentitySourceBearer = "bearer" // Authorization: Bearer <token>
+	IdentitySourceJWT    = "jwt"    // jwt:<claim> del bearer token
+)
+
+// IdentityResolver obtiene la identidad de rate limiting de una credencial del
+// request: un header de API key, el bearer token o un claim de un JWT. Así los
+// clientes detrás de un mismo NAT no comparten el cupo de la IP.
+//
+// La credencial nunca se usa tal cual: la identidad es tipo:hash (key:9f86d0...)
+// para que no aparezca en keys de Redis, logs ni métricas. Solo las credenciales
+// conocidas tienen identidad propia: las listadas en clients y los claims de JWTs
+// verificados. Una API key o bearer token desconocido se limita por IP, así rotar
+// credenciales inventadas no da cupo nuevo. Los claims JWT que no están en la
+// tabla usan el tier default.
+type IdentityResolver struct {
+	source      string
+	name        string            // header o claim
+	kind        string            // prefijo de la identidad: key, token o jwt
+	tiers       map[string]string // identidad -> tier
+	defaultTier string
+
+	// Con jwt:<claim>, leer el claim sin verificar la firma si no hay claims
+	// verificados en el contexto (tokens ya validados por un gateway anterior)
+	trustUpstreamJWT bool
+}
+
+// NewIdentityResolver parsea la fuente (ip, header:<nombre>, bearer o jwt:<claim>)
+// y asigna los tiers de clients, indexados por el valor de la credencial.
+func NewIdentityResolver(source string, clients map[string]string, defaultTier string) (*IdentityResolver, error) {
+	ir := &IdentityResolver{tiers: make(map[string]string, len(clients)), defaultTier: defaultTier}
+
+	kind, name, _ := strings.Cut(strings.TrimSpace(source), ":")
+	ir.source = strings.ToLower(kind)
+	ir.name = strings.TrimSpace(name)
+	switch ir.source {
+	case "", IdentitySourceIP:
+		ir.source = IdentitySourceIP
+	case IdentitySourceHeader:
+		ir.kind = "key"
+		ir.name = http.CanonicalHeaderKey(ir.name)
+	case IdentitySourceBearer:
+		ir.kind = "token"
+	case IdentitySourceJWT:
+		ir.kind = "jwt"
+	default:
+		return nil, fmt.Errorf("invalid identity source %q: expected ip, header:<name>, bearer or jwt:<claim>", source)
+	}
+	if (ir.source == IdentitySourceHeader || ir.source == IdentitySourceJWT) && ir.name == "" {
+		return nil, fmt.Errorf("invalid identity source %q: missing %s name", source, ir.source)
+	}
+
+	for credential, tier := range clients {
+		ir.tiers[ir.identity(credential)] = tier
+	}
+	return ir, nil
+}
+
+// SetTrustUpstreamJWT permite que jwt:<claim> lea el claim de tokens sin verificar
+// cuando JWT_ENABLED=false; solo para proxies detrás de un gateway que valida los
+// tokens. Se llama antes de SetIdentityResolver.
+func (ir *IdentityResolver) SetTrustUpstreamJWT(trust bool) {
+	ir.trustUpstreamJWT = trust
+}
+
+// Source devuelve la fuente configurada (ip, header, bearer o jwt)
+func (ir *IdentityResolver) Source() string {
+	return ir.source
+}
+
+// Identify devuelve la identidad y el tier del request. Sin credencial conocida
+// devuelve "" y el límite sigue siendo por IP.
+func (ir *IdentityResolver) Identify(r *http.Request) (identity, tier string) {
+	credential, verified := ir.credential(r)
+	if credential == "" {
+		return "", ""
+	}
+
+	identity = ir.identity(credential)
+	if tier, ok := ir.tiers[identity]; ok {
+		return identity, tier
+	}
+	if verified {
+		return identity, ir.defaultTier
+	}
+	return "", ""
+}
+
+// credential devuelve la credencial del request y si viene de un JWT verificado
+// (o de un gateway de confianza); las demás solo cuentan si están en clients
+func (ir *IdentityResolver) credential(r *http.Request) (string, bool) {
+	switch ir.source {
+	case IdentitySourceHeader:
+		return strings.TrimSpace(r.Header.Get(ir.name)), false
+	case IdentitySourceBearer:
+		return auth.BearerToken(r), false
+	case IdentitySourceJWT:
+		// Con JWT_ENABLED el token ya fue verificado y sus claims están en el contexto
+		if claims, ok := auth.ClaimsFromContext(r.Context()); ok {
+			return claims.String(ir.name), true
+		}
+		if ir.trustUpstreamJWT {
+			return jwtClaim(auth.BearerToken(r), ir.name), true
+		}
+	}
+	return "", false
+}
+
+// Lookup devuelve la identidad y el tier de una API key o bearer token de clients;
+// ok es false si la credencial no es conocida o la fuente no es header ni bearer.
+// Lo usa la API de administración para consultar las keys de un cliente.
+func (ir *IdentityResolver) Lookup(credential string) (identity, tier string, ok bool) {
+	if ir.source != IdentitySourceHeader && ir.source != IdentitySourceBearer {
+		return "", "", false
+	}
+	identity = ir.identity(credential)
+	tier, ok = ir.tiers[identity]
+	return identity, tier, ok
+}
+
+// Tier devuelve el tier de una identidad ya calculada (tipo:hash, como aparece en
+// las keys y logs); ok es false si no es una identidad que Identify devolvería
+func (ir *IdentityResolver) Tier(identity string) (tier string, ok bool) {
+	hash, found := strings.CutPrefix(identity, ir.kind+":")
+	if ir.kind == "" || !found || len(hash) != 32 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return "", false
+	}
+	if tier, exists := ir.tiers[identity]; exists {
+		return tier, true
+	}
+	// Sin tabla solo tienen identidad propia los claims JWT
+	if ir.source == IdentitySourceJWT {
+		return ir.defaultTier, true
+	}
+	return "", false
+}
+
+func (ir *IdentityResolver) identity(credential string) string {
+	sum := sha256.Sum256([]byte(credential))
+	return ir.kind + ":" + hex.EncodeToString(sum[:16])
+}
+
+// jwtClaim lee un claim string o numérico del payload de un JWT sin verificar la
+// firma, para cuando la validación la hace un gateway anterior (ver SetTrustUpstreamJWT).
+func jwtClaim(token, claim string) string {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return ""
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return ""
+	}
+	switch value := claims[claim].(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return ""
+}
+
+// defaultIdentity es el resolver de DeriveKeys; nil usa siempre la IP
+var defaultIdentity atomic.Pointer[IdentityResolver]
+
+// ActiveIdentityResolver devuelve el resolver de DeriveKeys, o nil si la identidad es la IP
+func ActiveIdentityResolver() *IdentityResolver {
+	return defaultIdentity.Load()
+}
+
+// SetIdentityResolver define de dónde sale la identidad en DeriveKeys (nil = IP)
+func SetIdentityResolver(resolver *IdentityResolver) {
+	if resolver != nil && resolver.source == IdentitySourceIP {
+		resolver = nil
+	}
+	defaultIdentity.Store(resolver)
+}
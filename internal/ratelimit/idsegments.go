@@ -0,0 +1,217 @@
+package ratelimit
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Cantidad máxima de patrones distintos que se guardan para el endpoint de debug
+const maxDetectedPatterns = 1000
+
+// IDDetector reemplaza por * los segmentos de un path con forma de ID de
+// MercadoLibre: site + dígitos (MLA123456789), numéricos (123456), UUIDs y
+// hashes hexadecimales. Se aplica a los paths que no coinciden con ningún
+// template, para que los recursos nuevos no multipliquen keys y labels.
+//
+// Guarda cuántas veces se generó cada patrón y un path de ejemplo.
+type IDDetector struct {
+	detected sync.Map // patrón -> *detectedPath
+	patterns atomic.Int64
+}
+
+type detectedPath struct {
+	example string
+	count   atomic.Int64
+}
+
+// DetectedPath es un patrón generado por el detector
+type DetectedPath struct {
+	Pattern string `json:"pattern"`
+	Example string `json:"example"`
+	Count   int64  `json:"count"`
+}
+
+func NewIDDetector() *IDDetector {
+	return &IDDetector{}
+}
+
+// Normalize reemplaza los segmentos con forma de ID y registra el patrón. Si no
+// hay ninguno devuelve path sin allocations.
+func (d *IDDetector) Normalize(path string) string {
+	pattern := d.Pattern(path)
+	if pattern != path {
+		d.record(pattern, path)
+	}
+	return pattern
+}
+
+// Pattern es Normalize sin registrar el patrón en las estadísticas
+func (d *IDDetector) Pattern(path string) string {
+	if !hasIDSegment(path) {
+		return path
+	}
+
+	var b strings.Builder
+	b.Grow(len(path))
+	for rest, first := path, true; ; first = false {
+		segment, next, more := strings.Cut(rest, "/")
+		if !first {
+			b.WriteByte('/')
+		}
+		if isIDSegment(segment) {
+			b.WriteByte('*')
+		} else {
+			b.WriteString(segment)
+		}
+		if !more {
+			break
+		}
+		rest = next
+	}
+
+	return b.String()
+}
+
+func (d *IDDetector) record(pattern, path string) {
+	if entry, ok := d.detected.Load(pattern); ok {
+		entry.(*detectedPath).count.Add(1)
+		return
+	}
+	if d.patterns.Load() >= maxDetectedPatterns {
+		return
+	}
+
+	entry, loaded := d.detected.LoadOrStore(pattern, &detectedPath{example: path})
+	if !loaded {
+		d.patterns.Add(1)
+	}
+	entry.(*detectedPath).count.Add(1)
+}
+
+// Detected devuelve los patrones generados, del más frecuente al menos frecuente
+func (d *IDDetector) Detected() []DetectedPath {
+	detected := []DetectedPath{}
+	d.detected.Range(func(key, value interface{}) bool {
+		entry := value.(*detectedPath)
+		detected = append(detected, DetectedPath{
+			Pattern: key.(string),
+			Example: entry.example,
+			Count:   entry.count.Load(),
+		})
+		return true
+	})
+	sort.Slice(detected, func(i, j int) bool {
+		if detected[i].Count != detected[j].Count {
+			return detected[i].Count > detected[j].Count
+		}
+		return detected[i].Pattern < detected[j].Pattern
+	})
+	return detected
+}
+
+func hasIDSegment(path string) bool {
+	for rest := path; ; {
+		segment, next, more := strings.Cut(rest, "/")
+		if isIDSegment(segment) {
+			return true
+		}
+		if !more {
+			return false
+		}
+		rest = next
+	}
+}
+
+// isIDSegment indica si un segmento tiene forma de ID
+func isIDSegment(segment string) bool {
+	return isNumeric(segment) || isSiteID(segment) || isUUID(segment) || isHash(segment)
+}
+
+func isNumeric(segment string) bool {
+	if segment == "" {
+		return false
+	}
+	for i := 0; i < len(segment); i++ {
+		if !isDigit(segment[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isSiteID reconoce IDs con prefijo de site (MLA, MLB, MCO...) seguido de dígitos
+func isSiteID(segment string) bool {
+	if len(segment) < 4 || segment[0] != 'M' || !isUpper(segment[1]) || !isUpper(segment[2]) {
+		return false
+	}
+	return isNumeric(segment[3:])
+}
+
+// isUUID reconoce el formato 8-4-4-4-12
+func isUUID(segment string) bool {
+	if len(segment) != 36 {
+		return false
+	}
+	for i := 0; i < len(segment); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if segment[i] != '-' {
+				return false
+			}
+		default:
+			if !isHex(segment[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isHash reconoce hashes y object IDs: 16 o más caracteres hexadecimales con
+// al menos un dígito, para no confundirlos con palabras como "deadbeefcafebabe"
+func isHash(segment string) bool {
+	if len(segment) < 16 {
+		return false
+	}
+	digits := 0
+	for i := 0; i < len(segment); i++ {
+		if !isHex(segment[i]) {
+			return false
+		}
+		if isDigit(segment[i]) {
+			digits++
+		}
+	}
+	return digits > 0
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isUpper(c byte) bool {
+	return c >= 'A' && c <= 'Z'
+}
+
+func isHex(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// defaultIDs es el detector de NormalizePath; nil si está deshabilitado
+var defaultIDs atomic.Pointer[IDDetector]
+
+// SetIDDetection habilita o deshabilita la detección de IDs en NormalizePath
+func SetIDDetection(enabled bool) {
+	if enabled {
+		defaultIDs.Store(NewIDDetector())
+	} else {
+		defaultIDs.Store(nil)
+	}
+}
+
+// ActiveIDDetector devuelve el detector de NormalizePath, o nil si está deshabilitado
+func ActiveIDDetector() *IDDetector {
+	return defaultIDs.Load()
+}
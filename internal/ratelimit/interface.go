@@ -2,6 +2,7 @@ package ratelimit
 
 import (
 	"context"
+	"errors"
 )
 
 // Limiter es la interfaz común para todos los rate limiters
@@ -10,8 +11,61 @@ type Limiter interface {
 	Close() error
 }
 
+// Inspector lo implementan los limiters que permiten consultar y resetear
+// contadores sin consumir cupo (API de administración).
+// Peek devuelve en Remaining el cupo disponible antes del próximo request.
+type Inspector interface {
+	Peek(ctx context.Context, limits map[string]LimitConfig) (map[string]*LimitResult, error)
+	Reset(ctx context.Context, keys ...string) error
+}
+
+// ErrInspectNotSupported indica que el limiter no permite consultar ni resetear contadores
+var ErrInspectNotSupported = errors.New("rate limiter does not support inspection")
+
+// HealthChecker lo implementan los limiters que pueden verificar su backend
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
 // Asegurar que RedisLimiter implementa la interfaz
 var _ Limiter = (*RedisLimiter)(nil)
 
 // Asegurar que DummyLimiter implementa la interfaz  
 var _ Limiter = (*DummyLimiter)(nil)
+
+// Asegurar que TokenBucketLimiter implementa la interfaz
+var _ Limiter = (*TokenBucketLimiter)(nil)
+
+// Asegurar que GCRALimiter implementa la interfaz
+var _ Limiter = (*GCRALimiter)(nil)
+
+// Asegurar que SlidingWindowCounterLimiter implementa la interfaz
+var _ Limiter = (*SlidingWindowCounterLimiter)(nil)
+
+// Asegurar que MemoryLimiter implementa la interfaz
+var _ Limiter = (*MemoryLimiter)(nil)
+
+// Asegurar que ClusterLimiter implementa la interfaz
+var _ Limiter = (*ClusterLimiter)(nil)
+
+// Asegurar que SentinelLimiter implementa la interfaz
+var _ Limiter = (*SentinelLimiter)(nil)
+
+// Asegurar que CircuitBreakerLimiter implementa la interfaz
+var _ Limiter = (*CircuitBreakerLimiter)(nil)
+
+// Asegurar que los limiters sobre Redis exponen su cliente
+var (
+	_ RedisClientProvider = (*RedisLimiter)(nil)
+	_ RedisClientProvider = (*SentinelLimiter)(nil)
+	_ RedisClientProvider = (*ClusterLimiter)(nil)
+)
+
+// Asegurar que los limiters con estado permiten inspeccionarlo
+var (
+	_ Inspector = (*RedisLimiter)(nil)
+	_ Inspector = (*SentinelLimiter)(nil)
+	_ Inspector = (*ClusterLimiter)(nil)
+	_ Inspector = (*MemoryLimiter)(nil)
+	_ Inspector = (*CircuitBreakerLimiter)(nil)
+)
@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// LoadIPListFile lee una lista de IPs y CIDR en el formato de ips.csv
+func LoadIPListFile(filename string) ([]netip.Prefix, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read IP list file: %w", err)
+	}
+	return ParseIPList(filename, data)
+}
+
+// ParseIPList parsea una lista con una IP o CIDR por línea en la primera columna.
+// El header "ip", las líneas vacías y los comentarios (#) se ignoran. Devuelve
+// todos los errores con su número de línea; filename solo se usa en los errores.
+func ParseIPList(filename string, data []byte) ([]netip.Prefix, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	var prefixes []netip.Prefix
+	var errs []error
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+
+		value := strings.TrimSpace(record[0])
+		if value == "" || (first && strings.EqualFold(value, "ip")) {
+			continue
+		}
+
+		prefix, err := ParsePrefix(value)
+		if err != nil {
+			line, _ := reader.FieldPos(0)
+			errs = append(errs, &RuleError{File: filename, Line: line, Msg: err.Error()})
+			continue
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return prefixes, nil
+}
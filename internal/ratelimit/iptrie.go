@@ -0,0 +1,246 @@
+package ratelimit
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"net/netip"
+	"strings"
+)
+
+// IPTrie es un árbol radix (Patricia) de prefijos IPv4/IPv6 con búsqueda por
+// longest prefix match. Cada familia tiene su propio árbol: un prefijo IPv6 como
+// ::/0 no contiene IPv4. Las IPv4-mapped (::ffff:a.b.c.d) se tratan como IPv4,
+// tanto al insertar como al buscar. Una búsqueda recorre a lo sumo un nodo por
+// bit de diferencia, independiente de la cantidad de prefijos.
+//
+// No es seguro para escrituras concurrentes: se arma una vez y después solo se lee.
+type IPTrie[V any] struct {
+	v4, v6 *ipTrieNode[V]
+	size   int
+}
+
+// ipKey son los 128 bits de una dirección
+type ipKey struct {
+	hi, lo uint64
+}
+
+type ipTrieNode[V any] struct {
+	key      ipKey // bits del prefijo (el resto en cero)
+	bits     int   // largo del prefijo sobre 128 bits
+	children [2]*ipTrieNode[V]
+	value    V
+	set      bool // el nodo es un prefijo insertado y no solo una bifurcación
+}
+
+// NewIPTrie crea un árbol vacío
+func NewIPTrie[V any]() *IPTrie[V] {
+	return &IPTrie[V]{}
+}
+
+// Insert agrega una IP exacta o un CIDR; si el prefijo ya existe reemplaza el valor
+func (t *IPTrie[V]) Insert(cidr string, value V) error {
+	prefix, err := ParsePrefix(cidr)
+	if err != nil {
+		return err
+	}
+	t.InsertPrefix(prefix, value)
+	return nil
+}
+
+// InsertPrefix agrega un prefijo ya parseado
+func (t *IPTrie[V]) InsertPrefix(prefix netip.Prefix, value V) {
+	if addr := prefix.Addr(); addr.Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(addr.Unmap(), prefix.Bits()-96)
+	}
+	key, length := prefixKey(prefix)
+
+	link := t.rootFor(prefix.Addr())
+	for {
+		node := *link
+		if node == nil {
+			*link = &ipTrieNode[V]{key: key, bits: length, value: value, set: true}
+			t.size++
+			return
+		}
+
+		common := commonPrefixLen(node.key, key, minInt(node.bits, length))
+		if common == node.bits {
+			if length == node.bits {
+				if !node.set {
+					t.size++
+				}
+				node.value, node.set = value, true
+				return
+			}
+			link = &node.children[key.bit(node.bits)]
+			continue
+		}
+
+		// Los prefijos divergen antes del final del nodo: se agrega una bifurcación
+		split := &ipTrieNode[V]{key: key.mask(common), bits: common}
+		split.children[node.key.bit(common)] = node
+		if common == length {
+			split.value, split.set = value, true
+		} else {
+			split.children[key.bit(common)] = &ipTrieNode[V]{key: key, bits: length, value: value, set: true}
+		}
+		*link = split
+		t.size++
+		return
+	}
+}
+
+// Lookup devuelve el valor del prefijo más específico que contiene ip
+func (t *IPTrie[V]) Lookup(ip string) (V, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		var zero V
+		return zero, false
+	}
+	return t.LookupAddr(addr)
+}
+
+// LookupAddr es Lookup sin parsear la IP
+func (t *IPTrie[V]) LookupAddr(addr netip.Addr) (V, bool) {
+	if !addr.IsValid() {
+		var zero V
+		return zero, false
+	}
+	addr = addr.Unmap()
+	key := newIPKey(addr)
+
+	var best *ipTrieNode[V]
+	for node := *t.rootFor(addr); node != nil; {
+		if commonPrefixLen(node.key, key, node.bits) < node.bits {
+			break
+		}
+		if node.set {
+			best = node
+		}
+		if node.bits == 128 {
+			break
+		}
+		node = node.children[key.bit(node.bits)]
+	}
+
+	if best == nil {
+		var zero V
+		return zero, false
+	}
+	return best.value, true
+}
+
+// LookupAll devuelve los valores de todos los prefijos que contienen addr, del más
+// específico al menos específico
+func (t *IPTrie[V]) LookupAll(addr netip.Addr) []V {
+	if !addr.IsValid() {
+		return nil
+	}
+	addr = addr.Unmap()
+	key := newIPKey(addr)
+
+	var values []V
+	for node := *t.rootFor(addr); node != nil; {
+		if commonPrefixLen(node.key, key, node.bits) < node.bits {
+			break
+		}
+		if node.set {
+			values = append(values, node.value)
+		}
+		if node.bits == 128 {
+			break
+		}
+		node = node.children[key.bit(node.bits)]
+	}
+
+	for i, j := 0, len(values)-1; i < j; i, j = i+1, j-1 {
+		values[i], values[j] = values[j], values[i]
+	}
+	return values
+}
+
+// rootFor devuelve la raíz del árbol de la familia de addr (ya sin mapear)
+func (t *IPTrie[V]) rootFor(addr netip.Addr) **ipTrieNode[V] {
+	if addr.Is4() {
+		return &t.v4
+	}
+	return &t.v6
+}
+
+// Len devuelve la cantidad de prefijos insertados
+func (t *IPTrie[V]) Len() int {
+	return t.size
+}
+
+// ParsePrefix acepta una IP exacta (equivale a /32 o /128) o un CIDR
+func ParsePrefix(value string) (netip.Prefix, error) {
+	value = strings.TrimSpace(value)
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid CIDR %q", value)
+		}
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid IP %q", value)
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// prefixKey lleva el prefijo a 128 bits (IPv4 como IPv4-mapped, dentro de su propio árbol)
+func prefixKey(prefix netip.Prefix) (ipKey, int) {
+	length := prefix.Bits()
+	if prefix.Addr().Is4() {
+		length += 96
+	}
+	return newIPKey(prefix.Addr()).mask(length), length
+}
+
+func newIPKey(addr netip.Addr) ipKey {
+	b := addr.WithZone("").As16()
+	return ipKey{hi: binary.BigEndian.Uint64(b[:8]), lo: binary.BigEndian.Uint64(b[8:])}
+}
+
+// bit devuelve el bit i (0 = el más significativo)
+func (k ipKey) bit(i int) int {
+	if i < 64 {
+		return int(k.hi>>(63-uint(i))) & 1
+	}
+	return int(k.lo>>(127-uint(i))) & 1
+}
+
+// mask deja solo los primeros length bits
+func (k ipKey) mask(length int) ipKey {
+	switch {
+	case length <= 0:
+		return ipKey{}
+	case length < 64:
+		return ipKey{hi: k.hi &^ (^uint64(0) >> uint(length))}
+	case length < 128:
+		return ipKey{hi: k.hi, lo: k.lo &^ (^uint64(0) >> uint(length-64))}
+	default:
+		return k
+	}
+}
+
+// commonPrefixLen cuenta los bits iniciales iguales, hasta max
+func commonPrefixLen(a, b ipKey, max int) int {
+	n := 128
+	if x := a.hi ^ b.hi; x != 0 {
+		n = bits.LeadingZeros64(x)
+	} else if x := a.lo ^ b.lo; x != 0 {
+		n = 64 + bits.LeadingZeros64(x)
+	}
+	return minInt(n, max)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,106 @@
+package ratelimit
+
+import (
+	"net/http"
+	"time"
+)
+
+// RequestKeys es la identidad de un request para rate limiting: la IP del
+// cliente, el path normalizado, el método y la identidad de la credencial si
+// la hay. Todas las keys (ip, path, ip_path) salen de acá, así el mismo request
+// tiene las mismas keys en cualquier middleware.
+type RequestKeys struct {
+	IP     string
+	Path   string
+	Method string
+
+	// Identidad de la credencial (ver SetIdentityResolver) y su tier; vacía si
+	// el request no trae credencial y el límite es por IP
+	Identity string
+	Tier     string
+}
+
+// DeriveKeys obtiene la IP con ExtractIP, el path con NormalizePath y la
+// identidad con el resolver configurado. Con identidad por IP no hace
+// allocations; las keys se arman recién al pedirlas.
+func DeriveKeys(r *http.Request) RequestKeys {
+	return deriveKeys(r, NormalizePath(r.URL.Path))
+}
+
+// PreviewKeys es DeriveKeys sin registrar el path en la detección de IDs (ver
+// PreviewNormalizePath)
+func PreviewKeys(r *http.Request) RequestKeys {
+	return deriveKeys(r, PreviewNormalizePath(r.URL.Path))
+}
+
+func deriveKeys(r *http.Request, path string) RequestKeys {
+	k := RequestKeys{
+		IP:     ExtractIP(r),
+		Path:   path,
+		Method: r.Method,
+	}
+	if resolver := defaultIdentity.Load(); resolver != nil {
+		k.Identity, k.Tier = resolver.Identify(r)
+	}
+	return k
+}
+
+// IPKey devuelve la key del límite por cliente: client::<identidad> si hay
+// credencial, si no ip::<ip>
+func (k RequestKeys) IPKey() string {
+	if k.Identity != "" {
+		return ClientKey(k.Identity)
+	}
+	return IPKey(k.IP)
+}
+
+// PathKey devuelve la key del límite por path
+func (k RequestKeys) PathKey() string {
+	return PathKey(k.Path)
+}
+
+// IPPathKey devuelve la key del límite por cliente + path
+func (k RequestKeys) IPPathKey() string {
+	if k.Identity != "" {
+		return ClientPathKey(k.Identity, k.Path)
+	}
+	return IPPathKey(k.IP, k.Path)
+}
+
+// Client devuelve quién consume el cupo: la identidad de la credencial o la IP
+func (k RequestKeys) Client() string {
+	if k.Identity != "" {
+		return k.Identity
+	}
+	return k.IP
+}
+
+// QuotaKey devuelve la key de la cuota del cliente en el período que contiene now
+func (k RequestKeys) QuotaKey(period QuotaPeriod, now time.Time) string {
+	return QuotaKey(period, k.Client(), now)
+}
+
+// LimitKeys devuelve las keys por tipo (ip, path, ip_path), sin el método
+// (ver MethodKey)
+func (k RequestKeys) LimitKeys() map[string]string {
+	return map[string]string{
+		"ip":      k.IPKey(),
+		"path":    k.PathKey(),
+		"ip_path": k.IPPathKey(),
+	}
+}
+
+// MethodOther agrupa en un solo contador los métodos que no son estándar
+const MethodOther = "OTHER"
+
+// KeyMethod devuelve el método a usar en keys y labels: los métodos estándar tal
+// cual y el resto como MethodOther, para que inventar métodos no dé cupo nuevo ni
+// labels nuevos
+func KeyMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return MethodOther
+}
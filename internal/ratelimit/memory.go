@@ -0,0 +1,338 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMemoryShards   = 64
+	memoryCleanupInterval = 30 * time.Second
+)
+
+// MemoryLimiter implementa Limiter en memoria del proceso, sin Redis.
+// Pensado para deployments de una sola instancia y desarrollo local.
+//
+// Las keys se reparten en shards con su propio mutex para reducir contención
+// y cada entrada expira cuando su estado equivale a "sin requests".
+// El sliding window log se aproxima con sliding window counter para que la
+// memoria sea O(1) por key; token bucket, GCRA y fixed window se implementan exactos.
+type MemoryLimiter struct {
+	shards    []*memoryShard
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+type memoryShard struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+// memoryEntry guarda el estado de una key; los tiempos son milisegundos
+type memoryEntry struct {
+	start     float64 // inicio de la ventana fija actual (counter)
+	cur       float64 // también el contador de fixed window
+	prev      float64
+	tokens    float64 // token bucket
+	ts        float64
+	tat       float64 // GCRA
+	expiresAt float64
+}
+
+// memoryDecision es el resultado de evaluar una key y el estado a guardar si se registra
+type memoryDecision struct {
+	allowed    bool
+	remaining  int
+	resetAfter float64
+	retryAfter float64
+	next       memoryEntry
+}
+
+// NewMemoryLimiter crea un limiter en memoria con shards particiones
+// (si shards <= 0 se usa el default)
+func NewMemoryLimiter(shards int) *MemoryLimiter {
+	if shards <= 0 {
+		shards = defaultMemoryShards
+	}
+
+	ml := &MemoryLimiter{
+		shards: make([]*memoryShard, shards),
+		stop:   make(chan struct{}),
+	}
+	for i := range ml.shards {
+		ml.shards[i] = &memoryShard{entries: make(map[string]*memoryEntry)}
+	}
+
+	// Limpieza periódica de keys expiradas
+	go ml.cleanup()
+
+	return ml
+}
+
+// CheckLimit verifica una única key
+func (ml *MemoryLimiter) CheckLimit(ctx context.Context, key string, config LimitConfig) (*LimitResult, error) {
+	results, err := ml.CheckMultipleLimits(ctx, map[string]LimitConfig{key: config})
+	if err != nil {
+		return nil, err
+	}
+	return results[key], nil
+}
+
+// CheckMultipleLimits verifica todas las keys y registra el request solo si
+// todas lo permiten, igual que el script multi-key de Redis
+func (ml *MemoryLimiter) CheckMultipleLimits(ctx context.Context, limits map[string]LimitConfig) (map[string]*LimitResult, error) {
+	for key, config := range limits {
+		if config.Limit <= 0 || config.Window <= 0 {
+			return nil, fmt.Errorf("invalid limit config for key %s: limit=%d window=%s", key, config.Limit, config.Window)
+		}
+	}
+
+	// Bloquear los shards involucrados en orden para evitar deadlocks
+	shardIdx := make([]int, 0, len(limits))
+	seen := make(map[int]bool, len(limits))
+	for key := range limits {
+		idx := ml.shardIndex(key)
+		if !seen[idx] {
+			seen[idx] = true
+			shardIdx = append(shardIdx, idx)
+		}
+	}
+	sort.Ints(shardIdx)
+	for _, idx := range shardIdx {
+		ml.shards[idx].mu.Lock()
+	}
+	defer func() {
+		for _, idx := range shardIdx {
+			ml.shards[idx].mu.Unlock()
+		}
+	}()
+
+	now := time.Now()
+	nowMs := float64(now.UnixNano()) / float64(time.Millisecond)
+
+	decisions := make(map[string]memoryDecision, len(limits))
+	allAllowed := true
+	for key, config := range limits {
+		entry := ml.shards[ml.shardIndex(key)].entries[key]
+		if entry != nil && entry.expiresAt <= nowMs {
+			entry = nil
+		}
+
+		decision := evalMemory(entry, config, nowMs)
+		if !decision.allowed {
+			allAllowed = false
+		}
+		decisions[key] = decision
+	}
+
+	results := make(map[string]*LimitResult, len(limits))
+	for key, decision := range decisions {
+		if allAllowed {
+			next := decision.next
+			ml.shards[ml.shardIndex(key)].entries[key] = &next
+		}
+
+		results[key] = &LimitResult{
+			Allowed:    decision.allowed,
+			Remaining:  decision.remaining,
+			ResetTime:  now.Add(msToDuration(decision.resetAfter)),
+			RetryAfter: msToDuration(decision.retryAfter),
+		}
+	}
+
+	return results, nil
+}
+
+// Peek devuelve el estado de las keys sin registrar un request
+func (ml *MemoryLimiter) Peek(ctx context.Context, limits map[string]LimitConfig) (map[string]*LimitResult, error) {
+	now := time.Now()
+	nowMs := float64(now.UnixNano()) / float64(time.Millisecond)
+
+	results := make(map[string]*LimitResult, len(limits))
+	for key, config := range limits {
+		if config.Limit <= 0 || config.Window <= 0 {
+			return nil, fmt.Errorf("invalid limit config for key %s: limit=%d window=%s", key, config.Limit, config.Window)
+		}
+
+		shard := ml.shards[ml.shardIndex(key)]
+		shard.mu.Lock()
+		entry := shard.entries[key]
+		if entry != nil && entry.expiresAt <= nowMs {
+			entry = nil
+		}
+		decision := evalMemory(entry, config, nowMs)
+		shard.mu.Unlock()
+
+		// evalMemory descuenta el request que se registraría
+		remaining := decision.remaining
+		if decision.allowed {
+			remaining++
+		}
+		results[key] = &LimitResult{
+			Allowed:    decision.allowed,
+			Remaining:  remaining,
+			ResetTime:  now.Add(msToDuration(decision.resetAfter)),
+			RetryAfter: msToDuration(decision.retryAfter),
+		}
+	}
+	return results, nil
+}
+
+// Reset borra los contadores de las keys
+func (ml *MemoryLimiter) Reset(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		shard := ml.shards[ml.shardIndex(key)]
+		shard.mu.Lock()
+		delete(shard.entries, key)
+		shard.mu.Unlock()
+	}
+	return nil
+}
+
+// Close detiene la limpieza periódica
+func (ml *MemoryLimiter) Close() error {
+	ml.closeOnce.Do(func() {
+		close(ml.stop)
+	})
+	return nil
+}
+
+// Len devuelve la cantidad de keys en memoria (incluye expiradas aún no limpiadas)
+func (ml *MemoryLimiter) Len() int {
+	total := 0
+	for _, shard := range ml.shards {
+		shard.mu.Lock()
+		total += len(shard.entries)
+		shard.mu.Unlock()
+	}
+	return total
+}
+
+func (ml *MemoryLimiter) shardIndex(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(ml.shards)))
+}
+
+func (ml *MemoryLimiter) cleanup() {
+	ticker := time.NewTicker(memoryCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ml.stop:
+			return
+		case <-ticker.C:
+			nowMs := float64(time.Now().UnixNano()) / float64(time.Millisecond)
+			for _, shard := range ml.shards {
+				shard.mu.Lock()
+				for key, entry := range shard.entries {
+					if entry.expiresAt <= nowMs {
+						delete(shard.entries, key)
+					}
+				}
+				shard.mu.Unlock()
+			}
+		}
+	}
+}
+
+// evalMemory replica en Go la lógica del script multi-key de Redis.
+// entry es nil si la key no existe o expiró.
+func evalMemory(entry *memoryEntry, config LimitConfig, now float64) memoryDecision {
+	limit := float64(config.Limit)
+	window := float64(config.Window) / float64(time.Millisecond)
+	burst := float64(config.Burst)
+	if burst <= 0 {
+		burst = limit
+	}
+
+	var d memoryDecision
+
+	switch config.Algorithm {
+	case AlgorithmTokenBucket:
+		rate := limit / window
+		tokens := burst
+		if entry != nil {
+			tokens = math.Min(burst, entry.tokens+math.Max(0, now-entry.ts)*rate)
+		}
+		d.allowed = tokens >= 1
+		if d.allowed {
+			tokens--
+			d.remaining = int(math.Floor(tokens))
+		} else {
+			d.retryAfter = (1 - tokens) / rate
+		}
+		d.resetAfter = (burst - tokens) / rate
+		d.next = memoryEntry{tokens: tokens, ts: now, expiresAt: now + d.resetAfter + 1000}
+
+	case AlgorithmGCRA:
+		emission := window / limit
+		tolerance := emission * burst
+		tat := now
+		if entry != nil && entry.tat > now {
+			tat = entry.tat
+		}
+		newTat := tat + emission
+		allowAt := newTat - tolerance
+		d.allowed = now >= allowAt
+		if d.allowed {
+			d.resetAfter = newTat - now
+			d.remaining = int(math.Floor((tolerance - (newTat - now)) / emission))
+		} else {
+			d.retryAfter = allowAt - now
+			d.resetAfter = tat - now
+		}
+		d.next = memoryEntry{tat: newTat, expiresAt: newTat}
+
+	case AlgorithmFixedWindow:
+		count, expiresAt := 0.0, now+window
+		if entry != nil {
+			count, expiresAt = entry.cur, entry.expiresAt
+		}
+		d.allowed = count+1 <= limit
+		d.resetAfter = expiresAt - now
+		if d.allowed {
+			d.remaining = int(limit - count - 1)
+		} else {
+			d.retryAfter = d.resetAfter
+		}
+		d.next = memoryEntry{cur: count + 1, expiresAt: expiresAt}
+
+	default:
+		// sliding_window y sliding_window_counter: dos buckets fijos ponderados
+		curStart := math.Floor(now/window) * window
+		var cur, prev float64
+		if entry != nil {
+			switch entry.start {
+			case curStart:
+				cur, prev = entry.cur, entry.prev
+			case curStart - window:
+				prev = entry.cur
+			}
+		}
+		elapsed := now - curStart
+		estimate := prev*((window-elapsed)/window) + cur
+		d.allowed = estimate+1 <= limit
+		d.resetAfter = window - elapsed
+		if d.allowed {
+			d.remaining = int(math.Floor(limit - estimate - 1))
+		} else if cur+1 > limit {
+			d.retryAfter = (window - elapsed) + math.Max(0, window-(limit-1)*window/cur)
+		} else {
+			d.retryAfter = math.Max(0, window-elapsed-(limit-1-cur)*window/prev)
+		}
+		d.next = memoryEntry{start: curStart, cur: cur + 1, prev: prev, expiresAt: now + 2*window}
+	}
+
+	return d
+}
+
+func msToDuration(ms float64) time.Duration {
+	return time.Duration(math.Ceil(ms * float64(time.Millisecond)))
+}
@@ -69,13 +69,20 @@ func (lc *LocalCache) cleanup() {
 	}
 }
 
-// OptimizedRedisLimiter con cache local para alta carga
+// OptimizedRedisLimiter con cache local para alta carga.
+//
+// Deprecated: no aplica RATE_LIMIT_FAIL_POLICY (si Redis falla siempre permite
+// el request) y el proxy no lo usa. Usar RedisLimiter detrás de
+// RateLimitMiddleware.
 type OptimizedRedisLimiter struct {
 	*RedisLimiter
 	localCache *LocalCache
 	logger     *zap.Logger
 }
 
+// NewOptimizedRedisLimiter crea un OptimizedRedisLimiter.
+//
+// Deprecated: ver OptimizedRedisLimiter.
 func NewOptimizedRedisLimiter(redisURL string, logger *zap.Logger) (*OptimizedRedisLimiter, error) {
 	baseLimiter, err := NewRedisLimiter(redisURL)
 	if err != nil {
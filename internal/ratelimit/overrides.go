@@ -0,0 +1,333 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultOverridesKey es el hash de Redis con las reglas de override
+	DefaultOverridesKey = "meli_proxy:overrides"
+	// Resincronización completa por si se perdió algún mensaje de pub/sub
+	overridesResyncInterval = 30 * time.Second
+)
+
+// RedisClientProvider lo implementan los limiters que exponen su cliente Redis
+type RedisClientProvider interface {
+	RedisClient() redis.UniversalClient
+}
+
+// OverrideStore mantiene reglas de override compartidas por todas las instancias.
+// Las reglas viven en un hash de Redis (id -> regla en JSON/YAML) y cada cambio
+// se anuncia en el canal <key>:changed para que todas las instancias recarguen.
+// Los overrides tienen prioridad sobre el archivo de reglas y se evalúan
+// ordenados por id.
+//
+// Los overrides temporales guardan su vencimiento en el sorted set <key>:expires
+// (score = unix ms). Cada instancia los deja de aplicar al vencer y los borra.
+type OverrideStore struct {
+	client     redis.UniversalClient
+	key        string
+	expiresKey string
+	channel    string
+	apply      func([]Rule)
+	logger     *zap.Logger
+
+	mu          sync.Mutex
+	version     [sha256.Size]byte
+	nextExpiry  time.Time     // vencimiento más próximo de los overrides cargados
+	rescheduled chan struct{} // avisa a watch que cambió nextExpiry
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewOverrideStore crea el store sobre el hash key (si es vacío se usa DefaultOverridesKey)
+func NewOverrideStore(client redis.UniversalClient, key string, apply func([]Rule), logger *zap.Logger) *OverrideStore {
+	if key == "" {
+		key = DefaultOverridesKey
+	}
+	return &OverrideStore{
+		client:      client,
+		key:         key,
+		expiresKey:  key + ":expires",
+		channel:     key + ":changed",
+		apply:       apply,
+		logger:      logger,
+		rescheduled: make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// Start carga los overrides actuales y escucha cambios en background.
+// Si la carga inicial falla se devuelve el error pero la escucha sigue activa.
+func (s *OverrideStore) Start(ctx context.Context) error {
+	// Suscribirse antes de cargar para no perder cambios entre ambos pasos
+	pubsub := s.client.Subscribe(context.Background(), s.channel)
+	go s.watch(pubsub)
+
+	return s.Reload(ctx)
+}
+
+// Stop deja de escuchar cambios
+func (s *OverrideStore) Stop() {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		<-s.done
+	})
+}
+
+// Reload lee todo el hash y aplica los overrides válidos y vigentes.
+// Los inválidos se ignoran con un warning para no bloquear al resto.
+func (s *OverrideStore) Reload(ctx context.Context) error {
+	now := time.Now()
+	if err := s.deleteExpired(ctx, now); err != nil {
+		return err
+	}
+
+	entries, err := s.client.HGetAll(ctx, s.key).Result()
+	if err != nil {
+		return fmt.Errorf("failed to load rate limit overrides: %w", err)
+	}
+	expiries, err := s.client.ZRangeWithScores(ctx, s.expiresKey, 0, -1).Result()
+	if err != nil {
+		return fmt.Errorf("failed to load rate limit override expirations: %w", err)
+	}
+	expiresAt := make(map[string]time.Time, len(expiries))
+	for _, z := range expiries {
+		if id, ok := z.Member.(string); ok {
+			expiresAt[id] = time.UnixMilli(int64(z.Score))
+		}
+	}
+
+	ids := make([]string, 0, len(entries))
+	for id := range entries {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	hash := sha256.New()
+	rules := make([]Rule, 0, len(ids))
+	var nextExpiry time.Time
+	for _, id := range ids {
+		expiry := expiresAt[id]
+		if !expiry.IsZero() && !expiry.After(now) {
+			continue
+		}
+		hash.Write([]byte(id + "\x00" + entries[id] + "\x00" + expiry.String() + "\x00"))
+
+		rule, err := ParseOverride(id, []byte(entries[id]))
+		if err != nil {
+			s.logger.Warn("ignoring invalid rate limit override",
+				zap.String("id", id),
+				zap.Error(err))
+			continue
+		}
+		rule.ExpiresAt = expiry
+		if !expiry.IsZero() && (nextExpiry.IsZero() || expiry.Before(nextExpiry)) {
+			nextExpiry = expiry
+		}
+		rules = append(rules, rule)
+	}
+
+	var version [sha256.Size]byte
+	copy(version[:], hash.Sum(nil))
+
+	s.mu.Lock()
+	changed := version != s.version
+	s.version = version
+	s.nextExpiry = nextExpiry
+	s.mu.Unlock()
+
+	select {
+	case s.rescheduled <- struct{}{}:
+	default:
+	}
+
+	s.apply(rules)
+	if changed {
+		s.logger.Info("rate limit overrides loaded", zap.Int("overrides", len(rules)))
+	}
+	return nil
+}
+
+// Set valida y guarda un override, y avisa a todas las instancias.
+// Con ttl > 0 el override vence solo; con ttl = 0 es permanente.
+func (s *OverrideStore) Set(ctx context.Context, id string, data []byte, ttl time.Duration) error {
+	if _, err := ParseOverride(id, data); err != nil {
+		return err
+	}
+	if ttl < 0 {
+		return fmt.Errorf("override %q: ttl must not be negative", id)
+	}
+
+	// Sin MULTI: en Redis Cluster el hash y el sorted set pueden estar en slots distintos
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, s.key, id, string(data))
+		if ttl > 0 {
+			pipe.ZAdd(ctx, s.expiresKey, &redis.Z{Score: float64(time.Now().Add(ttl).UnixMilli()), Member: id})
+		} else {
+			pipe.ZRem(ctx, s.expiresKey, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store rate limit override: %w", err)
+	}
+	return s.publish(ctx, id)
+}
+
+// Delete elimina un override y avisa a todas las instancias
+func (s *OverrideStore) Delete(ctx context.Context, id string) error {
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, s.key, id)
+		pipe.ZRem(ctx, s.expiresKey, id)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete rate limit override: %w", err)
+	}
+	return s.publish(ctx, id)
+}
+
+// deleteExpired borra los overrides vencidos. Todas las instancias lo hacen al
+// vencer el override; el borrado es idempotente.
+func (s *OverrideStore) deleteExpired(ctx context.Context, now time.Time) error {
+	expired, err := s.client.ZRangeByScore(ctx, s.expiresKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("failed to load rate limit override expirations: %w", err)
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+
+	members := make([]interface{}, len(expired))
+	for i, id := range expired {
+		members[i] = id
+	}
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, s.key, expired...)
+		pipe.ZRem(ctx, s.expiresKey, members...)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete expired rate limit overrides: %w", err)
+	}
+
+	s.logger.Info("rate limit overrides expired", zap.Strings("ids", expired))
+	return nil
+}
+
+func (s *OverrideStore) publish(ctx context.Context, id string) error {
+	if err := s.client.Publish(ctx, s.channel, id).Err(); err != nil {
+		return fmt.Errorf("failed to publish rate limit override change: %w", err)
+	}
+	return nil
+}
+
+// watch recarga ante cada mensaje del canal, al vencer un override y
+// periódicamente como resguardo
+func (s *OverrideStore) watch(pubsub *redis.PubSub) {
+	defer close(s.done)
+	defer pubsub.Close()
+
+	ticker := time.NewTicker(overridesResyncInterval)
+	defer ticker.Stop()
+
+	expiry := time.NewTimer(0)
+	<-expiry.C
+	defer expiry.Stop()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			s.logger.Debug("rate limit override changed", zap.String("id", msg.Payload))
+			s.resync()
+		case <-ticker.C:
+			s.resync()
+		case <-expiry.C:
+			s.resync()
+		case <-s.rescheduled:
+			s.mu.Lock()
+			next := s.nextExpiry
+			s.mu.Unlock()
+
+			if !expiry.Stop() {
+				select {
+				case <-expiry.C:
+				default:
+				}
+			}
+			if !next.IsZero() {
+				expiry.Reset(time.Until(next))
+			}
+		}
+	}
+}
+
+func (s *OverrideStore) resync() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := s.Reload(ctx); err != nil {
+		s.logger.Warn("rate limit overrides reload failed, keeping previous overrides", zap.Error(err))
+	}
+}
+
+// ParseOverride valida un override en JSON o YAML con el mismo formato que una
+// regla del archivo de reglas, incluidos los campos desconocidos. Si no tiene
+// nombre se usa el id.
+func ParseOverride(id string, data []byte) (Rule, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return Rule{}, fmt.Errorf("override %q: %w", id, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return Rule{}, fmt.Errorf("override %q: rule must be a mapping", id)
+	}
+	node := doc.Content[0]
+
+	var msgs []string
+	fail := func(line int, format string, args ...interface{}) {
+		msgs = append(msgs, fmt.Sprintf(format, args...))
+	}
+	checkRuleFields(node, fail)
+	if len(msgs) > 0 {
+		return Rule{}, fmt.Errorf("override %q: %s", id, strings.Join(msgs, "; "))
+	}
+
+	var spec ruleSpec
+	if err := node.Decode(&spec); err != nil {
+		return Rule{}, fmt.Errorf("override %q: %w", id, err)
+	}
+	if spec.Name == "" {
+		spec.Name = id
+	}
+
+	rule, msgs := buildRule(spec, 0)
+	if len(msgs) > 0 {
+		return Rule{}, fmt.Errorf("override %q: %s", id, strings.Join(msgs, "; "))
+	}
+	return rule, nil
+}
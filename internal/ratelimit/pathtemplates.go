@@ -0,0 +1,179 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// Templates que siempre están activos: equivalen a la normalización original
+// (/categories/MLA1234/attributes -> /categories/*)
+var builtinPathTemplates = []string{
+	"/categories/{id}/**",
+	"/items/{id}/**",
+	"/users/{id}/**",
+	"/sites/{site}/**",
+}
+
+// PathNormalizer agrupa paths con IDs en patrones a partir de templates como
+// /orders/{id} o /sites/{site}/search. Cada segmento {nombre} (o *) coincide
+// con un segmento no vacío y se reemplaza por *; un ** final coincide con
+// cualquier resto y se descarta. Los templates se guardan en un trie por
+// segmento: un segmento literal gana sobre un parámetro y éste sobre **, así
+// /sites/MLA/search -> /sites/*/search aunque exista /sites/{site}/**.
+//
+// Es de solo lectura una vez armado y Normalize no hace allocations.
+type PathNormalizer struct {
+	root      *pathNode
+	templates []string
+}
+
+type pathNode struct {
+	literals map[string]*pathNode
+	param    *pathNode
+	pattern  string // patrón si un template termina en este nodo
+	catchAll string // patrón de un template que termina en /** en este nodo
+}
+
+// NewPathNormalizer arma el trie con los templates integrados más los indicados
+func NewPathNormalizer(templates []string) (*PathNormalizer, error) {
+	n := &PathNormalizer{root: &pathNode{}}
+	for _, template := range builtinPathTemplates {
+		if err := n.add(template); err != nil {
+			return nil, err
+		}
+	}
+	for _, template := range templates {
+		if err := n.add(template); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// Templates devuelve los templates activos, empezando por los integrados
+func (n *PathNormalizer) Templates() []string {
+	return n.templates
+}
+
+func (n *PathNormalizer) add(template string) error {
+	template = strings.TrimSpace(template)
+	if !strings.HasPrefix(template, "/") {
+		return fmt.Errorf("invalid path template %q: must start with /", template)
+	}
+
+	node := n.root
+	var pattern strings.Builder
+	segments := strings.Split(strings.TrimSuffix(template[1:], "/"), "/")
+	for i, segment := range segments {
+		switch {
+		case segment == "**":
+			if i != len(segments)-1 {
+				return fmt.Errorf("invalid path template %q: ** must be the last segment", template)
+			}
+			node.catchAll = patternOrRoot(pattern.String())
+			n.templates = append(n.templates, template)
+			return nil
+		case segment == "*" || (strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") && len(segment) > 2):
+			if node.param == nil {
+				node.param = &pathNode{}
+			}
+			node = node.param
+			pattern.WriteString("/*")
+		case segment == "" && len(segments) == 1:
+			// Template "/": solo el path raíz
+		case segment == "" || strings.ContainsAny(segment, "{}*"):
+			return fmt.Errorf("invalid path template %q: invalid segment %q", template, segment)
+		default:
+			if node.literals == nil {
+				node.literals = make(map[string]*pathNode)
+			}
+			child, ok := node.literals[segment]
+			if !ok {
+				child = &pathNode{}
+				node.literals[segment] = child
+			}
+			node = child
+			pattern.WriteString("/" + segment)
+		}
+	}
+
+	node.pattern = patternOrRoot(pattern.String())
+	n.templates = append(n.templates, template)
+	return nil
+}
+
+func patternOrRoot(pattern string) string {
+	if pattern == "" {
+		return "/"
+	}
+	return pattern
+}
+
+// Normalize devuelve el patrón del template más específico que coincide con
+// path, o path sin cambios si ninguno coincide. path ya viene sin query ni "/" final.
+func (n *PathNormalizer) Normalize(path string) string {
+	if pattern, ok := n.lookup(path); ok {
+		return pattern
+	}
+	return path
+}
+
+func (n *PathNormalizer) lookup(path string) (string, bool) {
+	if !strings.HasPrefix(path, "/") {
+		return "", false
+	}
+	return n.root.match(path[1:], len(path) == 1)
+}
+
+// match recorre rest (segmentos sin el "/" inicial); done indica que no quedan
+// segmentos. Prueba literal, después parámetro y por último **.
+func (node *pathNode) match(rest string, done bool) (string, bool) {
+	if done {
+		if node.pattern != "" {
+			return node.pattern, true
+		}
+		return node.catchAll, node.catchAll != ""
+	}
+
+	segment, next, more := strings.Cut(rest, "/")
+	if child, ok := node.literals[segment]; ok {
+		if pattern, ok := child.match(next, !more); ok {
+			return pattern, true
+		}
+	}
+	if node.param != nil && segment != "" {
+		if pattern, ok := node.param.match(next, !more); ok {
+			return pattern, true
+		}
+	}
+	return node.catchAll, node.catchAll != ""
+}
+
+// builtinPaths es el normalizer de NormalizePath si no se configuraron templates
+var builtinPaths, _ = NewPathNormalizer(nil)
+
+// defaultPaths es el normalizer que usa NormalizePath
+var defaultPaths atomic.Pointer[PathNormalizer]
+
+// SetPathTemplates agrega templates de normalización a los integrados para NormalizePath
+func SetPathTemplates(templates []string) error {
+	normalizer, err := NewPathNormalizer(templates)
+	if err != nil {
+		return err
+	}
+	defaultPaths.Store(normalizer)
+	return nil
+}
+
+// PathTemplates devuelve los templates que usa NormalizePath
+func PathTemplates() []string {
+	return pathNormalizer().Templates()
+}
+
+func pathNormalizer() *PathNormalizer {
+	if normalizer := defaultPaths.Load(); normalizer != nil {
+		return normalizer
+	}
+	return builtinPaths
+}
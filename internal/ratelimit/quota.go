@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"strings"
+	"time"
+)
+
+// QuotaPeriod es el horizonte de una cuota. Las cuotas son ventanas fijas de
+// calendario en UTC: la diaria se reinicia a las 00:00 y la mensual el día 1.
+type QuotaPeriod string
+
+const (
+	QuotaDaily   QuotaPeriod = "day"
+	QuotaMonthly QuotaPeriod = "month"
+)
+
+// QuotaPeriods son los períodos soportados, del más corto al más largo
+var QuotaPeriods = []QuotaPeriod{QuotaDaily, QuotaMonthly}
+
+// quotaKeyPrefix identifica las keys de cuotas
+const quotaKeyPrefix = "quota:"
+
+// bounds devuelve el identificador del período que contiene now y cuándo termina
+func (p QuotaPeriod) bounds(now time.Time) (string, time.Time) {
+	now = now.UTC()
+	year, month, day := now.Date()
+	if p == QuotaMonthly {
+		return now.Format("200601"), time.Date(year, month+1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return now.Format("20060102"), time.Date(year, month, day+1, 0, 0, 0, 0, time.UTC)
+}
+
+// Length devuelve la duración del período que contiene now: un día o el mes completo
+func (p QuotaPeriod) Length(now time.Time) time.Duration {
+	_, end := p.bounds(now)
+	if p == QuotaMonthly {
+		return end.Sub(end.AddDate(0, -1, 0))
+	}
+	return 24 * time.Hour
+}
+
+// QuotaKey devuelve la key de la cuota del cliente en el período actual:
+// quota:day:20261016::<cliente>. El período va en el tipo, así cada día o mes
+// empieza con una key nueva y el hash tag de Redis Cluster sigue siendo el cliente.
+func QuotaKey(period QuotaPeriod, client string, now time.Time) string {
+	id, _ := period.bounds(now)
+	return quotaKeyPrefix + string(period) + ":" + id + "::" + client
+}
+
+// IsQuotaKey indica si la key es de una cuota y no de un límite de corto plazo
+func IsQuotaKey(key string) bool {
+	return strings.HasPrefix(key, quotaKeyPrefix)
+}
+
+// QuotaConfig devuelve la configuración de una cuota: un contador fijo que
+// vence al terminar el período actual
+func QuotaConfig(period QuotaPeriod, limit int, now time.Time) LimitConfig {
+	_, end := period.bounds(now)
+	window := end.Sub(now)
+	if window < time.Millisecond {
+		window = time.Millisecond
+	}
+	return LimitConfig{Limit: limit, Window: window, Algorithm: AlgorithmFixedWindow}
+}
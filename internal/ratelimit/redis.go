@@ -3,6 +3,7 @@ package ratelimit
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -10,32 +11,8 @@ import (
 
 type RedisLimiter struct {
 	client *redis.Client
-	script *redis.Script
 }
 
-// Script Lua para sliding window atómico
-const slidingWindowScript = `
-local key = KEYS[1]
-local window = tonumber(ARGV[1])
-local limit = tonumber(ARGV[2])
-local now = tonumber(ARGV[3])
-
--- Limpiar registros antiguos
-redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window * 1000)
-
--- Contar requests actuales
-local current = redis.call('ZCARD', key)
-
-if current < limit then
-    -- Agregar el request actual
-    redis.call('ZADD', key, now, now)
-    redis.call('EXPIRE', key, window + 1)
-    return {1, limit - current - 1}
-else
-    return {0, 0}
-end
-`
-
 func NewRedisLimiter(redisURL string) (*RedisLimiter, error) {
 	opts, err := redis.ParseURL(redisURL)
 	if err != nil {
@@ -54,10 +31,19 @@ func NewRedisLimiter(redisURL string) (*RedisLimiter, error) {
 
 	return &RedisLimiter{
 		client: client,
-		script: redis.NewScript(slidingWindowScript),
 	}, nil
 }
 
+// HealthCheck verifica la conexión con Redis
+func (rl *RedisLimiter) HealthCheck(ctx context.Context) error {
+	return rl.client.Ping(ctx).Err()
+}
+
+// RedisClient devuelve el cliente Redis del limiter
+func (rl *RedisLimiter) RedisClient() redis.UniversalClient {
+	return rl.client
+}
+
 func (rl *RedisLimiter) Close() error {
 	return rl.client.Close()
 }
@@ -66,70 +52,102 @@ type LimitResult struct {
 	Allowed   bool
 	Remaining int
 	ResetTime time.Time
+	// RetryAfter es el tiempo exacto hasta el próximo request permitido
+	// cuando el algoritmo lo conoce (0 si no aplica o si fue permitido)
+	RetryAfter time.Duration
 }
 
+// CheckLimit verifica una key con sliding window log (ZSET)
 func (rl *RedisLimiter) CheckLimit(ctx context.Context, key string, limit int, window time.Duration) (*LimitResult, error) {
-	now := time.Now().UnixMilli()
-	windowSeconds := int(window.Seconds())
-
-	result, err := rl.script.Run(ctx, rl.client, []string{key}, windowSeconds, limit, now).Result()
+	results, err := evalLimits(ctx, rl.client, []limitCheck{
+		{key: key, config: LimitConfig{Limit: limit, Window: window, Algorithm: AlgorithmSlidingWindow}},
+	})
 	if err != nil {
-		return nil, fmt.Errorf("rate limit check failed: %w", err)
-	}
-
-	results, ok := result.([]interface{})
-	if !ok || len(results) != 2 {
-		return nil, fmt.Errorf("unexpected redis script result")
-	}
-
-	allowed, ok := results[0].(int64)
-	if !ok {
-		return nil, fmt.Errorf("invalid allowed result from redis")
-	}
-
-	remaining, ok := results[1].(int64)
-	if !ok {
-		return nil, fmt.Errorf("invalid remaining result from redis")
+		return nil, err
 	}
+	return results[0], nil
+}
 
-	resetTime := time.Now().Add(window)
+// Método para múltiples límites (IP, Path, IP+Path).
+// Todas las keys se verifican en un único script atómico, cada una con su
+// algoritmo, y el request solo se registra si todas lo permiten.
+func (rl *RedisLimiter) CheckMultipleLimits(ctx context.Context, limits map[string]LimitConfig) (map[string]*LimitResult, error) {
+	return evalLimitMap(ctx, rl.client, limits, "")
+}
 
-	return &LimitResult{
-		Allowed:   allowed == 1,
-		Remaining: int(remaining),
-		ResetTime: resetTime,
-	}, nil
+// Peek devuelve el estado de las keys sin registrar un request
+func (rl *RedisLimiter) Peek(ctx context.Context, limits map[string]LimitConfig) (map[string]*LimitResult, error) {
+	return peekLimitMap(ctx, rl.client, limits)
 }
 
-// Método para múltiples límites (IP, Path, IP+Path)
-func (rl *RedisLimiter) CheckMultipleLimits(ctx context.Context, limits map[string]LimitConfig) (map[string]*LimitResult, error) {
-	results := make(map[string]*LimitResult)
-
-	for key, config := range limits {
-		result, err := rl.CheckLimit(ctx, key, config.Limit, config.Window)
-		if err != nil {
-			return nil, fmt.Errorf("failed to check limit for key %s: %w", key, err)
-		}
-		results[key] = result
+// Reset borra los contadores de las keys
+func (rl *RedisLimiter) Reset(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
 	}
-
-	return results, nil
+	return rl.client.Del(ctx, keys...).Err()
 }
 
 type LimitConfig struct {
-	Limit  int
-	Window time.Duration
+	Limit     int
+	Window    time.Duration
+	Algorithm Algorithm // Vacío equivale a AlgorithmSlidingWindow
+	Burst     int       // Capacidad del token bucket / tolerancia GCRA (0 = Limit)
 }
 
 // Funciones helper para generar keys
 func IPKey(ip string) string {
-	return fmt.Sprintf("ip::%s", ip)
+	return "ip::" + ip
 }
 
 func PathKey(path string) string {
-	return fmt.Sprintf("path::%s", path)
+	return "path::" + path
 }
 
 func IPPathKey(ip, path string) string {
-	return fmt.Sprintf("ip_path::%s::%s", ip, path)
+	return "ip_path::" + ip + "::" + path
+}
+
+// ClientKey y ClientPathKey reemplazan a IPKey e IPPathKey cuando el request
+// trae una credencial (ver IdentityResolver)
+func ClientKey(identity string) string {
+	return "client::" + identity
+}
+
+func ClientPathKey(identity, path string) string {
+	return "client_path::" + identity + "::" + path
+}
+
+// MethodKey agrega el método HTTP al tipo de una key, para que cada método
+// tenga su propio contador: ip_path::<ip>::<path> -> ip_path:POST::<ip>::<path>.
+// La identidad no cambia, así que ClusterHashTag devuelve el mismo hash tag.
+func MethodKey(key, method string) string {
+	idx := strings.Index(key, "::")
+	if idx < 0 || method == "" {
+		return key
+	}
+	return key[:idx] + ":" + method + key[idx:]
+}
+
+// WindowKey agrega la ventana al tipo de una key para las ventanas apiladas de una
+// regla: ip::<ip> con 1s -> ip:1s::<ip>. Cada ventana tiene su contador y todas
+// comparten el hash tag de la key original.
+func WindowKey(key string, window time.Duration) string {
+	idx := strings.Index(key, "::")
+	if idx < 0 {
+		return key
+	}
+	return key[:idx] + ":" + FormatWindow(window) + key[idx:]
+}
+
+// FormatWindow escribe la ventana sin ceros de sobra: 1m en vez de 1m0s
+func FormatWindow(window time.Duration) string {
+	s := window.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
 }
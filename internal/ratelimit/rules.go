@@ -0,0 +1,426 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scopes de una regla: qué contador configura
+const (
+	ScopeIP     = "ip"
+	ScopePath   = "path"
+	ScopeIPPath = "ip_path"
+)
+
+// Rule es una regla declarativa de rate limiting cargada desde el archivo de reglas.
+// Cuando un request cumple Match, la regla define el límite del contador de su Scope.
+// Si varias reglas del mismo scope coinciden gana la de match.ip más específico y,
+// entre las que no filtran por IP, la primera del archivo (ver RuleSet).
+// Stacked son ventanas adicionales sobre el mismo contador (ej: 20/s además de 600/min).
+type Rule struct {
+	Name      string
+	Scope     string
+	Match     RuleMatch
+	Limit     int
+	Window    time.Duration
+	Stacked   []WindowLimit
+	Algorithm Algorithm
+	Burst     int
+	Line      int       // línea de la regla en el archivo, para errores y logs
+	ExpiresAt time.Time // solo overrides temporales; cero = no expira
+}
+
+// WindowLimit es un límite con su propia ventana
+type WindowLimit struct {
+	Limit  int
+	Window time.Duration
+}
+
+// RuleMatch son los criterios de una regla; los vacíos no filtran
+type RuleMatch struct {
+	IP      string            // IP exacta o CIDR
+	Path    string            // patrón de path (normalizado o glob sobre el path original)
+	Method  string            // método HTTP
+	Headers map[string]string // header -> valor ("" o "*" = solo presencia)
+
+	prefix netip.Prefix // IP parseada; una IP exacta es un /32 o /128
+}
+
+// RuleError es un error de validación con la posición en el archivo de reglas
+type RuleError struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *RuleError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// Forma de cada regla en YAML/JSON
+type ruleSpec struct {
+	Name      string       `yaml:"name"`
+	Scope     string       `yaml:"scope"`
+	Match     matchSpec    `yaml:"match"`
+	Limit     int          `yaml:"limit"`
+	Window    string       `yaml:"window"`
+	Limits    []windowSpec `yaml:"limits"`
+	Algorithm string       `yaml:"algorithm"`
+	Burst     int          `yaml:"burst"`
+}
+
+type windowSpec struct {
+	Limit  int    `yaml:"limit"`
+	Window string `yaml:"window"`
+}
+
+type matchSpec struct {
+	IP      string            `yaml:"ip"`
+	Path    string            `yaml:"path"`
+	Method  string            `yaml:"method"`
+	Headers map[string]string `yaml:"headers"`
+}
+
+var (
+	ruleFields   = []string{"name", "scope", "match", "limit", "window", "limits", "algorithm", "burst"}
+	matchFields  = []string{"ip", "path", "method", "headers"}
+	windowFields = []string{"limit", "window"}
+)
+
+// LoadRulesFile lee y valida un archivo de reglas YAML o JSON (JSON es YAML válido).
+// Devuelve todos los errores encontrados, cada uno con su número de línea.
+func LoadRulesFile(filename string) ([]Rule, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules file: %w", err)
+	}
+	return ParseRules(filename, data)
+}
+
+// ParseRules parsea el contenido de un archivo de reglas; filename solo se usa en los errores
+func ParseRules(filename string, data []byte) ([]Rule, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, fmt.Errorf("%s: empty rules file", filename)
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, &RuleError{File: filename, Line: root.Line, Msg: "expected a mapping with a rules list"}
+	}
+
+	var errs []error
+	fail := func(line int, format string, args ...interface{}) {
+		errs = append(errs, &RuleError{File: filename, Line: line, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	var rulesNode *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		if key.Value != "rules" {
+			fail(key.Line, "unknown field %q", key.Value)
+			continue
+		}
+		rulesNode = value
+	}
+	if rulesNode == nil {
+		return nil, errors.Join(append(errs, &RuleError{File: filename, Line: root.Line, Msg: "missing rules list"})...)
+	}
+	if rulesNode.Kind != yaml.SequenceNode {
+		return nil, &RuleError{File: filename, Line: rulesNode.Line, Msg: "rules must be a list"}
+	}
+
+	rules := make([]Rule, 0, len(rulesNode.Content))
+	for i, node := range rulesNode.Content {
+		if node.Kind != yaml.MappingNode {
+			fail(node.Line, "rule must be a mapping")
+			continue
+		}
+		if !checkRuleFields(node, fail) {
+			continue
+		}
+
+		var spec ruleSpec
+		if err := node.Decode(&spec); err != nil {
+			// Los errores de tipo de yaml ya traen "line N: ..."
+			var typeErr *yaml.TypeError
+			if !errors.As(err, &typeErr) {
+				fail(node.Line, "%v", err)
+				continue
+			}
+			for _, msg := range typeErr.Errors {
+				line := node.Line
+				if n, _ := fmt.Sscanf(msg, "line %d:", &line); n == 1 {
+					msg = strings.TrimSpace(msg[strings.Index(msg, ":")+1:])
+				}
+				fail(line, "%s", msg)
+			}
+			continue
+		}
+
+		rule, msgs := buildRule(spec, node.Line)
+		for _, msg := range msgs {
+			fail(node.Line, "rule %s: %s", ruleLabel(spec.Name, i), msg)
+		}
+		if len(msgs) == 0 {
+			rules = append(rules, rule)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return rules, nil
+}
+
+// buildRule valida una regla y resuelve CIDR, algoritmo y window
+func buildRule(spec ruleSpec, line int) (Rule, []string) {
+	var msgs []string
+	rule := Rule{
+		Name:  spec.Name,
+		Burst: spec.Burst,
+		Line:  line,
+		Match: RuleMatch{
+			IP:      strings.TrimSpace(spec.Match.IP),
+			Path:    strings.TrimSpace(spec.Match.Path),
+			Method:  strings.ToUpper(strings.TrimSpace(spec.Match.Method)),
+			Headers: make(map[string]string, len(spec.Match.Headers)),
+		},
+	}
+
+	if rule.Burst < 0 {
+		msgs = append(msgs, "burst must not be negative")
+	}
+
+	// limit/window o una lista limits con varias ventanas sobre el mismo contador
+	windows := spec.Limits
+	if len(windows) == 0 {
+		windows = []windowSpec{{Limit: spec.Limit, Window: spec.Window}}
+	} else if spec.Limit != 0 || spec.Window != "" {
+		msgs = append(msgs, "use either limit/window or limits, not both")
+	}
+	seen := make(map[time.Duration]bool, len(windows))
+	for i, limit := range windows {
+		window, windowMsgs := buildWindow(limit)
+		msgs = append(msgs, windowMsgs...)
+		if len(windowMsgs) == 0 && seen[window.Window] {
+			msgs = append(msgs, fmt.Sprintf("duplicate window %s", FormatWindow(window.Window)))
+		}
+		seen[window.Window] = true
+
+		if i == 0 {
+			rule.Limit, rule.Window = window.Limit, window.Window
+		} else {
+			rule.Stacked = append(rule.Stacked, window)
+		}
+	}
+
+	algorithm, err := ParseAlgorithm(spec.Algorithm)
+	if err != nil {
+		msgs = append(msgs, err.Error())
+	}
+	if spec.Algorithm != "" {
+		rule.Algorithm = algorithm
+	}
+
+	if ip := rule.Match.IP; ip != "" {
+		prefix, err := ParsePrefix(ip)
+		if err != nil {
+			msgs = append(msgs, err.Error())
+		}
+		rule.Match.prefix = prefix
+	}
+
+	if method := rule.Match.Method; method != "" && !validMethod(method) {
+		msgs = append(msgs, fmt.Sprintf("invalid method %q", spec.Match.Method))
+	}
+
+	if p := rule.Match.Path; p != "" {
+		if !strings.HasPrefix(p, "/") {
+			msgs = append(msgs, fmt.Sprintf("path pattern %q must start with /", p))
+		} else if _, err := path.Match(p, "/"); err != nil {
+			msgs = append(msgs, fmt.Sprintf("invalid path pattern %q", p))
+		}
+	}
+
+	for name, value := range spec.Match.Headers {
+		rule.Match.Headers[http.CanonicalHeaderKey(strings.TrimSpace(name))] = value
+	}
+
+	// Sin scope explícito se deduce de los criterios
+	switch scope := strings.ToLower(strings.TrimSpace(spec.Scope)); scope {
+	case ScopeIP, ScopePath, ScopeIPPath:
+		rule.Scope = scope
+	case "":
+		switch {
+		case rule.Match.Path != "" && rule.Match.IP != "":
+			rule.Scope = ScopeIPPath
+		case rule.Match.Path != "":
+			rule.Scope = ScopePath
+		default:
+			rule.Scope = ScopeIP
+		}
+	default:
+		msgs = append(msgs, fmt.Sprintf("unknown scope %q (expected ip, path or ip_path)", spec.Scope))
+	}
+
+	// El contador de path es compartido por todos los clientes: filtrarlo por IP haría
+	// que una IP fije el límite de las demás
+	if rule.Scope == ScopePath && rule.Match.IP != "" {
+		msgs = append(msgs, "match.ip is not allowed with scope path (use scope ip_path)")
+	}
+
+	return rule, msgs
+}
+
+// buildWindow valida un límite y su ventana (1m si no se indica)
+func buildWindow(spec windowSpec) (WindowLimit, []string) {
+	var msgs []string
+	window := WindowLimit{Limit: spec.Limit, Window: time.Minute}
+	if window.Limit <= 0 {
+		msgs = append(msgs, "limit must be greater than 0")
+	}
+	if spec.Window != "" {
+		duration, err := time.ParseDuration(spec.Window)
+		if err != nil || duration < time.Millisecond {
+			msgs = append(msgs, fmt.Sprintf("invalid window %q", spec.Window))
+		}
+		window.Window = duration
+	}
+	return window, msgs
+}
+
+// Matches indica si el request cumple todos los criterios de la regla.
+// ip y normalizedPath son los ya calculados por el middleware.
+func (r *Rule) Matches(req *http.Request, ip, normalizedPath string) bool {
+	if r.Match.prefix.IsValid() {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil || !r.Match.prefix.Contains(addr.Unmap()) {
+			return false
+		}
+	}
+	return r.matchesRequest(req, normalizedPath)
+}
+
+// matchesRequest verifica los criterios de la regla salvo la IP
+func (r *Rule) matchesRequest(req *http.Request, normalizedPath string) bool {
+	m := &r.Match
+
+	if m.Method != "" && m.Method != req.Method {
+		return false
+	}
+
+	if m.Path != "" && m.Path != normalizedPath {
+		if ok, _ := path.Match(m.Path, req.URL.Path); !ok {
+			return false
+		}
+	}
+
+	for name, value := range m.Headers {
+		got := req.Header.Get(name)
+		if got == "" {
+			return false
+		}
+		if value != "" && value != "*" && got != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validMethod acepta tokens como GET o PROPFIND; evita espacios y separadores
+// porque el método termina en la key del limiter
+func validMethod(method string) bool {
+	for i := 0; i < len(method); i++ {
+		if c := method[i]; c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// LimitConfig convierte la regla en la configuración del limiter
+func (r *Rule) LimitConfig() LimitConfig {
+	return LimitConfig{
+		Limit:     r.Limit,
+		Window:    r.Window,
+		Algorithm: r.Algorithm,
+		Burst:     r.Burst,
+	}
+}
+
+// StackedConfigs devuelve la configuración de cada ventana apilada con el algoritmo
+// de la regla; el burst solo aplica a la ventana principal
+func (r *Rule) StackedConfigs() []LimitConfig {
+	configs := make([]LimitConfig, 0, len(r.Stacked))
+	for _, window := range r.Stacked {
+		configs = append(configs, LimitConfig{Limit: window.Limit, Window: window.Window, Algorithm: r.Algorithm})
+	}
+	return configs
+}
+
+// checkRuleFields reporta los campos desconocidos de una regla, su match y sus
+// ventanas. Devuelve false si match no es un mapping y la regla no se puede decodificar.
+func checkRuleFields(node *yaml.Node, fail func(int, string, ...interface{})) bool {
+	checkFields(node, ruleFields, fail)
+	if match := mappingValue(node, "match"); match != nil {
+		if match.Kind != yaml.MappingNode {
+			fail(match.Line, "match must be a mapping")
+			return false
+		}
+		checkFields(match, matchFields, fail)
+	}
+	if limits := mappingValue(node, "limits"); limits != nil && limits.Kind == yaml.SequenceNode {
+		for _, window := range limits.Content {
+			if window.Kind == yaml.MappingNode {
+				checkFields(window, windowFields, fail)
+			}
+		}
+	}
+	return true
+}
+
+// checkFields reporta los campos desconocidos de un mapping
+func checkFields(node *yaml.Node, allowed []string, fail func(int, string, ...interface{})) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		known := false
+		for _, field := range allowed {
+			if key.Value == field {
+				known = true
+				break
+			}
+		}
+		if !known {
+			fail(key.Line, "unknown field %q", key.Value)
+		}
+	}
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func ruleLabel(name string, index int) string {
+	if name != "" {
+		return fmt.Sprintf("%q", name)
+	}
+	return fmt.Sprintf("#%d", index+1)
+}
@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/netip"
+)
+
+// RuleSet indexa reglas por scope para elegir la que aplica a un request. Las
+// reglas con match.ip se guardan en un IPTrie por scope y entre las que coinciden
+// gana el prefijo más largo (a igual prefijo, la primera); si ninguna coincide
+// gana la primera regla sin IP. Se arma una vez por recarga y después solo se lee.
+type RuleSet struct {
+	rules  []Rule
+	byIP   map[string]*IPTrie[[]int] // scope -> índices de reglas por prefijo
+	others map[string][]int          // scope -> índices de reglas sin IP, en orden
+}
+
+// NewRuleSet indexa rules; las reglas deben venir validadas (ParseRules o ParseOverride)
+func NewRuleSet(rules []Rule) *RuleSet {
+	rs := &RuleSet{
+		rules:  rules,
+		byIP:   make(map[string]*IPTrie[[]int]),
+		others: make(map[string][]int),
+	}
+
+	// Varias reglas pueden compartir prefijo (ej: distinto método); se prueban en orden
+	byPrefix := make(map[string]map[netip.Prefix][]int)
+	for i := range rules {
+		rule := &rules[i]
+		prefix := rule.Match.prefix
+		if !prefix.IsValid() {
+			rs.others[rule.Scope] = append(rs.others[rule.Scope], i)
+			continue
+		}
+		if byPrefix[rule.Scope] == nil {
+			byPrefix[rule.Scope] = make(map[netip.Prefix][]int)
+		}
+		byPrefix[rule.Scope][prefix] = append(byPrefix[rule.Scope][prefix], i)
+	}
+
+	for scope, prefixes := range byPrefix {
+		trie := NewIPTrie[[]int]()
+		for prefix, indexes := range prefixes {
+			trie.InsertPrefix(prefix, indexes)
+		}
+		rs.byIP[scope] = trie
+	}
+
+	return rs
+}
+
+// Rules devuelve las reglas en el orden original
+func (rs *RuleSet) Rules() []Rule {
+	return rs.rules
+}
+
+// Match devuelve la regla del scope que aplica al request o nil.
+// ip y normalizedPath son los ya calculados por el middleware.
+func (rs *RuleSet) Match(scope string, req *http.Request, ip, normalizedPath string) *Rule {
+	if trie := rs.byIP[scope]; trie != nil {
+		if addr, err := netip.ParseAddr(ip); err == nil {
+			for _, indexes := range trie.LookupAll(addr.Unmap()) {
+				for _, i := range indexes {
+					if rule := &rs.rules[i]; rule.matchesRequest(req, normalizedPath) {
+						return rule
+					}
+				}
+			}
+		}
+	}
+
+	for _, i := range rs.others[scope] {
+		if rule := &rs.rules[i]; rule.matchesRequest(req, normalizedPath) {
+			return rule
+		}
+	}
+	return nil
+}
@@ -0,0 +1,344 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Script Lua multi-key atómico.
+// Fase 1 verifica todas las keys sin registrar nada; fase 2 registra el request
+// en todas las ventanas solo si todas lo permiten. Así un request rechazado por
+// ip_path no consume cupo de ip ni de path, y todo cuesta un único round trip.
+//
+// ARGV[1] = now (ms), ARGV[2] = miembro único del request (para el ZSET),
+// ARGV[3] = "1" para solo consultar el estado sin registrar nada (peek)
+// Por cada key: algoritmo, limit, window (ms), burst
+// Devuelve por cada key: allowed, remaining, reset_after (ms), retry_after (ms)
+const multiLimitScript = `
+local now = tonumber(ARGV[1])
+local member = ARGV[2]
+local peek = ARGV[3] == '1'
+local states = {}
+local all_allowed = true
+
+for i = 1, #KEYS do
+    local key = KEYS[i]
+    local base = 3 + (i - 1) * 4
+    local s = {
+        algorithm = ARGV[base + 1],
+        limit = tonumber(ARGV[base + 2]),
+        window = tonumber(ARGV[base + 3]),
+        burst = tonumber(ARGV[base + 4]),
+        retry = 0
+    }
+
+    if s.algorithm == 'token_bucket' then
+        s.rate = s.limit / s.window
+        local state = redis.call('HMGET', key, 'tokens', 'ts')
+        local tokens = tonumber(state[1])
+        local ts = tonumber(state[2])
+        if tokens == nil or ts == nil then
+            tokens = s.burst
+            ts = now
+        end
+        s.tokens = math.min(s.burst, tokens + math.max(0, now - ts) * s.rate)
+        s.allowed = s.tokens >= 1
+        if not s.allowed then
+            s.retry = math.ceil((1 - s.tokens) / s.rate)
+        end
+
+    elseif s.algorithm == 'gcra' then
+        s.emission = s.window / s.limit
+        s.tolerance = s.emission * s.burst
+        local tat = tonumber(redis.call('GET', key))
+        if tat == nil or tat < now then
+            tat = now
+        end
+        s.tat = tat
+        s.new_tat = tat + s.emission
+        local allow_at = s.new_tat - s.tolerance
+        s.allowed = now >= allow_at
+        if not s.allowed then
+            s.retry = math.ceil(allow_at - now)
+        end
+
+    elseif s.algorithm == 'sliding_window_counter' then
+        local window = s.window
+        s.cur_start = math.floor(now / window) * window
+        local state = redis.call('HMGET', key, 'start', 'cur', 'prev')
+        local start = tonumber(state[1])
+        local cur = tonumber(state[2]) or 0
+        local prev = tonumber(state[3]) or 0
+        if start == nil then
+            cur = 0
+            prev = 0
+        elseif start == s.cur_start - window then
+            prev = cur
+            cur = 0
+        elseif start ~= s.cur_start then
+            cur = 0
+            prev = 0
+        end
+        s.cur = cur
+        s.prev = prev
+        s.elapsed = now - s.cur_start
+        s.estimate = prev * ((window - s.elapsed) / window) + cur
+        s.allowed = s.estimate + 1 <= s.limit
+        if not s.allowed then
+            if cur + 1 > s.limit then
+                s.retry = (window - s.elapsed) + math.max(0, window - (s.limit - 1) * window / cur)
+            else
+                s.retry = math.max(0, window - s.elapsed - (s.limit - 1 - cur) * window / prev)
+            end
+            s.retry = math.ceil(s.retry)
+        end
+
+    elseif s.algorithm == 'fixed_window' then
+        -- contador que vence window ms después del primer request
+        s.current = tonumber(redis.call('GET', key)) or 0
+        s.ttl = redis.call('PTTL', key)
+        s.fresh = s.ttl < 0
+        if s.fresh then
+            s.ttl = s.window
+        end
+        s.allowed = s.current < s.limit
+        if not s.allowed then
+            s.retry = s.ttl
+        end
+
+    else
+        -- sliding_window: log de timestamps en un ZSET
+        redis.call('ZREMRANGEBYSCORE', key, '-inf', now - s.window)
+        s.current = redis.call('ZCARD', key)
+        s.allowed = s.current < s.limit
+        if not s.allowed then
+            local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+            if oldest[2] then
+                s.retry = math.max(1, math.ceil(tonumber(oldest[2]) + s.window - now))
+            else
+                s.retry = s.window
+            end
+        end
+    end
+
+    if not s.allowed then
+        all_allowed = false
+    end
+    states[i] = s
+end
+
+local result = {}
+for i = 1, #KEYS do
+    local key = KEYS[i]
+    local s = states[i]
+    local allowed = 0
+    local remaining = 0
+    local reset_after = 0
+
+    if s.allowed then
+        allowed = 1
+    end
+
+    if s.algorithm == 'token_bucket' then
+        local tokens = s.tokens
+        if s.allowed then
+            tokens = tokens - 1
+            remaining = math.floor(tokens)
+        end
+        reset_after = math.ceil((s.burst - tokens) / s.rate)
+        if all_allowed and not peek then
+            redis.call('HSET', key, 'tokens', tostring(tokens), 'ts', now)
+            redis.call('PEXPIRE', key, reset_after + 1000)
+        end
+
+    elseif s.algorithm == 'gcra' then
+        if s.allowed then
+            reset_after = math.ceil(s.new_tat - now)
+            remaining = math.floor((s.tolerance - (s.new_tat - now)) / s.emission)
+        else
+            reset_after = math.ceil(s.tat - now)
+        end
+        if all_allowed and not peek then
+            redis.call('SET', key, tostring(s.new_tat), 'PX', math.max(1, reset_after))
+        end
+
+    elseif s.algorithm == 'sliding_window_counter' then
+        reset_after = s.window - s.elapsed
+        if s.allowed then
+            remaining = math.floor(s.limit - s.estimate - 1)
+        end
+        if all_allowed and not peek then
+            redis.call('HSET', key, 'start', s.cur_start, 'cur', s.cur + 1, 'prev', s.prev)
+            redis.call('PEXPIRE', key, s.window * 2)
+        end
+
+    elseif s.algorithm == 'fixed_window' then
+        reset_after = s.ttl
+        if s.allowed then
+            remaining = s.limit - s.current - 1
+        end
+        if all_allowed and not peek then
+            redis.call('INCR', key)
+            if s.fresh then
+                redis.call('PEXPIRE', key, s.window)
+            end
+        end
+
+    else
+        reset_after = s.window
+        if s.allowed then
+            remaining = s.limit - s.current - 1
+        else
+            reset_after = s.retry
+        end
+        if all_allowed and not peek then
+            redis.call('ZADD', key, now, member)
+            redis.call('PEXPIRE', key, s.window + 1000)
+        end
+    end
+
+    local base = (i - 1) * 4
+    result[base + 1] = allowed
+    result[base + 2] = remaining
+    result[base + 3] = reset_after
+    result[base + 4] = s.retry
+end
+
+return result
+`
+
+var limitScript = redis.NewScript(multiLimitScript)
+
+// requestSeq desambigua requests del mismo nanosegundo dentro del ZSET
+var requestSeq uint64
+
+// limitCheck es una key con su configuración dentro de una evaluación atómica
+type limitCheck struct {
+	key    string
+	config LimitConfig
+}
+
+// evalLimits ejecuta el script multi-key para todas las checks en un único round trip.
+// Si algún límite rechaza el request, ninguna ventana lo registra.
+func evalLimits(ctx context.Context, client redis.Scripter, checks []limitCheck) ([]*LimitResult, error) {
+	return runLimitScript(ctx, client, checks, false)
+}
+
+// peekLimits devuelve el estado de las keys sin registrar el request.
+// Remaining es el cupo disponible antes del próximo request.
+func peekLimits(ctx context.Context, client redis.Scripter, checks []limitCheck) ([]*LimitResult, error) {
+	return runLimitScript(ctx, client, checks, true)
+}
+
+func runLimitScript(ctx context.Context, client redis.Scripter, checks []limitCheck, peek bool) ([]*LimitResult, error) {
+	if len(checks) == 0 {
+		return nil, nil
+	}
+
+	now := time.Now()
+	member := strconv.FormatInt(now.UnixNano(), 36) + "-" + strconv.FormatUint(atomic.AddUint64(&requestSeq, 1), 36)
+
+	peekFlag := "0"
+	if peek {
+		peekFlag = "1"
+	}
+
+	keys := make([]string, 0, len(checks))
+	args := make([]interface{}, 0, 3+len(checks)*4)
+	args = append(args, now.UnixMilli(), member, peekFlag)
+
+	for _, check := range checks {
+		cfg := check.config
+		if cfg.Limit <= 0 || cfg.Window < time.Millisecond {
+			return nil, fmt.Errorf("invalid limit config for key %s: limit=%d window=%s", check.key, cfg.Limit, cfg.Window)
+		}
+
+		algorithm := cfg.Algorithm
+		if algorithm == "" {
+			algorithm = AlgorithmSlidingWindow
+		}
+		burst := cfg.Burst
+		if burst <= 0 {
+			burst = cfg.Limit
+		}
+
+		keys = append(keys, check.key)
+		args = append(args, string(algorithm), cfg.Limit, cfg.Window.Milliseconds(), burst)
+	}
+
+	raw, err := limitScript.Run(ctx, client, keys, args...).Result()
+	if err != nil {
+		// Timeouts y cancelaciones se devuelven tal cual para que el caller los distinga
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("rate limit check failed: %w", err)
+	}
+
+	values, ok := raw.([]interface{})
+	if !ok || len(values) != len(checks)*4 {
+		return nil, fmt.Errorf("unexpected redis script result")
+	}
+
+	results := make([]*LimitResult, len(checks))
+	for i := range checks {
+		var fields [4]int64
+		for j := range fields {
+			v, ok := values[i*4+j].(int64)
+			if !ok {
+				return nil, fmt.Errorf("invalid result from redis for key %s", checks[i].key)
+			}
+			fields[j] = v
+		}
+
+		results[i] = &LimitResult{
+			Allowed:    fields[0] == 1,
+			Remaining:  int(fields[1]),
+			ResetTime:  now.Add(time.Duration(fields[2]) * time.Millisecond),
+			RetryAfter: time.Duration(fields[3]) * time.Millisecond,
+		}
+		// El script descuenta el request que se registraría; en peek no se registra
+		if peek && results[i].Allowed {
+			results[i].Remaining++
+		}
+	}
+
+	return results, nil
+}
+
+// evalLimitMap evalúa un mapa key -> config forzando el algoritmo si no es vacío
+func evalLimitMap(ctx context.Context, client redis.Scripter, limits map[string]LimitConfig, algorithm Algorithm) (map[string]*LimitResult, error) {
+	return runLimitMap(ctx, client, limits, algorithm, false)
+}
+
+// peekLimitMap es evalLimitMap sin registrar el request
+func peekLimitMap(ctx context.Context, client redis.Scripter, limits map[string]LimitConfig) (map[string]*LimitResult, error) {
+	return runLimitMap(ctx, client, limits, "", true)
+}
+
+func runLimitMap(ctx context.Context, client redis.Scripter, limits map[string]LimitConfig, algorithm Algorithm, peek bool) (map[string]*LimitResult, error) {
+	checks := make([]limitCheck, 0, len(limits))
+	for key, config := range limits {
+		// Las cuotas conservan su contador fijo aunque el limiter fuerce un algoritmo
+		if algorithm != "" && config.Algorithm != AlgorithmFixedWindow {
+			config.Algorithm = algorithm
+		}
+		checks = append(checks, limitCheck{key: key, config: config})
+	}
+
+	evaluated, err := runLimitScript(ctx, client, checks, peek)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]*LimitResult, len(checks))
+	for i, check := range checks {
+		results[check.key] = evaluated[i]
+	}
+	return results, nil
+}
@@ -0,0 +1,316 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andress1014/meli-proxy/internal/metrics"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+const (
+	// Tiempo máximo que se considera "en failover" si Sentinel no avisa el final
+	defaultSentinelFailoverTimeout = 30 * time.Second
+	// Margen tras +switch-master para que el pool reconecte al nuevo master
+	sentinelSwitchGrace = time.Second
+	// Espera antes de pasar al siguiente sentinel cuando se pierde la suscripción
+	sentinelResubscribeInterval = time.Second
+)
+
+// Canales de Sentinel que marcan el inicio y fin de un failover
+var sentinelFailoverChannels = []string{
+	"+odown",
+	"-odown",
+	"+try-failover",
+	"+failover-end",
+	"+switch-master",
+	"-failover-abort-*",
+}
+
+// SentinelConfig para Redis con Sentinel
+type SentinelConfig struct {
+	MasterName       string        `json:"master_name"`
+	SentinelAddrs    []string      `json:"sentinel_addrs"`
+	SentinelPassword string        `json:"sentinel_password,omitempty"`
+	Password         string        `json:"password,omitempty"`
+	DB               int           `json:"db,omitempty"`
+	MaxRetries       int           `json:"max_retries"`
+	DialTimeout      time.Duration `json:"dial_timeout"`
+	ReadTimeout      time.Duration `json:"read_timeout"`
+	WriteTimeout     time.Duration `json:"write_timeout"`
+	PoolSize         int           `json:"pool_size"`
+	MinIdleConns     int           `json:"min_idle_conns"`
+	MaxConnAge       time.Duration `json:"max_conn_age"`
+	PoolTimeout      time.Duration `json:"pool_timeout"`
+	IdleTimeout      time.Duration `json:"idle_timeout"`
+	FailoverTimeout  time.Duration `json:"failover_timeout"`
+}
+
+// ErrFailover envuelve los errores de Redis mientras Sentinel anuncia un
+// failover, para que el caller aplique su política de fallo
+var ErrFailover = errors.New("redis sentinel failover in progress")
+
+// SentinelLimiter usa el master que anuncia Sentinel y sobrevive a failovers.
+// go-redis reconecta al nuevo master por su cuenta; además el limiter escucha
+// los eventos de Sentinel para loguearlos, exportarlos como métricas y marcar
+// con ErrFailover los errores mientras el failover está en curso.
+type SentinelLimiter struct {
+	client *redis.Client
+	config SentinelConfig
+	logger *zap.Logger
+
+	// Unix nanos hasta el que se considera que hay un failover en curso
+	failoverUntil int64
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewSentinelLimiter(config SentinelConfig, logger *zap.Logger) (*SentinelLimiter, error) {
+	if config.MasterName == "" {
+		return nil, errors.New("sentinel master name is required")
+	}
+	if len(config.SentinelAddrs) == 0 {
+		return nil, errors.New("at least one sentinel address is required")
+	}
+	config.FailoverTimeout = getOrDefaultDuration(config.FailoverTimeout, defaultSentinelFailoverTimeout)
+
+	rdb := redis.NewFailoverClient(&redis.FailoverOptions{
+		MasterName:       config.MasterName,
+		SentinelAddrs:    config.SentinelAddrs,
+		SentinelPassword: config.SentinelPassword,
+		Password:         config.Password,
+		DB:               config.DB,
+
+		MaxRetries:   getOrDefault(config.MaxRetries, 3),
+		DialTimeout:  getOrDefaultDuration(config.DialTimeout, 1*time.Second),
+		ReadTimeout:  getOrDefaultDuration(config.ReadTimeout, 500*time.Millisecond),
+		WriteTimeout: getOrDefaultDuration(config.WriteTimeout, 500*time.Millisecond),
+
+		PoolSize:     getOrDefault(config.PoolSize, 1000),
+		MinIdleConns: getOrDefault(config.MinIdleConns, 100),
+		MaxConnAge:   getOrDefaultDuration(config.MaxConnAge, 30*time.Minute),
+		PoolTimeout:  getOrDefaultDuration(config.PoolTimeout, 1*time.Second),
+		IdleTimeout:  getOrDefaultDuration(config.IdleTimeout, 5*time.Minute),
+	})
+
+	// Test connectivity
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		rdb.Close()
+		return nil, err
+	}
+
+	sl := &SentinelLimiter{
+		client: rdb,
+		config: config,
+		logger: logger,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	metrics.SetRedisFailoverInProgress(config.MasterName, false)
+
+	go sl.watchFailovers()
+
+	logger.Info("Redis sentinel limiter initialized",
+		zap.String("master", config.MasterName),
+		zap.Strings("sentinels", config.SentinelAddrs))
+
+	return sl, nil
+}
+
+// CheckLimit verifica una key con sliding window log (ZSET)
+func (sl *SentinelLimiter) CheckLimit(ctx context.Context, key string, limit int, window time.Duration) (*LimitResult, error) {
+	results, err := sl.CheckMultipleLimits(ctx, map[string]LimitConfig{
+		key: {Limit: limit, Window: window, Algorithm: AlgorithmSlidingWindow},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results[key], nil
+}
+
+// CheckMultipleLimits evalúa todas las keys en el master actual. Si falla
+// mientras hay un failover en curso el error se envuelve en ErrFailover; qué
+// hacer con el request lo decide la política de fallo del middleware.
+func (sl *SentinelLimiter) CheckMultipleLimits(ctx context.Context, limits map[string]LimitConfig) (map[string]*LimitResult, error) {
+	results, err := evalLimitMap(ctx, sl.client, limits, "")
+	if err == nil || !sl.FailingOver() {
+		return results, err
+	}
+
+	sl.logger.Warn("rate limit check failed during sentinel failover",
+		zap.String("master", sl.config.MasterName),
+		zap.Error(err))
+
+	return nil, fmt.Errorf("%w: %w", ErrFailover, err)
+}
+
+// Peek devuelve el estado de las keys sin registrar un request
+func (sl *SentinelLimiter) Peek(ctx context.Context, limits map[string]LimitConfig) (map[string]*LimitResult, error) {
+	return peekLimitMap(ctx, sl.client, limits)
+}
+
+// Reset borra los contadores de las keys
+func (sl *SentinelLimiter) Reset(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return sl.client.Del(ctx, keys...).Err()
+}
+
+// FailingOver indica si Sentinel anunció un failover que todavía no terminó
+func (sl *SentinelLimiter) FailingOver() bool {
+	return time.Now().UnixNano() < atomic.LoadInt64(&sl.failoverUntil)
+}
+
+// Health check contra el master actual
+func (sl *SentinelLimiter) HealthCheck(ctx context.Context) error {
+	return sl.client.Ping(ctx).Err()
+}
+
+// RedisClient devuelve el cliente del master actual
+func (sl *SentinelLimiter) RedisClient() redis.UniversalClient {
+	return sl.client
+}
+
+// Close detiene la escucha de eventos y cierra las conexiones
+func (sl *SentinelLimiter) Close() error {
+	sl.closeOnce.Do(func() {
+		close(sl.stop)
+		<-sl.done
+	})
+	return sl.client.Close()
+}
+
+// watchFailovers se suscribe a los eventos de failover de un sentinel y, si la
+// conexión se pierde, rota al siguiente de la lista
+func (sl *SentinelLimiter) watchFailovers() {
+	defer close(sl.done)
+
+	for i := 0; ; i++ {
+		addr := sl.config.SentinelAddrs[i%len(sl.config.SentinelAddrs)]
+		if err := sl.watchSentinel(addr); err != nil {
+			sl.logger.Warn("lost sentinel event subscription",
+				zap.String("sentinel", addr),
+				zap.Error(err))
+		}
+
+		select {
+		case <-sl.stop:
+			return
+		case <-time.After(sentinelResubscribeInterval):
+		}
+	}
+}
+
+// watchSentinel procesa eventos de un sentinel hasta que falle o se cierre el limiter
+func (sl *SentinelLimiter) watchSentinel(addr string) error {
+	sentinel := redis.NewSentinelClient(&redis.Options{
+		Addr:        addr,
+		Password:    sl.config.SentinelPassword,
+		DialTimeout: getOrDefaultDuration(sl.config.DialTimeout, 1*time.Second),
+	})
+	defer sentinel.Close()
+
+	ctx := context.Background()
+	pubsub := sentinel.PSubscribe(ctx, sentinelFailoverChannels...)
+	defer pubsub.Close()
+
+	for {
+		select {
+		case <-sl.stop:
+			return nil
+		default:
+		}
+
+		// Timeout corto para poder revisar stop periódicamente
+		msg, err := pubsub.ReceiveTimeout(ctx, time.Second)
+		if err != nil {
+			var netErr interface{ Timeout() bool }
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return err
+		}
+
+		if m, ok := msg.(*redis.Message); ok {
+			sl.handleEvent(m.Channel, m.Payload)
+		}
+	}
+}
+
+// handleEvent actualiza el estado de failover a partir de un evento de Sentinel.
+// +switch-master: <master> <old-ip> <old-port> <new-ip> <new-port>
+// resto:          master <master> <ip> <port> ...
+func (sl *SentinelLimiter) handleEvent(channel, payload string) {
+	fields := strings.Fields(payload)
+	master := ""
+	if channel == "+switch-master" {
+		if len(fields) > 0 {
+			master = fields[0]
+		}
+	} else if len(fields) > 1 && fields[0] == "master" {
+		master = fields[1]
+	}
+	if master != sl.config.MasterName {
+		return
+	}
+
+	metrics.RecordRedisFailoverEvent(master, channel)
+
+	switch {
+	case channel == "+odown" || channel == "+try-failover":
+		sl.setFailoverUntil(time.Now().Add(sl.config.FailoverTimeout))
+		metrics.SetRedisFailoverInProgress(master, true)
+		sl.logger.Warn("redis sentinel failover started",
+			zap.String("master", master),
+			zap.String("event", channel),
+			zap.String("payload", payload))
+
+	case channel == "+switch-master":
+		// El pool descarta las conexiones al master viejo; dejamos un margen
+		// para que las nuevas conexiones se establezcan
+		sl.setFailoverUntil(time.Now().Add(sentinelSwitchGrace))
+		metrics.SetRedisFailoverInProgress(master, false)
+		newMaster := ""
+		if len(fields) == 5 {
+			newMaster = fields[3] + ":" + fields[4]
+		}
+		sl.logger.Warn("redis sentinel switched master",
+			zap.String("master", master),
+			zap.String("new_master", newMaster),
+			zap.String("payload", payload))
+
+	case channel == "-odown" || strings.HasPrefix(channel, "-failover-abort"):
+		sl.setFailoverUntil(time.Time{})
+		metrics.SetRedisFailoverInProgress(master, false)
+		sl.logger.Warn("redis sentinel failover ended without master switch",
+			zap.String("master", master),
+			zap.String("event", channel),
+			zap.String("payload", payload))
+
+	default:
+		sl.logger.Info("redis sentinel failover event",
+			zap.String("master", master),
+			zap.String("event", channel),
+			zap.String("payload", payload))
+	}
+}
+
+func (sl *SentinelLimiter) setFailoverUntil(t time.Time) {
+	until := int64(0)
+	if !t.IsZero() {
+		until = t.UnixNano()
+	}
+	atomic.StoreInt64(&sl.failoverUntil, until)
+}
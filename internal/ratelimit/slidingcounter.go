@@ -0,0 +1,44 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// SlidingWindowCounterLimiter implementa Limiter aproximando la ventana deslizante
+// con los contadores de la ventana fija actual y la anterior, ponderando la anterior
+// por la fracción de ventana que todavía cubre. Usa memoria O(1) por key sin importar
+// el límite, a diferencia del ZSET de RedisLimiter.
+type SlidingWindowCounterLimiter struct {
+	client redis.UniversalClient
+}
+
+// NewSlidingWindowCounterLimiter crea el limiter sobre un cliente Redis existente
+func NewSlidingWindowCounterLimiter(client redis.UniversalClient) *SlidingWindowCounterLimiter {
+	return &SlidingWindowCounterLimiter{
+		client: client,
+	}
+}
+
+// CheckLimit registra un request en la key si la estimación no supera limit
+func (sc *SlidingWindowCounterLimiter) CheckLimit(ctx context.Context, key string, limit int, window time.Duration) (*LimitResult, error) {
+	results, err := evalLimits(ctx, sc.client, []limitCheck{
+		{key: key, config: LimitConfig{Limit: limit, Window: window, Algorithm: AlgorithmSlidingWindowCounter}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// CheckMultipleLimits verifica todas las keys con sliding window counter en un único script
+func (sc *SlidingWindowCounterLimiter) CheckMultipleLimits(ctx context.Context, limits map[string]LimitConfig) (map[string]*LimitResult, error) {
+	return evalLimitMap(ctx, sc.client, limits, AlgorithmSlidingWindowCounter)
+}
+
+// Close cierra la conexión a Redis
+func (sc *SlidingWindowCounterLimiter) Close() error {
+	return sc.client.Close()
+}
@@ -0,0 +1,43 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// TokenBucketLimiter implementa Limiter con token bucket sobre Redis.
+// Cada key ocupa un hash de dos campos (tokens y timestamp) sin importar el límite.
+type TokenBucketLimiter struct {
+	client redis.UniversalClient
+}
+
+// NewTokenBucketLimiter crea un token bucket sobre un cliente Redis existente
+func NewTokenBucketLimiter(client redis.UniversalClient) *TokenBucketLimiter {
+	return &TokenBucketLimiter{
+		client: client,
+	}
+}
+
+// CheckLimit consume un token de la key. La recarga es limit/window y la
+// capacidad máxima es burst (si burst <= 0 se usa limit).
+func (tb *TokenBucketLimiter) CheckLimit(ctx context.Context, key string, limit, burst int, window time.Duration) (*LimitResult, error) {
+	results, err := evalLimits(ctx, tb.client, []limitCheck{
+		{key: key, config: LimitConfig{Limit: limit, Window: window, Algorithm: AlgorithmTokenBucket, Burst: burst}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// CheckMultipleLimits verifica todas las keys con token bucket en un único script
+func (tb *TokenBucketLimiter) CheckMultipleLimits(ctx context.Context, limits map[string]LimitConfig) (map[string]*LimitResult, error) {
+	return evalLimitMap(ctx, tb.client, limits, AlgorithmTokenBucket)
+}
+
+// Close cierra la conexión a Redis
+func (tb *TokenBucketLimiter) Close() error {
+	return tb.client.Close()
+}
@@ -1,88 +1,63 @@
 package ratelimit
 
 import (
-	"net"
 	"net/http"
-	"regexp"
 	"strings"
 )
 
-// ExtractIP extrae la IP real del request
+// ExtractIP extrae la IP real del request. El header de forwarding configurado
+// solo se considera si el peer es un proxy de confianza (ver SetTrustedProxies);
+// si no, se usa RemoteAddr.
 func ExtractIP(r *http.Request) string {
-	// 1. Intentar X-Forwarded-For (puede contener múltiples IPs)
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		// Tomar la primera IP (la del cliente original)
-		parts := strings.Split(xff, ",")
-		if len(parts) > 0 {
-			ip := strings.TrimSpace(parts[0])
-			if net.ParseIP(ip) != nil {
-				return ip
-			}
-		}
-	}
-
-	// 2. Intentar X-Real-IP
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		if net.ParseIP(xri) != nil {
-			return xri
-		}
+	if resolver := defaultResolver.Load(); resolver != nil {
+		return resolver.ClientIP(r)
 	}
-
-	// 3. Fallback a RemoteAddr
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return r.RemoteAddr
-	}
-	return ip
+	return remoteIP(r.RemoteAddr)
 }
 
-var (
-	// Patrones para normalizar paths
-	categoriesPattern = regexp.MustCompile(`^/categories/[^/]+(/.*)?$`)
-	itemsPattern      = regexp.MustCompile(`^/items/[^/]+(/.*)?$`)
-	usersPattern      = regexp.MustCompile(`^/users/[^/]+(/.*)?$`)
-	sitesPattern      = regexp.MustCompile(`^/sites/[^/]+(/.*)?$`)
-)
-
-// NormalizePath convierte paths específicos a patrones generales
+// NormalizePath convierte paths específicos a patrones generales según los
+// templates de normalización (ver SetPathTemplates) y, si está habilitada, la
+// detección de IDs (ver SetIDDetection)
 // Ejemplos:
 // /categories/MLA1234 -> /categories/*
 // /items/MLA123456789 -> /items/*
 // /users/123456 -> /users/*
+// No hace allocations salvo cuando la detección de IDs reemplaza un segmento.
 func NormalizePath(path string) string {
+	return normalizePath(path, true)
+}
+
+// PreviewNormalizePath es NormalizePath sin registrar el path en las estadísticas
+// de la detección de IDs; para consultas de administración que no son tráfico real
+func PreviewNormalizePath(path string) string {
+	return normalizePath(path, false)
+}
+
+func normalizePath(path string, record bool) string {
 	// Limpiar query parameters
-	if idx := strings.Index(path, "?"); idx != -1 {
+	if idx := strings.IndexByte(path, '?'); idx != -1 {
 		path = path[:idx]
 	}
 
 	// Normalizar trailing slash
-	if len(path) > 1 && strings.HasSuffix(path, "/") {
+	if len(path) > 1 && path[len(path)-1] == '/' {
 		path = path[:len(path)-1]
 	}
 
-	// Aplicar patrones de normalización
-	switch {
-	case categoriesPattern.MatchString(path):
-		return "/categories/*"
-	case itemsPattern.MatchString(path):
-		return "/items/*"
-	case usersPattern.MatchString(path):
-		return "/users/*"
-	case sitesPattern.MatchString(path):
-		return "/sites/*"
-	default:
-		return path
+	if pattern, ok := pathNormalizer().lookup(path); ok {
+		return pattern
 	}
+	// Sin template, los segmentos con forma de ID se agrupan si está habilitado
+	if detector := defaultIDs.Load(); detector != nil {
+		if !record {
+			return detector.Pattern(path)
+		}
+		return detector.Normalize(path)
+	}
+	return path
 }
 
 // GetLimitKeys genera todas las keys necesarias para rate limiting
 func GetLimitKeys(r *http.Request) map[string]string {
-	ip := ExtractIP(r)
-	normalizedPath := NormalizePath(r.URL.Path)
-
-	return map[string]string{
-		"ip":      IPKey(ip),
-		"path":    PathKey(normalizedPath),
-		"ip_path": IPPathKey(ip, normalizedPath),
-	}
+	return DeriveKeys(r).LimitKeys()
 }
@@ -3,6 +3,7 @@ package integration
 import (
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"testing"
 	"time"
 
@@ -151,6 +152,10 @@ func TestMiddlewareChain(t *testing.T) {
 }
 
 func TestRateLimitKeyGeneration(t *testing.T) {
+	// El X-Forwarded-For solo se acepta si viene de un proxy de confianza
+	ratelimit.SetTrustedProxies([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}, ratelimit.ProxyHeaderXForwardedFor)
+	t.Cleanup(func() { ratelimit.SetTrustedProxies(nil, "") })
+
 	tests := []struct {
 		name           string
 		remoteAddr     string
@@ -0,0 +1,165 @@
+package unit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andress1014/meli-proxy/internal/config"
+	"github.com/andress1014/meli-proxy/internal/middleware"
+	"github.com/andress1014/meli-proxy/internal/ratelimit"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// counterValue lee un contador sin labels del registry default
+func counterValue(t *testing.T, name string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() == name && len(family.GetMetric()) > 0 {
+			return family.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestParseIPList(t *testing.T) {
+	prefixes, err := ratelimit.ParseIPList("ips.csv", []byte("ip\n10.0.0.1\n\n# oficina\n192.168.0.0/16,office\n2001:db8::/32\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{"10.0.0.1/32", "192.168.0.0/16", "2001:db8::/32"}
+	if len(prefixes) != len(expected) {
+		t.Fatalf("expected %d entries, got %v", len(expected), prefixes)
+	}
+	for i, prefix := range prefixes {
+		if prefix.String() != expected[i] {
+			t.Errorf("entry %d: expected %s, got %s", i, expected[i], prefix)
+		}
+	}
+
+	_, err = ratelimit.ParseIPList("ips.csv", []byte("ip\n10.0.0.1\nnot-an-ip\n10.0.0.0/40\n"))
+	if err == nil {
+		t.Fatal("expected error for invalid entries")
+	}
+	var ruleErr *ratelimit.RuleError
+	if !errors.As(err, &ruleErr) || ruleErr.Line != 3 {
+		t.Errorf("expected error on line 3, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "ips.csv:4:") {
+		t.Errorf("expected error on line 4, got %v", err)
+	}
+}
+
+func TestParseIPList_ExampleFile(t *testing.T) {
+	prefixes, err := ratelimit.LoadIPListFile(filepath.Join("..", "..", "ips.csv"))
+	if err != nil {
+		t.Fatalf("ips.csv should be a valid IP list: %v", err)
+	}
+	if len(prefixes) != 1000 {
+		t.Errorf("expected 1000 IPs in ips.csv, got %d", len(prefixes))
+	}
+}
+
+func TestConfigLoad_IPLists(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "deny.csv")
+	if err := os.WriteFile(file, []byte("ip\n198.51.100.0/24\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("IP_ALLOWLIST", "10.0.0.5, 10.1.0.0/16")
+	t.Setenv("IP_DENYLIST", "203.0.113.9")
+	t.Setenv("IP_DENYLIST_FILE", file)
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.IPAllowList) != 2 || len(cfg.IPDenyList) != 2 {
+		t.Errorf("unexpected lists: allow=%v deny=%v", cfg.IPAllowList, cfg.IPDenyList)
+	}
+
+	t.Setenv("IP_ALLOWLIST", "10.0.0.5,bogus")
+	if _, err := config.Load(); err == nil {
+		t.Error("expected error for invalid allowlist entry")
+	}
+}
+
+func TestAccessListMiddleware(t *testing.T) {
+	cfg := &config.Config{
+		DefaultRPS: 100,
+		IPAllowList: []netip.Prefix{
+			netip.MustParsePrefix("10.0.0.5/32"),
+			netip.MustParsePrefix("2001:db8::/32"),
+		},
+		IPDenyList: []netip.Prefix{
+			netip.MustParsePrefix("10.0.0.0/8"),
+			netip.MustParsePrefix("203.0.113.9/32"),
+			netip.MustParsePrefix("2001:db8::/32"),
+		},
+	}
+	logger := zap.NewNop()
+	limiter := &recordingLimiter{}
+
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler = middleware.NewRateLimitMiddleware(limiter, cfg, logger).Handler(handler)
+	handler = middleware.NewAccessListMiddleware(cfg, logger).Handler(handler)
+
+	tests := []struct {
+		name        string
+		remoteAddr  string
+		status      int
+		rateLimited bool
+	}{
+		{"denied exact IP", "203.0.113.9:1234", http.StatusForbidden, false},
+		{"denied CIDR", "10.20.30.40:1234", http.StatusForbidden, false},
+		{"allowlisted inside denied CIDR", "10.0.0.5:1234", http.StatusOK, false},
+		{"same prefix in both lists is denied", "[2001:db8::1]:1234", http.StatusForbidden, false},
+		{"not listed", "192.0.2.1:1234", http.StatusOK, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter.limits = nil
+			denied := counterValue(t, "meli_proxy_ip_denied_total")
+			allowed := counterValue(t, "meli_proxy_ip_allowlisted_total")
+
+			req := httptest.NewRequest("GET", "/items/MLA1", nil)
+			req.RemoteAddr = tt.remoteAddr
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, rr.Code)
+			}
+			if (limiter.limits != nil) != tt.rateLimited {
+				t.Errorf("expected rate limiter called=%v", tt.rateLimited)
+			}
+
+			switch {
+			case tt.status == http.StatusForbidden:
+				if rr.Header().Get("Content-Type") != "application/json" || !strings.Contains(rr.Body.String(), `"error":"forbidden"`) {
+					t.Errorf("expected JSON 403, got %q", rr.Body.String())
+				}
+				if counterValue(t, "meli_proxy_ip_denied_total") != denied+1 {
+					t.Error("expected denied counter to increase")
+				}
+			case !tt.rateLimited:
+				if counterValue(t, "meli_proxy_ip_allowlisted_total") != allowed+1 {
+					t.Error("expected allowlisted counter to increase")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andress1014/meli-proxy/internal/admin"
+	"github.com/andress1014/meli-proxy/internal/config"
+	"github.com/andress1014/meli-proxy/internal/middleware"
+	"github.com/andress1014/meli-proxy/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
+const adminToken = "secret-token"
+
+func newAdminTest(t *testing.T, limiter ratelimit.Limiter) (*admin.Server, http.Handler) {
+	t.Helper()
+	rules, err := ratelimit.ParseRules("rules.yaml", []byte("rules:\n  - name: items\n    match: {path: /items/*}\n    limit: 5\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cfg := &config.Config{DefaultRPS: 10, Rules: rules}
+	mw := middleware.NewRateLimitMiddleware(limiter, cfg, zap.NewNop())
+	proxied := mw.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	return admin.NewServer("0", adminToken, mw, limiter, nil, zap.NewNop()), proxied
+}
+
+func adminRequest(t *testing.T, handler http.Handler, method, target, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid JSON response %q: %v", rr.Body.String(), err)
+	}
+	return rr, decoded
+}
+
+func TestAdminAPI_Authentication(t *testing.T) {
+	limiter := ratelimit.NewMemoryLimiter(0)
+	defer limiter.Close()
+	server, _ := newAdminTest(t, limiter)
+
+	for _, header := range []string{"", "Bearer wrong", adminToken} {
+		req := httptest.NewRequest("GET", "/admin/rules", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rr := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: expected 401, got %d", header, rr.Code)
+		}
+	}
+
+	rr, _ := adminRequest(t, server.Handler(), "GET", "/admin/rules", "")
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 with valid token, got %d", rr.Code)
+	}
+}
+
+func TestAdminAPI_Rules(t *testing.T) {
+	limiter := ratelimit.NewMemoryLimiter(0)
+	defer limiter.Close()
+	server, _ := newAdminTest(t, limiter)
+
+	_, body := adminRequest(t, server.Handler(), "GET", "/admin/rules", "")
+	rules, ok := body["rules"].([]interface{})
+	if !ok || len(rules) != 1 {
+		t.Fatalf("expected 1 rule, got %v", body)
+	}
+	rule := rules[0].(map[string]interface{})
+	if rule["name"] != "items" || rule["scope"] != "path" || rule["limit"] != float64(5) || rule["window"] != "1m0s" {
+		t.Errorf("unexpected rule view: %v", rule)
+	}
+}
+
+func TestAdminAPI_LimitsAndReset(t *testing.T) {
+	limiter := ratelimit.NewMemoryLimiter(0)
+	defer limiter.Close()
+	server, proxied := newAdminTest(t, limiter)
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "/items/MLA1", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		proxied.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	rr, body := adminRequest(t, server.Handler(), "GET", "/admin/limits?ip=10.0.0.1&path=/items/MLA2", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %v", rr.Code, body)
+	}
+
+	limits := body["limits"].([]interface{})
+	if len(limits) != 3 {
+		t.Fatalf("expected ip, path and ip_path limits, got %v", limits)
+	}
+	byType := make(map[string]map[string]interface{})
+	for _, l := range limits {
+		view := l.(map[string]interface{})
+		byType[view["type"].(string)] = view
+	}
+
+	if path := byType["path"]; path["key"] != ratelimit.PathKey("/items/*") || path["limit"] != float64(5) ||
+		path["count"] != float64(3) || path["remaining"] != float64(2) {
+		t.Errorf("unexpected path limit: %v", path)
+	}
+	if ip := byType["ip"]; ip["count"] != float64(3) || ip["remaining"] != float64(7) {
+		t.Errorf("unexpected ip limit: %v", ip)
+	}
+
+	// Consultar no consume cupo
+	_, body = adminRequest(t, server.Handler(), "GET", "/admin/limits?path=/items/MLA2", "")
+	limits = body["limits"].([]interface{})
+	if len(limits) != 1 || limits[0].(map[string]interface{})["remaining"] != float64(2) {
+		t.Errorf("expected only path limit with 2 remaining, got %v", limits)
+	}
+
+	rr, body = adminRequest(t, server.Handler(), "DELETE", "/admin/limits?ip=10.0.0.1&path=/items/MLA2", "")
+	if rr.Code != http.StatusOK || len(body["reset"].([]interface{})) != 3 {
+		t.Fatalf("unexpected reset response %d: %v", rr.Code, body)
+	}
+
+	_, body = adminRequest(t, server.Handler(), "GET", "/admin/limits?path=/items/MLA2", "")
+	if got := body["limits"].([]interface{})[0].(map[string]interface{}); got["count"] != float64(0) {
+		t.Errorf("expected counter reset, got %v", got)
+	}
+}
+
+func TestAdminAPI_LimitsByIdentity(t *testing.T) {
+	resolver, err := ratelimit.NewIdentityResolver("header:X-API-Key", map[string]string{"key-acme": "pro"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ratelimit.SetIdentityResolver(resolver)
+	t.Cleanup(func() { ratelimit.SetIdentityResolver(nil) })
+
+	limiter := ratelimit.NewMemoryLimiter(0)
+	defer limiter.Close()
+	server, proxied := newAdminTest(t, limiter)
+
+	var client ratelimit.RequestKeys
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/users/1", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-API-Key", "key-acme")
+		proxied.ServeHTTP(httptest.NewRecorder(), req)
+		client = ratelimit.DeriveKeys(req)
+	}
+
+	for _, query := range []string{"api_key=key-acme", "identity=" + client.Identity} {
+		rr, body := adminRequest(t, server.Handler(), "GET", "/admin/limits?path=/users/1&"+query, "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %v", query, rr.Code, body)
+		}
+		byType := make(map[string]map[string]interface{})
+		for _, l := range body["limits"].([]interface{}) {
+			view := l.(map[string]interface{})
+			byType[view["type"].(string)] = view
+		}
+		if ip := byType["ip"]; ip["key"] != client.IPKey() || ip["count"] != float64(2) {
+			t.Errorf("%s: unexpected client limit: %v", query, ip)
+		}
+		if ipPath := byType["ip_path"]; ipPath["key"] != client.IPPathKey() || ipPath["count"] != float64(2) {
+			t.Errorf("%s: unexpected client path limit: %v", query, ipPath)
+		}
+	}
+
+	for _, query := range []string{
+		"api_key=unknown-key",
+		"identity=key:not-a-hash",
+		"identity=jwt:" + strings.Repeat("0", 32),
+		"api_key=key-acme&identity=" + client.Identity,
+	} {
+		if rr, body := adminRequest(t, server.Handler(), "GET", "/admin/limits?"+query, ""); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %v", query, rr.Code, body)
+		}
+	}
+}
+
+func TestAdminAPI_InvalidRequests(t *testing.T) {
+	limiter := ratelimit.NewMemoryLimiter(0)
+	defer limiter.Close()
+	server, _ := newAdminTest(t, limiter)
+
+	tests := []struct {
+		method, target string
+		status         int
+	}{
+		{"GET", "/admin/limits", http.StatusBadRequest},
+		{"GET", "/admin/limits?ip=not-an-ip", http.StatusBadRequest},
+		{"GET", "/admin/limits?path=items", http.StatusBadRequest},
+		{"POST", "/admin/limits?ip=10.0.0.1", http.StatusMethodNotAllowed},
+		{"POST", "/admin/rules", http.StatusMethodNotAllowed},
+		// Sin backend Redis no hay overrides
+		{"PUT", "/admin/overrides/block", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		rr, body := adminRequest(t, server.Handler(), tt.method, tt.target, `{"limit":1}`)
+		if rr.Code != tt.status {
+			t.Errorf("%s %s: expected %d, got %d", tt.method, tt.target, tt.status, rr.Code)
+		}
+		if body["error"] == nil {
+			t.Errorf("%s %s: expected JSON error, got %v", tt.method, tt.target, body)
+		}
+	}
+
+	server, _ = newAdminTest(t, ratelimit.NewDummyLimiter())
+	rr, _ := adminRequest(t, server.Handler(), "GET", "/admin/limits?ip=10.0.0.1", "")
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("expected 501 for limiter without inspection, got %d", rr.Code)
+	}
+}
+
+func TestMemoryLimiter_PeekAndReset(t *testing.T) {
+	limiter := ratelimit.NewMemoryLimiter(0)
+	defer limiter.Close()
+
+	ctx := context.Background()
+	limits := map[string]ratelimit.LimitConfig{
+		"ip::1.2.3.4": {Limit: 3, Window: time.Minute},
+		"gcra::key":   {Limit: 3, Window: time.Minute, Algorithm: ratelimit.AlgorithmGCRA},
+	}
+
+	results, _ := limiter.Peek(ctx, limits)
+	for key, result := range results {
+		if !result.Allowed || result.Remaining != 3 {
+			t.Errorf("%s: expected full quota before requests, got %+v", key, result)
+		}
+	}
+
+	limiter.CheckMultipleLimits(ctx, limits)
+	limiter.CheckMultipleLimits(ctx, limits)
+
+	for i := 0; i < 2; i++ {
+		results, _ = limiter.Peek(ctx, limits)
+		for key, result := range results {
+			if result.Remaining != 1 {
+				t.Errorf("%s: expected 1 remaining after 2 requests, got %+v", key, result)
+			}
+		}
+	}
+
+	limiter.Reset(ctx, "ip::1.2.3.4", "gcra::key")
+	results, _ = limiter.Peek(ctx, limits)
+	for key, result := range results {
+		if result.Remaining != 3 {
+			t.Errorf("%s: expected full quota after reset, got %+v", key, result)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andress1014/meli-proxy/internal/config"
+	"github.com/andress1014/meli-proxy/internal/middleware"
+	"github.com/andress1014/meli-proxy/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
+// flakyLimiter falla mientras down es 1; implementa HealthChecker
+type flakyLimiter struct {
+	down  int32
+	calls int32
+}
+
+func (f *flakyLimiter) CheckMultipleLimits(ctx context.Context, limits map[string]ratelimit.LimitConfig) (map[string]*ratelimit.LimitResult, error) {
+	atomic.AddInt32(&f.calls, 1)
+	if atomic.LoadInt32(&f.down) == 1 {
+		return nil, errors.New("connection refused")
+	}
+	results := make(map[string]*ratelimit.LimitResult)
+	for key, cfg := range limits {
+		results[key] = &ratelimit.LimitResult{Allowed: true, Remaining: cfg.Limit - 1, ResetTime: time.Now().Add(cfg.Window)}
+	}
+	return results, nil
+}
+
+func (f *flakyLimiter) HealthCheck(ctx context.Context) error {
+	if atomic.LoadInt32(&f.down) == 1 {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func (f *flakyLimiter) Close() error {
+	return nil
+}
+
+func TestCircuitBreakerLimiter(t *testing.T) {
+	primary := &flakyLimiter{down: 1}
+	breaker := ratelimit.NewCircuitBreakerLimiter(primary, nil, ratelimit.BreakerConfig{
+		FailureThreshold: 3,
+		ProbeInterval:    10 * time.Millisecond,
+		Instances:        2,
+	}, zap.NewNop())
+	defer breaker.Close()
+
+	ctx := context.Background()
+	limits := map[string]ratelimit.LimitConfig{
+		"ip::10.0.0.1": {Limit: 4, Window: time.Minute},
+	}
+
+	// Los errores se devuelven hasta alcanzar el umbral
+	for i := 0; i < 3; i++ {
+		if _, err := breaker.CheckMultipleLimits(ctx, limits); err == nil {
+			t.Fatalf("request %d: expected primary error while breaker is closed", i+1)
+		}
+	}
+	if breaker.State() != ratelimit.BreakerOpen {
+		t.Fatal("expected breaker to open after 3 consecutive failures")
+	}
+
+	// Abierto: el limiter local aplica 4/2 = 2 requests sin tocar el principal
+	calls := atomic.LoadInt32(&primary.calls)
+	for i := 0; i < 2; i++ {
+		results, err := breaker.CheckMultipleLimits(ctx, limits)
+		if !errors.Is(err, ratelimit.ErrBreakerOpen) {
+			t.Fatalf("expected ErrBreakerOpen with breaker open, got %v", err)
+		}
+		if !results["ip::10.0.0.1"].Allowed {
+			t.Errorf("request %d should be allowed by local limiter", i+1)
+		}
+	}
+	results, _ := breaker.CheckMultipleLimits(ctx, limits)
+	if results["ip::10.0.0.1"].Allowed {
+		t.Error("local limiter should enforce the per-instance share")
+	}
+	if atomic.LoadInt32(&primary.calls) != calls {
+		t.Error("primary limiter should not be called while breaker is open")
+	}
+
+	// Al recuperarse el principal, el probe cierra el breaker
+	atomic.StoreInt32(&primary.down, 0)
+	deadline := time.Now().Add(time.Second)
+	for breaker.State() != ratelimit.BreakerClosed && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if breaker.State() != ratelimit.BreakerClosed {
+		t.Fatal("expected breaker to close after primary recovered")
+	}
+	if _, err := breaker.CheckMultipleLimits(ctx, limits); err != nil {
+		t.Errorf("unexpected error after recovery: %v", err)
+	}
+}
+
+func TestCircuitBreakerLimiter_ResetsOnSuccess(t *testing.T) {
+	primary := &flakyLimiter{}
+	breaker := ratelimit.NewCircuitBreakerLimiter(primary, nil, ratelimit.BreakerConfig{
+		FailureThreshold: 2,
+		ProbeInterval:    time.Hour,
+	}, zap.NewNop())
+	defer breaker.Close()
+
+	ctx := context.Background()
+	limits := map[string]ratelimit.LimitConfig{"ip::10.0.0.1": {Limit: 10, Window: time.Minute}}
+
+	// Errores no consecutivos no abren el breaker
+	for i := 0; i < 3; i++ {
+		atomic.StoreInt32(&primary.down, 1)
+		breaker.CheckMultipleLimits(ctx, limits)
+		atomic.StoreInt32(&primary.down, 0)
+		breaker.CheckMultipleLimits(ctx, limits)
+	}
+	if breaker.State() != ratelimit.BreakerClosed {
+		t.Error("breaker should stay closed when failures are not consecutive")
+	}
+}
+
+func TestRateLimitMiddleware_BreakerOpenFailClosed(t *testing.T) {
+	primary := &flakyLimiter{down: 1}
+	breaker := ratelimit.NewCircuitBreakerLimiter(primary, nil, ratelimit.BreakerConfig{
+		FailureThreshold: 1,
+		ProbeInterval:    time.Hour,
+	}, zap.NewNop())
+	defer breaker.Close()
+
+	cfg := &config.Config{
+		DefaultRPS:       4,
+		PathFailPolicies: map[string]string{"/users/*": "closed"},
+	}
+	handler := middleware.NewRateLimitMiddleware(breaker, cfg, zap.NewNop()).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = "192.168.1.100:12345"
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// El primer error abre el breaker
+	serve("/items/MLA1")
+	if breaker.State() != ratelimit.BreakerOpen {
+		t.Fatal("expected breaker to open")
+	}
+
+	// Con el breaker abierto los paths fail-closed siguen rechazando
+	if rr := serve("/users/42"); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 for fail-closed path with breaker open, got %d", rr.Code)
+	}
+
+	// El resto usa los resultados del limiter local: ip_path = 4/2 = 2
+	for i := 0; i < 2; i++ {
+		if rr := serve("/items/MLA1"); rr.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200 from local limiter, got %d", i+1, rr.Code)
+		}
+	}
+	if rr := serve("/items/MLA1"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected local limiter to block, got %d", rr.Code)
+	}
+}
+
+func TestRateLimitMiddleware_SharedFallback(t *testing.T) {
+	fallback := ratelimit.NewMemoryLimiter(0)
+	defer fallback.Close()
+
+	primary := &flakyLimiter{down: 1}
+	breaker := ratelimit.NewCircuitBreakerLimiter(primary, fallback, ratelimit.BreakerConfig{
+		FailureThreshold: 1,
+		ProbeInterval:    time.Hour,
+		Instances:        2,
+	}, zap.NewNop())
+	defer breaker.Close()
+
+	cfg := &config.Config{
+		DefaultRPS:     2,
+		FailPolicy:     "local",
+		ProxyInstances: 2,
+	}
+	rateLimit := middleware.NewRateLimitMiddleware(breaker, cfg, zap.NewNop())
+	rateLimit.SetFallback(fallback)
+	defer rateLimit.Close()
+	handler := rateLimit.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func() int {
+		req := httptest.NewRequest("GET", "/items/MLA1", nil)
+		req.RemoteAddr = "192.168.1.100:12345"
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	// El error que abre el breaker lo resuelve el middleware con la política
+	// local: ip_path = 2/2 = 1 por instancia
+	if code := serve(); code != http.StatusOK {
+		t.Fatalf("expected 200 from the middleware's local limiter, got %d", code)
+	}
+	if breaker.State() != ratelimit.BreakerOpen {
+		t.Fatal("expected breaker to open")
+	}
+
+	// Con el breaker abierto el contador local es el mismo: no hay cupo nuevo
+	if code := serve(); code != http.StatusTooManyRequests {
+		t.Errorf("expected breaker to share the middleware's local counters, got %d", code)
+	}
+}
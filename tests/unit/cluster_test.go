@@ -13,14 +13,13 @@ import (
 func TestClusterLimiter(t *testing.T) {
 	logger, _ := zap.NewDevelopment()
 	config := ratelimit.ClusterConfig{
-		Addrs: []string{"localhost:6379"},
+		Addrs: []string{startMiniredis(t).Addr()},
 	}
 	
 	// This test will fail if Redis is not available - that's expected
 	limiter, err := ratelimit.NewClusterLimiter(config, logger)
 	if err != nil {
-		t.Logf("Redis cluster not available, skipping test: %v", err)
-		return
+		t.Fatalf("unexpected error: %v", err)
 	}
 	
 	ctx := context.Background()
@@ -60,13 +59,12 @@ func TestClusterLimiter(t *testing.T) {
 func TestClusterLimiterConcurrency(t *testing.T) {
 	logger, _ := zap.NewDevelopment()
 	config := ratelimit.ClusterConfig{
-		Addrs: []string{"localhost:6379"},
+		Addrs: []string{startMiniredis(t).Addr()},
 	}
 	
 	limiter, err := ratelimit.NewClusterLimiter(config, logger)
 	if err != nil {
-		t.Logf("Redis cluster not available, skipping test: %v", err)
-		return
+		t.Fatalf("unexpected error: %v", err)
 	}
 	
 	ctx := context.Background()
@@ -98,13 +96,12 @@ func TestClusterLimiterConcurrency(t *testing.T) {
 func TestClusterLimiterExceedsLimit(t *testing.T) {
 	logger, _ := zap.NewDevelopment()
 	config := ratelimit.ClusterConfig{
-		Addrs: []string{"localhost:6379"},
+		Addrs: []string{startMiniredis(t).Addr()},
 	}
 	
 	limiter, err := ratelimit.NewClusterLimiter(config, logger)
 	if err != nil {
-		t.Logf("Redis cluster not available, skipping test: %v", err)
-		return
+		t.Fatalf("unexpected error: %v", err)
 	}
 	
 	ctx := context.Background()
@@ -137,13 +134,12 @@ func TestClusterLimiterExceedsLimit(t *testing.T) {
 func TestClusterLimiterContextCancellation(t *testing.T) {
 	logger, _ := zap.NewDevelopment()
 	config := ratelimit.ClusterConfig{
-		Addrs: []string{"localhost:6379"},
+		Addrs: []string{startMiniredis(t).Addr()},
 	}
 	
 	limiter, err := ratelimit.NewClusterLimiter(config, logger)
 	if err != nil {
-		t.Logf("Redis cluster not available, skipping test: %v", err)
-		return
+		t.Fatalf("unexpected error: %v", err)
 	}
 	
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Millisecond)
@@ -161,3 +157,110 @@ func TestClusterLimiterContextCancellation(t *testing.T) {
 		t.Error("result should not be nil when error is nil")
 	}
 }
+
+func TestClusterHashTag(t *testing.T) {
+	tests := []struct {
+		key      string
+		expected string
+	}{
+		{ratelimit.IPKey("192.168.1.1"), "192.168.1.1"},
+		{ratelimit.IPKey("2001:db8::1"), "2001:db8::1"},
+		{ratelimit.IPPathKey("192.168.1.1", "/items/*"), "192.168.1.1"},
+		{ratelimit.IPPathKey("2001:db8::1", "/items/*"), "2001:db8::1"},
+		{ratelimit.PathKey("/items/*"), "/items/*"},
+		{"plain-key", "plain-key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := ratelimit.ClusterHashTag(tt.key); got != tt.expected {
+				t.Errorf("ClusterHashTag(%q) = %q, want %q", tt.key, got, tt.expected)
+			}
+		})
+	}
+
+	// ip e ip_path del mismo cliente deben caer en el mismo slot
+	ip := "2001:db8::42"
+	if ratelimit.ClusterHashTag(ratelimit.IPKey(ip)) != ratelimit.ClusterHashTag(ratelimit.IPPathKey(ip, "/users/*")) {
+		t.Error("ip and ip_path keys should share the same hash tag")
+	}
+}
+
+func TestClusterLimiterCheckMultipleLimits(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	config := ratelimit.ClusterConfig{
+		Addrs: []string{startMiniredis(t).Addr()},
+	}
+
+	limiter, err := ratelimit.NewClusterLimiter(config, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer limiter.Close()
+
+	ip := "cluster-" + time.Now().String()
+	limits := map[string]ratelimit.LimitConfig{
+		ratelimit.IPKey(ip):                 {Limit: 10, Window: time.Minute},
+		ratelimit.IPPathKey(ip, "/items/*"): {Limit: 1, Window: time.Minute},
+		ratelimit.PathKey("/items/*"):       {Limit: 1000, Window: time.Minute},
+	}
+
+	results, err := limiter.CheckMultipleLimits(context.Background(), limits)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 3 {
+		t.Errorf("expected 3 results, got %d", len(results))
+	}
+
+	// El segundo request lo rechaza ip_path y el path global no se evalúa
+	results, err = limiter.CheckMultipleLimits(context.Background(), limits)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result := results[ratelimit.IPPathKey(ip, "/items/*")]; result == nil || result.Allowed {
+		t.Error("expected ip_path limit to reject the second request")
+	}
+	if _, evaluated := results[ratelimit.PathKey("/items/*")]; evaluated {
+		t.Error("expected path group to be skipped after rejection")
+	}
+}
+
+func TestClusterLimiterCheckMultipleLimits_PathRejectionKeepsClientQuota(t *testing.T) {
+	mr := startMiniredis(t)
+	limiter, err := ratelimit.NewClusterLimiter(ratelimit.ClusterConfig{Addrs: []string{mr.Addr()}}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer limiter.Close()
+
+	ip := "203.0.113.1"
+	ipKey, ipPathKey := ratelimit.IPKey(ip), ratelimit.IPPathKey(ip, "/items/*")
+	limits := map[string]ratelimit.LimitConfig{
+		ipKey:                         {Limit: 10, Window: time.Minute},
+		ipPathKey:                     {Limit: 10, Window: time.Minute},
+		ratelimit.PathKey("/items/*"): {Limit: 1, Window: time.Minute},
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		results, err := limiter.CheckMultipleLimits(ctx, limits)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if allowed := results[ratelimit.PathKey("/items/*")].Allowed; allowed != (i == 0) {
+			t.Errorf("request %d: expected path allowed=%v, got %v", i+1, i == 0, allowed)
+		}
+	}
+
+	// Solo el primer request registra en los contadores del cliente
+	for _, key := range []string{ipKey, ipPathKey} {
+		members, err := mr.ZMembers("{" + ip + "}:" + key)
+		if err != nil {
+			t.Fatalf("unexpected error reading %s: %v", key, err)
+		}
+		if len(members) != 1 {
+			t.Errorf("expected 1 request recorded in %s, got %d", key, len(members))
+		}
+	}
+}
@@ -2,12 +2,17 @@ package unit
 
 import (
 	"testing"
+	"time"
 
 	"github.com/andress1014/meli-proxy/internal/config"
+	"github.com/andress1014/meli-proxy/internal/ratelimit"
 )
 
 func TestConfigLoad_DefaultValues(t *testing.T) {
-	cfg := config.Load()
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
 
 	// Verificar valores por defecto
 	if cfg.Port != "8080" {
@@ -97,3 +102,216 @@ func TestConfigRateLimitParsing(t *testing.T) {
 		})
 	}
 }
+
+func TestConfigLoad_RateLimitBackend(t *testing.T) {
+	tests := []struct {
+		name         string
+		backend      string
+		redisEnabled string
+		expected     string
+	}{
+		{"default redis", "", "", "redis"},
+		{"redis disabled falls back to dummy", "", "false", "dummy"},
+		{"explicit memory", "memory", "", "memory"},
+		{"explicit backend wins over redis flag", "Memory", "false", "memory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("RATE_LIMIT_BACKEND", tt.backend)
+			t.Setenv("REDIS_ENABLED", tt.redisEnabled)
+
+			cfg, err := config.Load()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.RateLimitBackend != tt.expected {
+				t.Errorf("expected backend %s, got %s", tt.expected, cfg.RateLimitBackend)
+			}
+		})
+	}
+}
+
+func TestConfigLoad_RedisCluster(t *testing.T) {
+	t.Setenv("RATE_LIMIT_BACKEND", "")
+	t.Setenv("REDIS_CLUSTER_ADDRS", "redis-1:6379, redis-2:6379,,redis-3:6379")
+	t.Setenv("REDIS_POOL_SIZE", "500")
+	t.Setenv("REDIS_READ_TIMEOUT", "250ms")
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.RateLimitBackend != "cluster" {
+		t.Errorf("expected cluster backend when REDIS_CLUSTER_ADDRS is set, got %s", cfg.RateLimitBackend)
+	}
+	if len(cfg.RedisClusterAddrs) != 3 || cfg.RedisClusterAddrs[1] != "redis-2:6379" {
+		t.Errorf("unexpected cluster addrs: %v", cfg.RedisClusterAddrs)
+	}
+	if cfg.RedisPoolSize != 500 {
+		t.Errorf("expected pool size 500, got %d", cfg.RedisPoolSize)
+	}
+	if cfg.RedisReadTimeout != 250*time.Millisecond {
+		t.Errorf("expected read timeout 250ms, got %v", cfg.RedisReadTimeout)
+	}
+}
+
+func TestConfigLoad_RedisSentinel(t *testing.T) {
+	t.Setenv("RATE_LIMIT_BACKEND", "")
+	t.Setenv("REDIS_CLUSTER_ADDRS", "")
+	t.Setenv("REDIS_SENTINEL_MASTER", "mymaster")
+	t.Setenv("REDIS_SENTINEL_ADDRS", "sentinel-1:26379,sentinel-2:26379")
+	t.Setenv("REDIS_SENTINEL_PASSWORD", "secret")
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.RateLimitBackend != "sentinel" {
+		t.Errorf("expected sentinel backend when REDIS_SENTINEL_MASTER is set, got %s", cfg.RateLimitBackend)
+	}
+	if cfg.RedisSentinelMaster != "mymaster" {
+		t.Errorf("expected master mymaster, got %s", cfg.RedisSentinelMaster)
+	}
+	if len(cfg.RedisSentinelAddrs) != 2 || cfg.RedisSentinelAddrs[1] != "sentinel-2:26379" {
+		t.Errorf("unexpected sentinel addrs: %v", cfg.RedisSentinelAddrs)
+	}
+	if cfg.RedisSentinelPassword != "secret" {
+		t.Errorf("expected sentinel password to be loaded")
+	}
+}
+
+func TestConfigLoad_FailPolicy(t *testing.T) {
+	t.Setenv("RATE_LIMIT_FAIL_POLICY", "local")
+	t.Setenv("PATH_RATE_LIMIT_FAIL_POLICIES", "/items/*:closed,/sites/*:open")
+	t.Setenv("PROXY_INSTANCES", "4")
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.FailPolicy != "local" {
+		t.Errorf("expected fail policy local, got %s", cfg.FailPolicy)
+	}
+	if cfg.PathFailPolicies["/items/*"] != "closed" || cfg.PathFailPolicies["/sites/*"] != "open" {
+		t.Errorf("unexpected path fail policies: %v", cfg.PathFailPolicies)
+	}
+	if cfg.ProxyInstances != 4 {
+		t.Errorf("expected 4 proxy instances, got %d", cfg.ProxyInstances)
+	}
+}
+
+func TestConfigLoad_Breaker(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.BreakerEnabled {
+		t.Error("breaker should be disabled by default")
+	}
+	if cfg.BreakerThreshold != 5 || cfg.BreakerProbeInterval != 5*time.Second {
+		t.Errorf("unexpected breaker defaults: %d %v", cfg.BreakerThreshold, cfg.BreakerProbeInterval)
+	}
+
+	t.Setenv("RATE_LIMIT_BREAKER_ENABLED", "true")
+	t.Setenv("RATE_LIMIT_BREAKER_THRESHOLD", "10")
+	t.Setenv("RATE_LIMIT_BREAKER_PROBE_INTERVAL", "2s")
+
+	cfg, err = config.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.BreakerEnabled || cfg.BreakerThreshold != 10 || cfg.BreakerProbeInterval != 2*time.Second {
+		t.Errorf("unexpected breaker config: %v %d %v", cfg.BreakerEnabled, cfg.BreakerThreshold, cfg.BreakerProbeInterval)
+	}
+}
+
+func TestConfigLoad_IPPathRateLimits(t *testing.T) {
+	t.Setenv("IP_PATH_RATE_LIMITS", "192.168.1.100::/categories/*:100, ::1::/items/*:5")
+	t.Setenv("IP_RATE_LIMITS", "2001:db8::1:50")
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.IPPathRateLimit["192.168.1.100::/categories/*"] != 100 {
+		t.Errorf("expected ip_path limit 100, got %v", cfg.IPPathRateLimit)
+	}
+	if cfg.IPPathRateLimit["::1::/items/*"] != 5 {
+		t.Errorf("expected IPv6 ip_path limit 5, got %v", cfg.IPPathRateLimit)
+	}
+	if cfg.IPRateLimit["2001:db8::1"] != 50 {
+		t.Errorf("expected IPv6 ip limit 50, got %v", cfg.IPRateLimit)
+	}
+}
+
+func TestConfigLoad_Overrides(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.OverridesEnabled || cfg.OverridesKey != ratelimit.DefaultOverridesKey {
+		t.Errorf("unexpected overrides defaults: %v %q", cfg.OverridesEnabled, cfg.OverridesKey)
+	}
+
+	t.Setenv("RATE_LIMIT_OVERRIDES_ENABLED", "true")
+	t.Setenv("RATE_LIMIT_OVERRIDES_KEY", "proxy:limits")
+
+	cfg, err = config.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.OverridesEnabled || cfg.OverridesKey != "proxy:limits" {
+		t.Errorf("unexpected overrides config: %v %q", cfg.OverridesEnabled, cfg.OverridesKey)
+	}
+}
+
+func TestConfigLoad_Admin(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.AdminPort != "9091" || cfg.AdminToken != "" {
+		t.Errorf("unexpected admin defaults: %q %q", cfg.AdminPort, cfg.AdminToken)
+	}
+
+	t.Setenv("ADMIN_PORT", "7000")
+	t.Setenv("ADMIN_TOKEN", "secret")
+
+	cfg, err = config.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.AdminPort != "7000" || cfg.AdminToken != "secret" {
+		t.Errorf("unexpected admin config: %q %q", cfg.AdminPort, cfg.AdminToken)
+	}
+}
+
+func TestConfigLoad_TrustedProxies(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.TrustedProxies) != 0 {
+		t.Errorf("expected no trusted proxies by default, got %v", cfg.TrustedProxies)
+	}
+
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 127.0.0.1,fd00::/8")
+
+	cfg, err = config.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.TrustedProxies) != 3 || cfg.TrustedProxies[1].String() != "127.0.0.1/32" {
+		t.Errorf("unexpected trusted proxies: %v", cfg.TrustedProxies)
+	}
+
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8,nginx")
+	if _, err := config.Load(); err == nil {
+		t.Error("expected error for invalid trusted proxy")
+	}
+}
@@ -0,0 +1,65 @@
+package unit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andress1014/meli-proxy/internal/ratelimit"
+)
+
+func TestParseFailPolicy(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    ratelimit.FailPolicy
+		expectError bool
+	}{
+		{"", ratelimit.FailOpen, false},
+		{"open", ratelimit.FailOpen, false},
+		{" Closed ", ratelimit.FailClosed, false},
+		{"local", ratelimit.FailLocal, false},
+		{"retry", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			policy, err := ratelimit.ParseFailPolicy(tt.input)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error for %q", tt.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if policy != tt.expected {
+				t.Errorf("ParseFailPolicy(%q) = %s, want %s", tt.input, policy, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLocalShare(t *testing.T) {
+	config := ratelimit.LimitConfig{Limit: 100, Window: time.Minute, Burst: 30}
+
+	share := ratelimit.LocalShare(config, 3)
+	if share.Limit != 33 {
+		t.Errorf("expected limit 33, got %d", share.Limit)
+	}
+	if share.Burst != 10 {
+		t.Errorf("expected burst 10, got %d", share.Burst)
+	}
+	if share.Window != time.Minute {
+		t.Errorf("window should not change, got %v", share.Window)
+	}
+
+	// Nunca por debajo de 1 request
+	if share := ratelimit.LocalShare(ratelimit.LimitConfig{Limit: 2, Window: time.Minute}, 10); share.Limit != 1 {
+		t.Errorf("expected minimum limit 1, got %d", share.Limit)
+	}
+
+	// Una sola instancia usa el límite global
+	if share := ratelimit.LocalShare(config, 0); share.Limit != 100 {
+		t.Errorf("expected unchanged limit, got %d", share.Limit)
+	}
+}
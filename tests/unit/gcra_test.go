@@ -0,0 +1,52 @@
+package unit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/andress1014/meli-proxy/internal/ratelimit"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestGCRALimiter_RetryAfter(t *testing.T) {
+	client := newTestRedisClient(t)
+	ctx := context.Background()
+
+	limiter := ratelimit.NewGCRALimiter(client)
+	key := "test::gcra::" + time.Now().String()
+	defer client.Del(ctx, key)
+
+	// 60 req/min => un request cada segundo, ráfaga de 3
+	for i := 0; i < 3; i++ {
+		result, err := limiter.CheckLimit(ctx, key, 60, 3, time.Minute)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.Allowed {
+			t.Fatalf("expected request %d to be allowed", i)
+		}
+	}
+
+	result, err := limiter.CheckLimit(ctx, key, 60, 3, time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Allowed {
+		t.Fatal("expected request to be rejected after burst")
+	}
+	if result.RetryAfter <= 0 || result.RetryAfter > time.Second {
+		t.Errorf("expected retry after in (0, 1s], got %v", result.RetryAfter)
+	}
+}
+
+func TestGCRALimiter_InvalidConfig(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	defer client.Close()
+
+	limiter := ratelimit.NewGCRALimiter(client)
+
+	if _, err := limiter.CheckLimit(context.Background(), "key", -1, 0, time.Minute); err == nil {
+		t.Error("expected error for negative limit")
+	}
+}
@@ -0,0 +1,252 @@
+package unit
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andress1014/meli-proxy/internal/auth"
+	"github.com/andress1014/meli-proxy/internal/config"
+	"github.com/andress1014/meli-proxy/internal/middleware"
+	"github.com/andress1014/meli-proxy/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
+// unsignedJWT arma un JWT con el payload indicado; la firma no se verifica
+func unsignedJWT(payload string) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	return encode([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + encode([]byte(payload)) + ".c2lnbmF0dXJl"
+}
+
+func TestIdentityResolver_Sources(t *testing.T) {
+	tests := []struct {
+		source   string
+		header   string
+		value    string
+		kind     string
+		expected string // credencial que debe dar la misma identidad
+	}{
+		{"header:x-api-key", "X-Api-Key", "secret-key", "key:", "secret-key"},
+		{"bearer", "Authorization", "Bearer opaque-token", "token:", "opaque-token"},
+		{"jwt:sub", "Authorization", "Bearer " + unsignedJWT(`{"sub":"acme"}`), "jwt:", "acme"},
+		{"jwt:client_id", "Authorization", "bearer " + unsignedJWT(`{"client_id":42}`), "jwt:", "42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			resolver, err := ratelimit.NewIdentityResolver(tt.source, map[string]string{tt.expected: "pro"}, "free")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			resolver.SetTrustUpstreamJWT(true)
+
+			req := httptest.NewRequest("GET", "/items", nil)
+			req.Header.Set(tt.header, tt.value)
+			identity, tier := resolver.Identify(req)
+			if !strings.HasPrefix(identity, tt.kind) || tier != "pro" {
+				t.Errorf("Identify() = %s, %s", identity, tier)
+			}
+			if strings.Contains(identity, tt.expected) {
+				t.Errorf("identity should not contain the credential: %s", identity)
+			}
+
+			// Sin credencial se vuelve a la IP
+			if identity, tier := resolver.Identify(httptest.NewRequest("GET", "/items", nil)); identity != "" || tier != "" {
+				t.Errorf("expected no identity without credential, got %s, %s", identity, tier)
+			}
+		})
+	}
+}
+
+func TestIdentityResolver_DefaultTierAndInvalidCredentials(t *testing.T) {
+	resolver, err := ratelimit.NewIdentityResolver("jwt:sub", nil, "free")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver.SetTrustUpstreamJWT(true)
+
+	for _, auth := range []string{
+		"Bearer not-a-jwt",
+		"Bearer " + unsignedJWT(`{"other":"x"}`),
+		"Bearer " + unsignedJWT(`{"sub":{"nested":true}}`),
+		"Basic dXNlcjpwYXNz",
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", auth)
+		if identity, _ := resolver.Identify(req); identity != "" {
+			t.Errorf("expected no identity for %q, got %s", auth, identity)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+unsignedJWT(`{"sub":"unknown"}`))
+	if identity, tier := resolver.Identify(req); identity == "" || tier != "free" {
+		t.Errorf("expected default tier, got %s, %s", identity, tier)
+	}
+
+	for _, source := range []string{"header", "header:", "jwt", "cookie:session"} {
+		if _, err := ratelimit.NewIdentityResolver(source, nil, ""); err == nil {
+			t.Errorf("expected error for source %q", source)
+		}
+	}
+}
+
+func TestIdentityResolver_UnverifiedJWT(t *testing.T) {
+	resolver, err := ratelimit.NewIdentityResolver("jwt:sub", map[string]string{"acme": "pro"}, "free")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sin claims verificados en el contexto un sub inventado no da identidad
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+unsignedJWT(`{"sub":"acme"}`))
+	if identity, tier := resolver.Identify(req); identity != "" || tier != "" {
+		t.Errorf("expected forged claim to be ignored, got %s, %s", identity, tier)
+	}
+
+	// Los claims verificados por el middleware de JWT sí se usan
+	verified := req.WithContext(auth.WithClaims(req.Context(), auth.Claims{"sub": "acme"}))
+	if identity, tier := resolver.Identify(verified); identity == "" || tier != "pro" {
+		t.Errorf("expected verified identity, got %s, %s", identity, tier)
+	}
+}
+
+func TestRateLimitMiddleware_IdentityTiers(t *testing.T) {
+	resolver, err := ratelimit.NewIdentityResolver("header:X-API-Key", map[string]string{"key-pro": "pro", "key-free": "free"}, "free")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ratelimit.SetIdentityResolver(resolver)
+	t.Cleanup(func() { ratelimit.SetIdentityResolver(nil) })
+
+	limiter := &recordingLimiter{}
+	cfg := &config.Config{
+		DefaultRPS:    100,
+		IPRateLimit:   map[string]int{"198.51.100.0/24": 5},
+		IdentityTiers: map[string]int{"free": 60, "pro": 1000},
+	}
+	handler := middleware.NewRateLimitMiddleware(limiter, cfg, zap.NewNop()).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Misma IP (NAT compartido), credenciales distintas
+	serve := func(apiKey string) ratelimit.RequestKeys {
+		req := httptest.NewRequest("GET", "/items/MLA1", nil)
+		req.RemoteAddr = "198.51.100.1:1234"
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		limiter.limits = nil
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		return ratelimit.DeriveKeys(req)
+	}
+
+	pro := serve("key-pro")
+	if !strings.HasPrefix(pro.IPKey(), "client::key:") || pro.Tier != "pro" {
+		t.Fatalf("unexpected keys: %+v", pro)
+	}
+	if limiter.limits[pro.IPKey()].Limit != 1000 || limiter.limits[pro.IPPathKey()].Limit != 500 {
+		t.Errorf("expected pro tier limits, got %v", limiter.limits)
+	}
+
+	free := serve("key-free")
+	if free.IPKey() == pro.IPKey() || limiter.limits[free.IPKey()].Limit != 60 {
+		t.Errorf("expected separate key with free tier, got %v", limiter.limits)
+	}
+
+	// Sin credencial o con una desconocida se aplica el límite de la IP
+	for _, apiKey := range []string{"", "unknown-key"} {
+		anonymous := serve(apiKey)
+		if anonymous.IPKey() != ratelimit.IPKey("198.51.100.1") || limiter.limits[anonymous.IPKey()].Limit != 5 {
+			t.Errorf("%q: expected IP fallback, got %v", apiKey, limiter.limits)
+		}
+	}
+
+	// La identidad es el hash tag en Redis Cluster
+	if tag := ratelimit.ClusterHashTag(pro.IPPathKey()); tag != pro.Identity || ratelimit.ClusterHashTag(pro.IPKey()) != tag {
+		t.Errorf("unexpected hash tag %s for %s", tag, pro.IPPathKey())
+	}
+}
+
+func TestRateLimitMiddleware_RotatingUnknownKeys(t *testing.T) {
+	resolver, err := ratelimit.NewIdentityResolver("header:X-API-Key", map[string]string{"key-pro": "pro"}, "free")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ratelimit.SetIdentityResolver(resolver)
+	t.Cleanup(func() { ratelimit.SetIdentityResolver(nil) })
+
+	limiter := ratelimit.NewMemoryLimiter(0)
+	defer limiter.Close()
+	cfg := &config.Config{
+		DefaultRPS:    100,
+		IPRateLimit:   map[string]int{"198.51.100.1": 3},
+		IdentityTiers: map[string]int{"free": 60, "pro": 1000},
+	}
+	handler := middleware.NewRateLimitMiddleware(limiter, cfg, zap.NewNop()).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Una API key inventada por request no escapa al límite de la IP
+	codes := make([]int, 0, 4)
+	for i := 0; i < 4; i++ {
+		req := httptest.NewRequest("GET", "/users/"+strconv.Itoa(i), nil)
+		req.RemoteAddr = "198.51.100.1:1234"
+		req.Header.Set("X-API-Key", "random-"+strconv.FormatInt(time.Now().UnixNano(), 36))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		codes = append(codes, rr.Code)
+	}
+	if codes[2] != http.StatusOK || codes[3] != http.StatusTooManyRequests {
+		t.Errorf("expected rotating unknown keys to hit the IP limit, got %v", codes)
+	}
+}
+
+func TestConfigLoad_Identity(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil || cfg.IdentitySource != ratelimit.IdentitySourceIP {
+		t.Fatalf("expected IP identity by default, got %q (%v)", cfg.IdentitySource, err)
+	}
+
+	t.Setenv("IDENTITY_SOURCE", "header:X-API-Key")
+	t.Setenv("IDENTITY_TIERS", "free:60,pro:1000")
+	t.Setenv("IDENTITY_CLIENTS", "key-a:pro,key-b:free")
+	t.Setenv("IDENTITY_DEFAULT_TIER", "free")
+	cfg, err = config.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.IdentityTiers["pro"] != 1000 || cfg.IdentityClients["key-a"] != "pro" || cfg.IdentityDefaultTier != "free" {
+		t.Errorf("unexpected identity config: %+v", cfg)
+	}
+
+	t.Setenv("IDENTITY_CLIENTS", "key-a:gold")
+	if _, err := config.Load(); err == nil {
+		t.Error("expected error for unknown tier")
+	}
+
+	t.Setenv("IDENTITY_CLIENTS", "")
+	t.Setenv("IDENTITY_SOURCE", "cookie:session")
+	if _, err := config.Load(); err == nil {
+		t.Error("expected error for invalid source")
+	}
+
+	// jwt:<claim> exige tokens verificados o confiar explícitamente en el gateway
+	t.Setenv("IDENTITY_SOURCE", "jwt:sub")
+	if _, err := config.Load(); err == nil || !strings.Contains(err.Error(), "JWT_ENABLED") {
+		t.Errorf("expected error for unverified jwt identity, got %v", err)
+	}
+	t.Setenv("IDENTITY_JWT_TRUST_UPSTREAM", "true")
+	if cfg, err := config.Load(); err != nil || !cfg.IdentityTrustUpstreamJWT {
+		t.Errorf("expected upstream trust opt-in to be accepted, got %v", err)
+	}
+	t.Setenv("IDENTITY_JWT_TRUST_UPSTREAM", "false")
+	t.Setenv("JWT_ENABLED", "true")
+	t.Setenv("JWT_HS256_SECRET", "secret")
+	if _, err := config.Load(); err != nil {
+		t.Errorf("expected jwt identity with JWT_ENABLED, got %v", err)
+	}
+}
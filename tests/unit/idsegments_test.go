@@ -0,0 +1,176 @@
+package unit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andress1014/meli-proxy/internal/config"
+	"github.com/andress1014/meli-proxy/internal/middleware"
+	"github.com/andress1014/meli-proxy/internal/ratelimit"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+func TestIDDetector_Normalize(t *testing.T) {
+	detector := ratelimit.NewIDDetector()
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/orders/2000001234", "/orders/*"},
+		{"/questions/MLA123456789/answers", "/questions/*/answers"},
+		{"/reviews/item/MLB99", "/reviews/item/*"},
+		{"/sessions/550e8400-e29b-41d4-a716-446655440000", "/sessions/*"},
+		{"/files/d41d8cd98f00b204e9800998ecf8427e", "/files/*"},
+		{"/objects/507f1f77bcf86cd799439011", "/objects/*"},
+		{"/users/123/orders/456", "/users/*/orders/*"},
+		{"/api/v1/health", "/api/v1/health"},
+		{"/sites/MLA", "/sites/MLA"},
+		{"/currencies/ARS", "/currencies/ARS"},
+		{"/words/deadbeefcafebabe", "/words/deadbeefcafebabe"},
+		{"/short/abc123", "/short/abc123"},
+		{"/lower/mla123", "/lower/mla123"},
+		{"/almost/550e8400-e29b-41d4-a716-44665544000g", "/almost/550e8400-e29b-41d4-a716-44665544000g"},
+		{"/", "/"},
+	}
+	for _, tt := range tests {
+		if got := detector.Normalize(tt.path); got != tt.expected {
+			t.Errorf("Normalize(%s) = %s, want %s", tt.path, got, tt.expected)
+		}
+	}
+
+	detected := detector.Detected()
+	if len(detected) != 7 || detected[0].Pattern != "/files/*" || detected[0].Count != 1 {
+		t.Fatalf("unexpected detected patterns: %+v", detected)
+	}
+	detector.Normalize("/orders/1")
+	detector.Normalize("/orders/2")
+	if top := detector.Detected()[0]; top.Pattern != "/orders/*" || top.Count != 3 || top.Example != "/orders/2000001234" {
+		t.Errorf("unexpected top pattern: %+v", top)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		detector.Normalize("/api/v1/health")
+	})
+	if allocs != 0 {
+		t.Errorf("Normalize without IDs allocated %.0f times", allocs)
+	}
+}
+
+func TestNormalizePath_IDDetection(t *testing.T) {
+	if got := ratelimit.NormalizePath("/orders/123"); got != "/orders/123" {
+		t.Errorf("ID detection should be disabled by default, got %s", got)
+	}
+
+	ratelimit.SetIDDetection(true)
+	t.Cleanup(func() { ratelimit.SetIDDetection(false) })
+	if err := ratelimit.SetPathTemplates([]string{"/orders/{id}/notes"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ratelimit.SetPathTemplates(nil) })
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/orders/123?x=1", "/orders/*"},
+		{"/orders/123/notes", "/orders/*/notes"},
+		{"/items/MLA123/description", "/items/*"},
+		{"/orders/123/", "/orders/*"},
+	}
+	for _, tt := range tests {
+		if got := ratelimit.NormalizePath(tt.path); got != tt.expected {
+			t.Errorf("NormalizePath(%s) = %s, want %s", tt.path, got, tt.expected)
+		}
+	}
+
+	// Los templates tienen prioridad: solo se registran los paths sin template
+	detected := ratelimit.ActiveIDDetector().Detected()
+	if len(detected) != 1 || detected[0].Pattern != "/orders/*" || detected[0].Count != 2 {
+		t.Errorf("unexpected detected patterns: %+v", detected)
+	}
+}
+
+func TestIDDetection_KeysAndMetrics(t *testing.T) {
+	ratelimit.SetIDDetection(true)
+	t.Cleanup(func() { ratelimit.SetIDDetection(false) })
+
+	limiter := &recordingLimiter{}
+	cfg := &config.Config{DefaultRPS: 100}
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler = middleware.NewRateLimitMiddleware(limiter, cfg, zap.NewNop()).Handler(handler)
+	handler = middleware.NewMetricsMiddleware().Handler(handler)
+
+	req := httptest.NewRequest("GET", "/orders/2000001234", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if _, ok := limiter.limits[ratelimit.PathKey("/orders/*")]; !ok {
+		t.Errorf("expected normalized path key, got %v", limiter.limits)
+	}
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != "meli_proxy_requests_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "path" && label.GetValue() == "/orders/2000001234" {
+					t.Error("raw path with ID should not be used as metric label")
+				}
+				if label.GetName() == "path" && label.GetValue() == "/orders/*" {
+					return
+				}
+			}
+		}
+	}
+	t.Error("expected request metric with normalized path label")
+}
+
+func TestAdminAPI_Paths(t *testing.T) {
+	limiter := ratelimit.NewMemoryLimiter(0)
+	defer limiter.Close()
+	server, _ := newAdminTest(t, limiter)
+
+	_, body := adminRequest(t, server.Handler(), "GET", "/admin/paths?path=/items/MLA1/description", "")
+	if body["id_detection"] != false || len(body["templates"].([]interface{})) != 4 || len(body["detected"].([]interface{})) != 0 {
+		t.Errorf("unexpected paths response: %v", body)
+	}
+	if preview := body["path"].(map[string]interface{}); preview["normalized"] != "/items/*" {
+		t.Errorf("unexpected preview: %v", preview)
+	}
+
+	ratelimit.SetIDDetection(true)
+	t.Cleanup(func() { ratelimit.SetIDDetection(false) })
+	ratelimit.NormalizePath("/orders/123")
+
+	_, body = adminRequest(t, server.Handler(), "GET", "/admin/paths", "")
+	detected := body["detected"].([]interface{})
+	if body["id_detection"] != true || len(detected) != 1 {
+		t.Fatalf("unexpected paths response: %v", body)
+	}
+	if entry := detected[0].(map[string]interface{}); entry["pattern"] != "/orders/*" || entry["example"] != "/orders/123" || entry["count"] != float64(1) {
+		t.Errorf("unexpected detected entry: %v", entry)
+	}
+
+	// Las consultas del admin no cuentan como tráfico para la detección
+	_, body = adminRequest(t, server.Handler(), "GET", "/admin/paths?path=/orders/456", "")
+	if preview := body["path"].(map[string]interface{}); preview["normalized"] != "/orders/*" {
+		t.Errorf("unexpected preview: %v", preview)
+	}
+	adminRequest(t, server.Handler(), "GET", "/admin/paths?path=/reviews/789", "")
+	adminRequest(t, server.Handler(), "GET", "/admin/limits?ip=10.0.0.1&path=/questions/789", "")
+
+	_, body = adminRequest(t, server.Handler(), "GET", "/admin/paths", "")
+	detected = body["detected"].([]interface{})
+	if len(detected) != 1 || detected[0].(map[string]interface{})["count"] != float64(1) {
+		t.Errorf("admin probes should not be recorded, got %v", detected)
+	}
+}
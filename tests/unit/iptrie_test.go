@@ -0,0 +1,220 @@
+package unit
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/andress1014/meli-proxy/internal/config"
+	"github.com/andress1014/meli-proxy/internal/middleware"
+	"github.com/andress1014/meli-proxy/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
+func TestIPTrie_LongestPrefixMatch(t *testing.T) {
+	trie := ratelimit.NewIPTrie[int]()
+	for cidr, limit := range map[string]int{
+		"10.0.0.0/8":        1,
+		"10.1.0.0/16":       2,
+		"10.1.2.0/24":       3,
+		"10.1.2.3":          4,
+		"192.168.0.0/16":    5,
+		"2001:db8::/32":     6,
+		"2001:db8:1::/48":   7,
+		"2001:db8:1::1/128": 8,
+	} {
+		if err := trie.Insert(cidr, limit); err != nil {
+			t.Fatalf("unexpected error for %s: %v", cidr, err)
+		}
+	}
+	if trie.Len() != 8 {
+		t.Errorf("expected 8 prefixes, got %d", trie.Len())
+	}
+
+	tests := []struct {
+		ip    string
+		limit int
+		found bool
+	}{
+		{"10.200.0.1", 1, true},
+		{"10.1.200.1", 2, true},
+		{"10.1.2.200", 3, true},
+		{"10.1.2.3", 4, true},
+		{"::ffff:10.1.2.3", 4, true},
+		{"192.168.50.1", 5, true},
+		{"172.16.0.1", 0, false},
+		{"2001:db8:ffff::1", 6, true},
+		{"2001:db8:1::2", 7, true},
+		{"2001:db8:1::1", 8, true},
+		{"2001:db9::1", 0, false},
+		{"not-an-ip", 0, false},
+	}
+	for _, tt := range tests {
+		limit, found := trie.Lookup(tt.ip)
+		if limit != tt.limit || found != tt.found {
+			t.Errorf("Lookup(%s) = %d, %v; expected %d, %v", tt.ip, limit, found, tt.limit, tt.found)
+		}
+	}
+}
+
+func TestIPTrie_AddressFamilies(t *testing.T) {
+	trie := ratelimit.NewIPTrie[string]()
+	trie.Insert("::/0", "v6")
+	trie.Insert("::ffff:198.51.100.0/120", "mapped")
+
+	// Un prefijo IPv6 no contiene IPv4, ni siquiera escrita como IPv4-mapped
+	for _, ip := range []string{"203.0.113.1", "::ffff:203.0.113.1"} {
+		if got, found := trie.Lookup(ip); found {
+			t.Errorf("Lookup(%s) = %q; expected no match for ::/0", ip, got)
+		}
+	}
+	if got, _ := trie.Lookup("2001:db8::1"); got != "v6" {
+		t.Errorf("expected ::/0 to match 2001:db8::1, got %q", got)
+	}
+
+	// Un prefijo IPv4-mapped se guarda como IPv4
+	if got, _ := trie.Lookup("198.51.100.7"); got != "mapped" {
+		t.Errorf("expected mapped prefix to match 198.51.100.7, got %q", got)
+	}
+
+	trie.Insert("0.0.0.0/0", "v4")
+	if got, _ := trie.Lookup("203.0.113.1"); got != "v4" {
+		t.Errorf("expected 0.0.0.0/0 to match 203.0.113.1, got %q", got)
+	}
+	if got := trie.LookupAll(netip.MustParseAddr("2001:db8::1")); len(got) != 1 || got[0] != "v6" {
+		t.Errorf("expected only ::/0 for 2001:db8::1, got %v", got)
+	}
+}
+
+func TestIPTrie_InsertOrderAndReplace(t *testing.T) {
+	// Insertar del más específico al más general obliga a crear bifurcaciones
+	trie := ratelimit.NewIPTrie[string]()
+	for _, cidr := range []string{"10.1.2.3", "10.1.2.0/24", "10.1.3.0/24", "10.0.0.0/8"} {
+		trie.Insert(cidr, cidr)
+	}
+	trie.Insert("10.1.2.0/24", "replaced")
+
+	if trie.Len() != 4 {
+		t.Errorf("expected 4 prefixes after replace, got %d", trie.Len())
+	}
+	for ip, expected := range map[string]string{
+		"10.1.2.3": "10.1.2.3",
+		"10.1.2.4": "replaced",
+		"10.1.3.9": "10.1.3.0/24",
+		"10.9.9.9": "10.0.0.0/8",
+	} {
+		if got, _ := trie.Lookup(ip); got != expected {
+			t.Errorf("Lookup(%s) = %q, expected %q", ip, got, expected)
+		}
+	}
+
+	for _, invalid := range []string{"10.0.0.0/33", "300.1.1.1", "abc", "2001:db8::/129"} {
+		if err := trie.Insert(invalid, "x"); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestIPTrie_MatchesLinearScan(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	trie := ratelimit.NewIPTrie[int]()
+	var prefixes []netip.Prefix
+
+	for i := 0; i < 2000; i++ {
+		var addr netip.Addr
+		var bits int
+		if i%2 == 0 {
+			addr = netip.AddrFrom4([4]byte{10, byte(rng.Intn(4)), byte(rng.Intn(256)), byte(rng.Intn(256))})
+			bits = 8 + rng.Intn(25)
+		} else {
+			addr = netip.AddrFrom16([16]byte{0x20, 0x01, 0x0d, 0xb8, byte(rng.Intn(4)), byte(rng.Intn(256)), 15: byte(rng.Intn(256))})
+			bits = 32 + rng.Intn(97)
+		}
+		prefix := netip.PrefixFrom(addr, bits).Masked()
+		trie.InsertPrefix(prefix, i)
+		prefixes = append(prefixes, prefix)
+	}
+
+	for i := 0; i < 5000; i++ {
+		var addr netip.Addr
+		if i%2 == 0 {
+			addr = netip.AddrFrom4([4]byte{10, byte(rng.Intn(4)), byte(rng.Intn(256)), byte(rng.Intn(256))})
+		} else {
+			addr = netip.AddrFrom16([16]byte{0x20, 0x01, 0x0d, 0xb8, byte(rng.Intn(4)), byte(rng.Intn(256)), 15: byte(rng.Intn(256))})
+		}
+
+		// El último insertado gana entre prefijos iguales, igual que en el árbol
+		expected, found, bestBits := 0, false, -1
+		for j, prefix := range prefixes {
+			if prefix.Contains(addr) && prefix.Bits() >= bestBits {
+				expected, found, bestBits = j, true, prefix.Bits()
+			}
+		}
+
+		got, ok := trie.LookupAddr(addr)
+		if ok != found || got != expected {
+			t.Fatalf("LookupAddr(%s) = %d, %v; expected %d, %v", addr, got, ok, expected, found)
+		}
+	}
+}
+
+func TestRateLimitMiddleware_CIDRLimits(t *testing.T) {
+	cfg := &config.Config{
+		DefaultRPS: 100,
+		IPRateLimit: map[string]int{
+			"203.0.113.0/24": 10,
+			"203.0.113.7":    1,
+			"2001:db8::/32":  500,
+		},
+		IPPathRateLimit: map[string]int{
+			"10.0.0.0/8::/items/*":    20,
+			"2001:db8::/48::/items/*": 30,
+		},
+	}
+	limiter := &recordingLimiter{}
+	handler := middleware.NewRateLimitMiddleware(limiter, cfg, zap.NewNop()).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		remoteAddr  string
+		ip          string
+		ipLimit     int
+		ipPathLimit int
+	}{
+		{"203.0.113.50:1234", "203.0.113.50", 10, 50},
+		{"203.0.113.7:1234", "203.0.113.7", 1, 50},
+		{"[2001:db8::1]:1234", "2001:db8::1", 500, 30},
+		{"10.20.30.40:1234", "10.20.30.40", 100, 20},
+		{"198.51.100.1:1234", "198.51.100.1", 100, 50},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/items/MLA1", nil)
+		req.RemoteAddr = tt.remoteAddr
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if got := limiter.limits[ratelimit.IPKey(tt.ip)].Limit; got != tt.ipLimit {
+			t.Errorf("%s: expected ip limit %d, got %d", tt.ip, tt.ipLimit, got)
+		}
+		if got := limiter.limits[ratelimit.IPPathKey(tt.ip, "/items/*")].Limit; got != tt.ipPathLimit {
+			t.Errorf("%s: expected ip_path limit %d, got %d", tt.ip, tt.ipPathLimit, got)
+		}
+	}
+}
+
+func BenchmarkIPTrie_Lookup(b *testing.B) {
+	trie := ratelimit.NewIPTrie[int]()
+	for i := 0; i < 10000; i++ {
+		trie.Insert(fmt.Sprintf("10.%d.%d.0/24", i/256, i%256), i)
+	}
+	addr := netip.MustParseAddr("10.20.30.40")
+
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		trie.LookupAddr(addr)
+	}
+}
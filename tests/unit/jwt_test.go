@@ -0,0 +1,498 @@
+package unit
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andress1014/meli-proxy/internal/auth"
+	"github.com/andress1014/meli-proxy/internal/config"
+	"github.com/andress1014/meli-proxy/internal/middleware"
+	"github.com/andress1014/meli-proxy/internal/proxy"
+	"github.com/andress1014/meli-proxy/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
+const testJWTSecret = "test-secret"
+
+var (
+	testRSAKeyOnce sync.Once
+	testRSAKeys    [2]*rsa.PrivateKey
+)
+
+// testRSAKey genera las claves RSA una sola vez para todos los tests
+func testRSAKey(t *testing.T, i int) *rsa.PrivateKey {
+	testRSAKeyOnce.Do(func() {
+		for j := range testRSAKeys {
+			key, err := rsa.GenerateKey(rand.Reader, 2048)
+			if err != nil {
+				t.Fatal(err)
+			}
+			testRSAKeys[j] = key
+		}
+	})
+	return testRSAKeys[i]
+}
+
+func jwtSegment(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func signHS256(claims map[string]interface{}, secret string) string {
+	input := jwtSegment(map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + jwtSegment(claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(input))
+	return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	input := jwtSegment(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid}) + "." + jwtSegment(claims)
+	digest := sha256.Sum256([]byte(input))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func jwksJSON(keys map[string]*rsa.PrivateKey) []byte {
+	var set []map[string]string
+	for kid, key := range keys {
+		set = append(set, map[string]string{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	data, _ := json.Marshal(map[string]interface{}{"keys": set})
+	return data
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"sub":  "client-1",
+		"plan": "pro",
+		"iss":  "https://auth.example.com",
+		"aud":  []string{"meli-proxy"},
+		"exp":  time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestVerifier_HS256(t *testing.T) {
+	verifier := auth.NewVerifier(auth.VerifierConfig{
+		Secret:   []byte(testJWTSecret),
+		Issuer:   "https://auth.example.com",
+		Audience: "meli-proxy",
+		Leeway:   time.Second,
+	})
+
+	claims, err := verifier.Verify(context.Background(), signHS256(validClaims(), testJWTSecret))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims.String("sub") != "client-1" || claims.String("plan") != "pro" {
+		t.Errorf("unexpected claims: %v", claims)
+	}
+
+	with := func(name string, value interface{}) map[string]interface{} {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"wrong secret", signHS256(validClaims(), "other"), auth.ErrInvalidSignature},
+		{"expired", signHS256(with("exp", time.Now().Add(-time.Minute).Unix()), testJWTSecret), auth.ErrTokenExpired},
+		{"not yet valid", signHS256(with("nbf", time.Now().Add(time.Minute).Unix()), testJWTSecret), auth.ErrTokenNotYetValid},
+		{"wrong issuer", signHS256(with("iss", "https://evil.example.com"), testJWTSecret), auth.ErrInvalidIssuer},
+		{"wrong audience", signHS256(with("aud", "other"), testJWTSecret), auth.ErrInvalidAudience},
+		{"missing audience", signHS256(with("aud", nil), testJWTSecret), auth.ErrInvalidAudience},
+		{"exp as string", signHS256(with("exp", "tomorrow"), testJWTSecret), auth.ErrMalformedToken},
+		{"malformed", "not.a-jwt", auth.ErrMalformedToken},
+		{"too many segments", signHS256(validClaims(), testJWTSecret) + ".x", auth.ErrMalformedToken},
+		{"alg none", jwtSegment(map[string]string{"alg": "none"}) + "." + jwtSegment(validClaims()) + ".", auth.ErrUnsupportedAlgorithm},
+		{"RS256 without keys", signRS256(t, testRSAKey(t, 0), "k1", validClaims()), auth.ErrUnsupportedAlgorithm},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := verifier.Verify(context.Background(), tt.token); !errors.Is(err, tt.err) {
+				t.Errorf("expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+
+	// Dentro del leeway el token expirado sigue siendo válido
+	if _, err := verifier.Verify(context.Background(), signHS256(with("exp", time.Now().Unix()+1), testJWTSecret)); err != nil {
+		t.Errorf("expected token within leeway to be valid, got %v", err)
+	}
+}
+
+func TestVerifier_RS256File(t *testing.T) {
+	key := testRSAKey(t, 0)
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(file, jwksJSON(map[string]*rsa.PrivateKey{"k1": key}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := auth.LoadKeySetFile(file)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	verifier := auth.NewVerifier(auth.VerifierConfig{Keys: keys})
+
+	if _, err := verifier.Verify(context.Background(), signRS256(t, key, "k1", validClaims())); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	// Con una sola clave se acepta un token sin kid
+	if _, err := verifier.Verify(context.Background(), signRS256(t, key, "", validClaims())); err != nil {
+		t.Errorf("unexpected error without kid: %v", err)
+	}
+	if _, err := verifier.Verify(context.Background(), signRS256(t, key, "k2", validClaims())); !errors.Is(err, auth.ErrUnknownKey) {
+		t.Errorf("expected unknown key, got %v", err)
+	}
+	if _, err := verifier.Verify(context.Background(), signRS256(t, testRSAKey(t, 1), "k1", validClaims())); !errors.Is(err, auth.ErrInvalidSignature) {
+		t.Errorf("expected invalid signature, got %v", err)
+	}
+	// HS256 no se valida con las claves del JWKS
+	if _, err := verifier.Verify(context.Background(), signHS256(validClaims(), string(key.N.Bytes()))); !errors.Is(err, auth.ErrUnsupportedAlgorithm) {
+		t.Errorf("expected unsupported algorithm, got %v", err)
+	}
+}
+
+func TestParseJWKS_Invalid(t *testing.T) {
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{
+		"not json":   []byte("{"),
+		"empty":      []byte(`{"keys":[]}`),
+		"only EC":    []byte(`{"keys":[{"kty":"EC","kid":"e1","crv":"P-256"}]}`),
+		"small key":  jwksJSON(map[string]*rsa.PrivateKey{"small": small}),
+		"bad base64": []byte(`{"keys":[{"kty":"RSA","kid":"k","n":"***","e":"AQAB"}]}`),
+	} {
+		if _, err := auth.ParseJWKS(data); err == nil {
+			t.Errorf("expected error for %s", name)
+		}
+	}
+
+	// Las claves de cifrado se ignoran
+	data := []byte(strings.Replace(string(jwksJSON(map[string]*rsa.PrivateKey{"k1": testRSAKey(t, 0)})), `"use":"sig"`, `"use":"enc"`, 1))
+	if _, err := auth.ParseJWKS(data); err == nil {
+		t.Error("expected error when only encryption keys are present")
+	}
+}
+
+func TestKeySet_RemoteCachingAndRotation(t *testing.T) {
+	var fetches atomic.Int32
+	var mu sync.Mutex
+	current := map[string]*rsa.PrivateKey{"k1": testRSAKey(t, 0)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		mu.Lock()
+		defer mu.Unlock()
+		w.Write(jwksJSON(current))
+	}))
+	defer server.Close()
+
+	ttl := 200 * time.Millisecond
+	keys := auth.NewRemoteKeySet(server.URL, ttl, server.Client(), zap.NewNop())
+	verifier := auth.NewVerifier(auth.VerifierConfig{Keys: keys})
+
+	// La primera validación descarga el JWKS y las siguientes usan el cache
+	for i := 0; i < 5; i++ {
+		if _, err := verifier.Verify(context.Background(), signRS256(t, testRSAKey(t, 0), "k1", validClaims())); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if fetches.Load() != 1 || keys.Len() != 1 {
+		t.Fatalf("expected 1 fetch, got %d", fetches.Load())
+	}
+
+	// Rotación: un kid desconocido fuerza una descarga, pero no más de una por intervalo
+	mu.Lock()
+	current = map[string]*rsa.PrivateKey{"k1": testRSAKey(t, 0), "k2": testRSAKey(t, 1)}
+	mu.Unlock()
+	rotated := signRS256(t, testRSAKey(t, 1), "k2", validClaims())
+	if _, err := verifier.Verify(context.Background(), rotated); !errors.Is(err, auth.ErrUnknownKey) {
+		t.Errorf("expected unknown key before the refetch interval, got %v", err)
+	}
+	if fetches.Load() != 1 {
+		t.Errorf("expected no refetch inside the interval, got %d fetches", fetches.Load())
+	}
+
+	time.Sleep(ttl)
+	if _, err := verifier.Verify(context.Background(), rotated); err != nil {
+		t.Errorf("expected rotated key to be fetched, got %v", err)
+	}
+	if keys.Len() != 2 {
+		t.Errorf("expected 2 keys after rotation, got %d", keys.Len())
+	}
+
+	// Un proveedor caído no invalida las claves cacheadas
+	server.Close()
+	if err := keys.Refresh(context.Background()); err == nil {
+		t.Error("expected refresh error")
+	}
+	if _, err := verifier.Verify(context.Background(), rotated); err != nil {
+		t.Errorf("expected cached keys after a failed refresh, got %v", err)
+	}
+}
+
+func newJWTTestConfig() *config.Config {
+	return &config.Config{
+		DefaultRPS:    100,
+		JWTEnabled:    true,
+		JWTSecret:     testJWTSecret,
+		JWTRequired:   true,
+		JWTTierClaim:  "plan",
+		IdentityTiers: map[string]int{"free": 60, "pro": 1000},
+	}
+}
+
+func TestJWTMiddleware_Responses(t *testing.T) {
+	cfg := newJWTTestConfig()
+	jwt, err := middleware.NewJWTMiddleware(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotClaims auth.Claims
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotClaims, _ = auth.ClaimsFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := jwt.Handler(next)
+
+	expired := validClaims()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+		errorCode     string
+		challenge     string
+	}{
+		{"valid", "Bearer " + signHS256(validClaims(), testJWTSecret), http.StatusOK, "", ""},
+		{"missing", "", http.StatusUnauthorized, "missing_token", "Bearer"},
+		{"basic auth", "Basic dXNlcjpwYXNz", http.StatusUnauthorized, "missing_token", "Bearer"},
+		{"expired", "Bearer " + signHS256(expired, testJWTSecret), http.StatusUnauthorized, "token_expired", `Bearer error="invalid_token"`},
+		{"forged", "Bearer " + signHS256(validClaims(), "guess"), http.StatusUnauthorized, "invalid_token", `Bearer error="invalid_token"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotClaims = nil
+			req := httptest.NewRequest("GET", "/items/MLA1", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("expected %d, got %d", tt.status, rr.Code)
+			}
+			if tt.status == http.StatusOK {
+				if gotClaims.String("sub") != "client-1" {
+					t.Errorf("expected claims in context, got %v", gotClaims)
+				}
+				return
+			}
+
+			var body map[string]string
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+				t.Fatalf("invalid JSON body %q: %v", rr.Body.String(), err)
+			}
+			if body["error"] != tt.errorCode || body["message"] == "" {
+				t.Errorf("unexpected body: %v", body)
+			}
+			if rr.Header().Get("Content-Type") != "application/json" || rr.Header().Get("WWW-Authenticate") != tt.challenge {
+				t.Errorf("unexpected headers: %v", rr.Header())
+			}
+		})
+	}
+
+	// Con JWT_REQUIRED=false los requests sin token siguen como anónimos
+	cfg.JWTRequired = false
+	optional, _ := middleware.NewJWTMiddleware(cfg, zap.NewNop())
+	rr := httptest.NewRecorder()
+	optional.Handler(next).ServeHTTP(rr, httptest.NewRequest("GET", "/items", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected anonymous request to pass, got %d", rr.Code)
+	}
+}
+
+func TestJWTMiddleware_TierClaim(t *testing.T) {
+	resolver, err := ratelimit.NewIdentityResolver("jwt:sub", nil, "free")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ratelimit.SetIdentityResolver(resolver)
+	t.Cleanup(func() { ratelimit.SetIdentityResolver(nil) })
+
+	cfg := newJWTTestConfig()
+	jwt, err := middleware.NewJWTMiddleware(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := &recordingLimiter{}
+	handler := jwt.Handler(middleware.NewRateLimitMiddleware(limiter, cfg, zap.NewNop()).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	tests := []struct {
+		plan  interface{}
+		limit int
+	}{
+		{"pro", 1000},
+		{"free", 60},
+		{"unknown", 60}, // tier inexistente: se usa el de la identidad
+		{nil, 60},
+	}
+	for _, tt := range tests {
+		claims := validClaims()
+		claims["plan"] = tt.plan
+		req := httptest.NewRequest("GET", "/items/MLA1", nil)
+		req.Header.Set("Authorization", "Bearer "+signHS256(claims, testJWTSecret))
+		limiter.limits = nil
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("plan %v: expected 200, got %d", tt.plan, rr.Code)
+		}
+		found := false
+		for key, limit := range limiter.limits {
+			if strings.HasPrefix(key, "client::jwt:") {
+				found = true
+				if limit.Limit != tt.limit {
+					t.Errorf("plan %v: expected limit %d, got %d", tt.plan, tt.limit, limit.Limit)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("plan %v: expected client key, got %v", tt.plan, limiter.limits)
+		}
+	}
+}
+
+func TestJWTMiddleware_TierClaimIgnoredWithIPIdentity(t *testing.T) {
+	cfg := newJWTTestConfig()
+	cfg.QuotaDaily = 100
+	cfg.TierDailyQuotas = map[string]int{"pro": 1000000}
+	jwt, err := middleware.NewJWTMiddleware(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := &recordingLimiter{}
+	handler := jwt.Handler(middleware.NewRateLimitMiddleware(limiter, cfg, zap.NewNop()).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	claims := validClaims()
+	claims["plan"] = "pro"
+	req := httptest.NewRequest("GET", "/items/MLA1", nil)
+	req.Header.Set("Authorization", "Bearer "+signHS256(claims, testJWTSecret))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	found := false
+	for key, limit := range limiter.limits {
+		if strings.HasPrefix(key, "quota:day:") {
+			found = true
+			if limit.Limit != 100 {
+				t.Errorf("expected the default daily quota for an IP, got %d", limit.Limit)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("expected a daily quota key, got %v", limiter.limits)
+	}
+}
+
+func TestProxy_JWTValidation(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	cfg := newJWTTestConfig()
+	cfg.TargetURL = backend.URL
+	server := proxy.NewServer(cfg, ratelimit.NewDummyLimiter(), zap.NewNop())
+
+	for _, path := range []string{"/items/MLA1", "/no-ratelimit/items/MLA1"} {
+		rr := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401 without token, got %d", path, rr.Code)
+		}
+
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+signHS256(validClaims(), testJWTSecret))
+		rr = httptest.NewRecorder()
+		server.Handler().ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: expected 200 with token, got %d", path, rr.Code)
+		}
+	}
+}
+
+func TestConfigLoad_JWT(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil || cfg.JWTEnabled || !cfg.JWTRequired || cfg.JWTTierClaim != "plan" {
+		t.Fatalf("unexpected JWT defaults: %+v (%v)", cfg, err)
+	}
+
+	t.Setenv("JWT_ENABLED", "true")
+	if _, err := config.Load(); err == nil {
+		t.Error("expected error without keys")
+	}
+
+	t.Setenv("JWT_JWKS_FILE", "jwks.json")
+	t.Setenv("JWT_JWKS_URL", "https://auth.example.com/.well-known/jwks.json")
+	if _, err := config.Load(); err == nil {
+		t.Error("expected error with both JWKS file and URL")
+	}
+
+	t.Setenv("JWT_JWKS_FILE", "")
+	t.Setenv("JWT_JWKS_CACHE_TTL", "1m")
+	t.Setenv("JWT_AUDIENCE", "meli-proxy")
+	cfg, err = config.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.JWTJWKSCacheTTL != time.Minute || cfg.JWTAudience != "meli-proxy" {
+		t.Errorf("unexpected JWT config: %+v", cfg)
+	}
+}
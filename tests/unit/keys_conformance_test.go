@@ -0,0 +1,178 @@
+package unit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/andress1014/meli-proxy/internal/config"
+	"github.com/andress1014/meli-proxy/internal/metrics"
+	"github.com/andress1014/meli-proxy/internal/middleware"
+	"github.com/andress1014/meli-proxy/internal/ratelimit"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// keyConformanceCases son requests que ambos middlewares tienen que resolver a
+// la misma IP y el mismo path. Se evalúan con 10.0.0.0/8 como proxy de confianza.
+var keyConformanceCases = []struct {
+	name       string
+	remoteAddr string
+	headers    map[string]string
+	path       string
+	wantIP     string
+	wantPath   string
+}{
+	{"IPv4 RemoteAddr", "198.51.100.5:54321", nil, "/items/MLA123", "198.51.100.5", "/items/*"},
+	{"IPv6 RemoteAddr", "[2001:db8::1]:443", nil, "/items/MLA123", "2001:db8::1", "/items/*"},
+	{"IPv6 link-local RemoteAddr", "[fe80::1%eth0]:443", nil, "/health", "fe80::1%eth0", "/health"},
+	{"RemoteAddr without port", "198.51.100.5", nil, "/health", "198.51.100.5", "/health"},
+	{"XFF from trusted proxy", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.1"}, "/users/1", "203.0.113.1", "/users/*"},
+	{"XFF IPv6 from trusted proxy", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "2001:db8::7, 10.0.0.2"}, "/users/1", "2001:db8::7", "/users/*"},
+	{"XFF from untrusted peer", "198.51.100.5:1234", map[string]string{"X-Forwarded-For": "203.0.113.1"}, "/users/1", "198.51.100.5", "/users/*"},
+	{"malformed XFF", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "not-an-ip"}, "/sites/MLA", "10.0.0.1", "/sites/*"},
+	{"empty XFF entries", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": " , "}, "/sites/MLA", "10.0.0.1", "/sites/*"},
+	{"XFF with port is malformed", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.1:80"}, "/", "10.0.0.1", "/"},
+	{"malformed X-Real-IP", "10.0.0.1:1234", map[string]string{"X-Real-IP": "garbage"}, "/", "10.0.0.1", "/"},
+	{"malformed Forwarded", "10.0.0.1:1234", map[string]string{"Forwarded": `for="[2001:db8::1`}, "/", "10.0.0.1", "/"},
+	{"Forwarded without for", "10.0.0.1:1234", map[string]string{"Forwarded": "proto=https;by=10.0.0.1"}, "/", "10.0.0.1", "/"},
+	{"nested resource collapses", "198.51.100.5:1", nil, "/categories/MLA1234/attributes", "198.51.100.5", "/categories/*"},
+	{"trailing slash collapses", "198.51.100.5:1", nil, "/items/MLA1/", "198.51.100.5", "/items/*"},
+	{"case is preserved", "198.51.100.5:1", nil, "/Items/MLA1", "198.51.100.5", "/Items/MLA1"},
+	{"empty ID segment is not collapsed", "198.51.100.5:1", nil, "/items//MLA1", "198.51.100.5", "/items//MLA1"},
+	{"resource root is not collapsed", "198.51.100.5:1", nil, "/items/", "198.51.100.5", "/items"},
+	{"similar prefix is not collapsed", "198.51.100.5:1", nil, "/itemsx/MLA1", "198.51.100.5", "/itemsx/MLA1"},
+	{"root path", "198.51.100.5:1", nil, "/", "198.51.100.5", "/"},
+}
+
+func newConformanceRequest(remoteAddr string, headers map[string]string, path string) *http.Request {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.URL.Path = path
+	req.RemoteAddr = remoteAddr
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	return req
+}
+
+func trustConformanceProxies(t *testing.T) {
+	ratelimit.SetTrustedProxies([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}, ratelimit.ProxyHeaderXForwardedFor)
+	t.Cleanup(func() { ratelimit.SetTrustedProxies(nil, "") })
+}
+
+func TestDeriveKeys_Conformance(t *testing.T) {
+	trustConformanceProxies(t)
+
+	for _, tt := range keyConformanceCases {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := ratelimit.DeriveKeys(newConformanceRequest(tt.remoteAddr, tt.headers, tt.path))
+			if keys.IP != tt.wantIP || keys.Path != tt.wantPath {
+				t.Errorf("DeriveKeys() = %q %q, want %q %q", keys.IP, keys.Path, tt.wantIP, tt.wantPath)
+			}
+			if keys.IPPathKey() != ratelimit.IPPathKey(tt.wantIP, tt.wantPath) {
+				t.Errorf("unexpected ip_path key %q", keys.IPPathKey())
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddleware_KeyConformance(t *testing.T) {
+	trustConformanceProxies(t)
+
+	limiter := &recordingLimiter{}
+	cfg := &config.Config{DefaultRPS: 100}
+	handler := middleware.NewRateLimitMiddleware(limiter, cfg, zap.NewNop()).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, tt := range keyConformanceCases {
+		t.Run(tt.name, func(t *testing.T) {
+			handler.ServeHTTP(httptest.NewRecorder(), newConformanceRequest(tt.remoteAddr, tt.headers, tt.path))
+
+			for _, key := range []string{
+				ratelimit.IPKey(tt.wantIP),
+				ratelimit.PathKey(tt.wantPath),
+				ratelimit.IPPathKey(tt.wantIP, tt.wantPath),
+			} {
+				if _, ok := limiter.limits[key]; !ok {
+					t.Errorf("expected key %q, got %v", key, limiter.limits)
+				}
+			}
+		})
+	}
+}
+
+func TestOptimizedMiddleware_KeyConformance(t *testing.T) {
+	mr := startMiniredis(t)
+	limiter, err := ratelimit.NewOptimizedRedisLimiter("redis://"+mr.Addr(), zap.NewNop())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer limiter.Close()
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	ctx := context.Background()
+
+	trustConformanceProxies(t)
+
+	collector := metrics.NewAsyncCollector(zap.NewNop())
+	defer collector.Shutdown()
+	handler := middleware.NewOptimizedMiddleware(limiter, collector, zap.NewNop()).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, tt := range keyConformanceCases {
+		t.Run(tt.name, func(t *testing.T) {
+			key := ratelimit.IPPathKey(tt.wantIP, tt.wantPath)
+			client.Del(ctx, key)
+			defer client.Del(ctx, key)
+
+			handler.ServeHTTP(httptest.NewRecorder(), newConformanceRequest(tt.remoteAddr, tt.headers, tt.path))
+
+			// El cache local puede responder sin tocar Redis; se espera a que expire
+			if exists, _ := client.Exists(ctx, key).Result(); exists == 0 {
+				time.Sleep(1100 * time.Millisecond)
+				handler.ServeHTTP(httptest.NewRecorder(), newConformanceRequest(tt.remoteAddr, tt.headers, tt.path))
+				if exists, _ := client.Exists(ctx, key).Result(); exists == 0 {
+					t.Errorf("expected Redis key %q", key)
+				}
+			}
+		})
+	}
+}
+
+func TestDeriveKeys_ZeroAlloc(t *testing.T) {
+	trustConformanceProxies(t)
+
+	requests := []*http.Request{
+		newConformanceRequest("198.51.100.5:54321", nil, "/items/MLA123"),
+		newConformanceRequest("[2001:db8::1]:443", nil, "/categories/MLA1/attributes"),
+		newConformanceRequest("10.0.0.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.1, 10.0.0.2"}, "/users/1/"),
+		newConformanceRequest("10.0.0.1:1234", map[string]string{"Forwarded": `for="[2001:db8::7]:4711";proto=https, for=10.0.0.2`}, "/sites/MLA"),
+		newConformanceRequest("10.0.0.1:1234", map[string]string{"X-Forwarded-For": "garbage"}, "/health"),
+	}
+
+	for _, req := range requests {
+		allocs := testing.AllocsPerRun(100, func() {
+			ratelimit.DeriveKeys(req)
+		})
+		if allocs != 0 {
+			t.Errorf("DeriveKeys(%s %v) allocated %.0f times", req.RemoteAddr, req.Header, allocs)
+		}
+	}
+}
+
+func BenchmarkDeriveKeys(b *testing.B) {
+	ratelimit.SetTrustedProxies([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}, ratelimit.ProxyHeaderXForwardedFor)
+	defer ratelimit.SetTrustedProxies(nil, "")
+	req := newConformanceRequest("10.0.0.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.1, 10.0.0.2"}, "/items/MLA123")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ratelimit.DeriveKeys(req)
+	}
+}
@@ -0,0 +1,142 @@
+package unit
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andress1014/meli-proxy/internal/ratelimit"
+)
+
+func TestMemoryLimiter_Algorithms(t *testing.T) {
+	algorithms := []ratelimit.Algorithm{
+		ratelimit.AlgorithmSlidingWindow,
+		ratelimit.AlgorithmSlidingWindowCounter,
+		ratelimit.AlgorithmTokenBucket,
+		ratelimit.AlgorithmGCRA,
+	}
+
+	for _, algorithm := range algorithms {
+		t.Run(string(algorithm), func(t *testing.T) {
+			limiter := ratelimit.NewMemoryLimiter(4)
+			defer limiter.Close()
+
+			cfg := ratelimit.LimitConfig{Limit: 5, Window: time.Minute, Algorithm: algorithm}
+			allowed := 0
+			var last *ratelimit.LimitResult
+			for i := 0; i < 10; i++ {
+				result, err := limiter.CheckLimit(context.Background(), "ip::10.0.0.1", cfg)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if result.Allowed {
+					allowed++
+				}
+				last = result
+			}
+
+			if allowed != 5 {
+				t.Errorf("expected 5 allowed requests, got %d", allowed)
+			}
+			if last.Allowed || last.Remaining != 0 {
+				t.Errorf("expected last request rejected with 0 remaining, got %+v", last)
+			}
+			if last.RetryAfter <= 0 {
+				t.Error("expected retry after on rejected request")
+			}
+		})
+	}
+}
+
+func TestMemoryLimiter_RetryAfterRecovers(t *testing.T) {
+	limiter := ratelimit.NewMemoryLimiter(0)
+	defer limiter.Close()
+
+	cfg := ratelimit.LimitConfig{Limit: 10, Window: 100 * time.Millisecond, Algorithm: ratelimit.AlgorithmGCRA, Burst: 1}
+	ctx := context.Background()
+
+	if result, _ := limiter.CheckLimit(ctx, "key", cfg); !result.Allowed {
+		t.Fatal("expected first request to be allowed")
+	}
+	result, _ := limiter.CheckLimit(ctx, "key", cfg)
+	if result.Allowed {
+		t.Fatal("expected second request to be rejected")
+	}
+
+	time.Sleep(result.RetryAfter)
+	if result, _ := limiter.CheckLimit(ctx, "key", cfg); !result.Allowed {
+		t.Error("expected request to be allowed after retry after")
+	}
+}
+
+func TestMemoryLimiter_RejectedRequestsNotCounted(t *testing.T) {
+	limiter := ratelimit.NewMemoryLimiter(0)
+	defer limiter.Close()
+
+	ctx := context.Background()
+	limits := map[string]ratelimit.LimitConfig{
+		"ip::10.0.0.1":             {Limit: 10, Window: time.Minute},
+		"ip_path::10.0.0.1::/test": {Limit: 2, Window: time.Minute},
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, err := limiter.CheckMultipleLimits(ctx, limits); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// Solo 2 requests pasaron: ip debe tener 10 - 2 - 1 restantes tras este check
+	result, err := limiter.CheckLimit(ctx, "ip::10.0.0.1", ratelimit.LimitConfig{Limit: 10, Window: time.Minute})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Remaining != 7 {
+		t.Errorf("expected 7 remaining, got %d", result.Remaining)
+	}
+}
+
+func TestMemoryLimiter_Concurrency(t *testing.T) {
+	limiter := ratelimit.NewMemoryLimiter(8)
+	defer limiter.Close()
+
+	cfg := map[string]ratelimit.LimitConfig{
+		"ip::10.0.0.1":   {Limit: 100, Window: time.Minute},
+		"path::/items/*": {Limit: 100, Window: time.Minute, Algorithm: ratelimit.AlgorithmTokenBucket},
+	}
+
+	var allowed int64
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				results, err := limiter.CheckMultipleLimits(context.Background(), cfg)
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+					return
+				}
+				if results["ip::10.0.0.1"].Allowed && results["path::/items/*"].Allowed {
+					atomic.AddInt64(&allowed, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 100 {
+		t.Errorf("expected exactly 100 allowed requests, got %d", allowed)
+	}
+}
+
+func TestMemoryLimiter_InvalidConfig(t *testing.T) {
+	limiter := ratelimit.NewMemoryLimiter(0)
+	defer limiter.Close()
+
+	_, err := limiter.CheckLimit(context.Background(), "key", ratelimit.LimitConfig{Limit: 0, Window: time.Minute})
+	if err == nil {
+		t.Error("expected error for zero limit")
+	}
+}
@@ -0,0 +1,188 @@
+package unit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andress1014/meli-proxy/internal/config"
+	"github.com/andress1014/meli-proxy/internal/middleware"
+	"github.com/andress1014/meli-proxy/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
+func TestMethodKey(t *testing.T) {
+	tests := []struct {
+		key      string
+		expected string
+	}{
+		{ratelimit.IPKey("10.0.0.1"), "ip:POST::10.0.0.1"},
+		{ratelimit.PathKey("/items"), "path:POST::/items"},
+		{ratelimit.IPPathKey("10.0.0.1", "/items"), "ip_path:POST::10.0.0.1::/items"},
+		{ratelimit.IPPathKey("2001:db8::1", "/items/*"), "ip_path:POST::2001:db8::1::/items/*"},
+		{"no-separator", "no-separator"},
+	}
+	for _, tt := range tests {
+		got := ratelimit.MethodKey(tt.key, "POST")
+		if got != tt.expected {
+			t.Errorf("MethodKey(%s) = %s, want %s", tt.key, got, tt.expected)
+		}
+		// El método no cambia el shard del cluster
+		if ratelimit.ClusterHashTag(got) != ratelimit.ClusterHashTag(tt.key) {
+			t.Errorf("hash tag changed for %s: %s vs %s", tt.key, ratelimit.ClusterHashTag(got), ratelimit.ClusterHashTag(tt.key))
+		}
+	}
+
+	if got := ratelimit.MethodKey(ratelimit.IPKey("10.0.0.1"), ""); got != "ip::10.0.0.1" {
+		t.Errorf("empty method should keep the key, got %s", got)
+	}
+}
+
+func TestRateLimitMiddleware_MethodRules(t *testing.T) {
+	rules, err := ratelimit.ParseRules("rules.yaml", []byte(`rules:
+  - name: items-writes
+    match: {path: /items, method: post}
+    limit: 2
+  - name: items-reads
+    match: {path: /items/*, method: GET}
+    limit: 1000
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	limiter := ratelimit.NewMemoryLimiter(0)
+	defer limiter.Close()
+	cfg := &config.Config{DefaultRPS: 100, Rules: rules}
+	handler := middleware.NewRateLimitMiddleware(limiter, cfg, zap.NewNop()).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(method, path string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = "198.51.100.1:1234"
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	for i := 0; i < 2; i++ {
+		if code := serve("POST", "/items"); code != http.StatusOK {
+			t.Fatalf("POST %d: expected 200, got %d", i+1, code)
+		}
+	}
+	if code := serve("POST", "/items"); code != http.StatusTooManyRequests {
+		t.Errorf("expected POST /items to be limited, got %d", code)
+	}
+
+	// GET /items no filtra por método: no comparte el cupo con el POST
+	for i := 0; i < 3; i++ {
+		if code := serve("GET", "/items"); code != http.StatusOK {
+			t.Errorf("GET /items %d: expected 200, got %d", i+1, code)
+		}
+	}
+	if code := serve("GET", "/items/MLA1"); code != http.StatusOK {
+		t.Errorf("expected GET /items/* to use its own budget, got %d", code)
+	}
+}
+
+func TestRateLimitMiddleware_KeyByMethod(t *testing.T) {
+	limiter := &recordingLimiter{}
+	cfg := &config.Config{DefaultRPS: 100, KeyByMethod: true}
+	handler := middleware.NewRateLimitMiddleware(limiter, cfg, zap.NewNop()).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("DELETE", "/items/MLA1", nil)
+	req.RemoteAddr = "198.51.100.1:1234"
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	for _, key := range []string{
+		"ip:DELETE::198.51.100.1",
+		"path:DELETE::/items/*",
+		"ip_path:DELETE::198.51.100.1::/items/*",
+	} {
+		if _, ok := limiter.limits[key]; !ok {
+			t.Errorf("expected key %s, got %v", key, limiter.limits)
+		}
+	}
+	if len(limiter.limits) != 3 {
+		t.Errorf("expected 3 keys, got %v", limiter.limits)
+	}
+}
+
+func TestRateLimitMiddleware_KeyByMethodOther(t *testing.T) {
+	rules, err := ratelimit.ParseRules("rules.yaml", []byte(`rules:
+  - match: {path: /dav/*, method: PROPFIND}
+    limit: 10
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	limiter := ratelimit.NewMemoryLimiter(0)
+	defer limiter.Close()
+	cfg := &config.Config{DefaultRPS: 4, KeyByMethod: true, Rules: rules}
+	m := middleware.NewRateLimitMiddleware(limiter, cfg, zap.NewNop())
+	handler := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Los métodos inventados comparten un solo contador: rotarlos no da cupo nuevo
+	codes := make([]int, 0, 3)
+	for _, method := range []string{"FOO", "BAR", "BAZ"} {
+		req := httptest.NewRequest(method, "/items/MLA1", nil)
+		req.RemoteAddr = "198.51.100.1:1234"
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		codes = append(codes, rr.Code)
+	}
+	// ip_path = DefaultRPS/2 = 2
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+		t.Errorf("expected invented methods to share a budget, got %v", codes)
+	}
+
+	tests := []struct {
+		method   string
+		path     string
+		scope    string
+		expected string
+	}{
+		{"FOO", "/items/MLA1", "ip", "ip:OTHER::198.51.100.1"},
+		{"PATCH", "/items/MLA1", "path", "path:PATCH::/items/*"},
+		// Una regla que filtra por un método no estándar conserva su propia key
+		{"PROPFIND", "/dav/file", "path", "path:PROPFIND::/dav/file"},
+		{"PROPFIND", "/items/MLA1", "path", "path:OTHER::/items/*"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.RemoteAddr = "198.51.100.1:1234"
+		keys, _ := m.LimitConfigs(req)
+		if keys[tt.scope] != tt.expected {
+			t.Errorf("%s %s: expected %s key %s, got %s", tt.method, tt.path, tt.scope, tt.expected, keys[tt.scope])
+		}
+	}
+}
+
+func TestParseRules_InvalidMethod(t *testing.T) {
+	_, err := ratelimit.ParseRules("rules.yaml", []byte(`rules:
+  - match: {path: /items, method: "GET POST"}
+    limit: 2
+`))
+	if err == nil {
+		t.Fatal("expected error for invalid method")
+	}
+}
+
+func TestConfigLoad_KeyByMethod(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil || cfg.KeyByMethod {
+		t.Fatalf("expected method keys disabled by default, got %v (%v)", cfg.KeyByMethod, err)
+	}
+
+	t.Setenv("RATE_LIMIT_KEY_BY_METHOD", "true")
+	if cfg, err = config.Load(); err != nil || !cfg.KeyByMethod {
+		t.Errorf("expected method keys enabled, got %v (%v)", cfg.KeyByMethod, err)
+	}
+}
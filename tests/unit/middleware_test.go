@@ -308,6 +308,7 @@ type mockLimiter struct {
 	shouldError bool
 	remaining   int
 	resetTime   time.Time
+	retryAfter  time.Duration
 }
 
 func (m *mockLimiter) CheckMultipleLimits(ctx context.Context, limits map[string]ratelimit.LimitConfig) (map[string]*ratelimit.LimitResult, error) {
@@ -319,8 +320,9 @@ func (m *mockLimiter) CheckMultipleLimits(ctx context.Context, limits map[string
 	for key := range limits {
 		results[key] = &ratelimit.LimitResult{
 			Allowed:   m.shouldAllow,
-			Remaining: m.remaining,
-			ResetTime: m.resetTime,
+			Remaining:  m.remaining,
+			ResetTime:  m.resetTime,
+			RetryAfter: m.retryAfter,
 		}
 	}
 	
@@ -330,3 +332,232 @@ func (m *mockLimiter) CheckMultipleLimits(ctx context.Context, limits map[string
 func (m *mockLimiter) Close() error {
 	return nil
 }
+
+// recordingLimiter guarda los límites recibidos para inspeccionarlos
+type recordingLimiter struct {
+	limits map[string]ratelimit.LimitConfig
+}
+
+func (r *recordingLimiter) CheckMultipleLimits(ctx context.Context, limits map[string]ratelimit.LimitConfig) (map[string]*ratelimit.LimitResult, error) {
+	r.limits = limits
+	results := make(map[string]*ratelimit.LimitResult)
+	for key, cfg := range limits {
+		results[key] = &ratelimit.LimitResult{
+			Allowed:   true,
+			Remaining: cfg.Limit - 1,
+			ResetTime: time.Now().Add(cfg.Window),
+		}
+	}
+	return results, nil
+}
+
+func (r *recordingLimiter) Close() error {
+	return nil
+}
+
+func TestRateLimitMiddleware_PerRuleAlgorithm(t *testing.T) {
+	cfg := &config.Config{
+		DefaultRPS:       100,
+		DefaultAlgorithm: "sliding_window",
+		PathAlgorithms:   map[string]string{"/items/*": "token_bucket"},
+		PathBursts:       map[string]int{"/items/*": 500},
+	}
+	logger, _ := zap.NewDevelopment()
+	limiter := &recordingLimiter{}
+
+	handler := middleware.NewRateLimitMiddleware(limiter, cfg, logger).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/items/MLA123", nil)
+	req.RemoteAddr = "192.168.1.100:12345"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	// Los límites se indexan por la key real de Redis
+	ipCfg, ok := limiter.limits[ratelimit.IPKey("192.168.1.100")]
+	if !ok {
+		t.Fatalf("missing ip key, got %v", limiter.limits)
+	}
+	if ipCfg.Algorithm != ratelimit.AlgorithmSlidingWindow {
+		t.Errorf("expected sliding window for ip limit, got %s", ipCfg.Algorithm)
+	}
+
+	pathCfg := limiter.limits[ratelimit.PathKey("/items/*")]
+	if pathCfg.Algorithm != ratelimit.AlgorithmTokenBucket {
+		t.Errorf("expected token bucket for /items/*, got %s", pathCfg.Algorithm)
+	}
+	if pathCfg.Burst != 500 {
+		t.Errorf("expected burst 500, got %d", pathCfg.Burst)
+	}
+
+	ipPathCfg := limiter.limits[ratelimit.IPPathKey("192.168.1.100", "/items/*")]
+	if ipPathCfg.Algorithm != ratelimit.AlgorithmTokenBucket {
+		t.Errorf("expected token bucket for ip_path, got %s", ipPathCfg.Algorithm)
+	}
+}
+
+func TestRateLimitMiddleware_RetryAfter(t *testing.T) {
+	cfg := &config.Config{
+		DefaultRPS: 10,
+	}
+	logger, _ := zap.NewDevelopment()
+
+	tests := []struct {
+		name       string
+		retryAfter time.Duration
+		resetTime  time.Time
+		expected   string
+	}{
+		{
+			name:       "exact retry after from GCRA",
+			retryAfter: 2300 * time.Millisecond,
+			resetTime:  time.Now().Add(60 * time.Second),
+			expected:   "3",
+		},
+		{
+			name:      "fallback to reset time",
+			resetTime: time.Now().Add(10 * time.Second),
+			expected:  "10",
+		},
+		{
+			name:      "never below one second",
+			resetTime: time.Now().Add(-time.Second),
+			expected:  "1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := &mockLimiter{
+				shouldAllow: false,
+				resetTime:   tt.resetTime,
+				retryAfter:  tt.retryAfter,
+			}
+
+			handler := middleware.NewRateLimitMiddleware(limiter, cfg, logger).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest("GET", "/test", nil)
+			req.RemoteAddr = "192.168.1.100:12345"
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusTooManyRequests {
+				t.Fatalf("Expected status 429, got %d", rr.Code)
+			}
+			if got := rr.Header().Get("Retry-After"); got != tt.expected {
+				t.Errorf("Expected Retry-After %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddleware_FailPolicy(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+
+	tests := []struct {
+		name     string
+		policy   string
+		paths    map[string]string
+		expected []int
+	}{
+		{
+			name:     "fail open by default",
+			expected: []int{http.StatusOK, http.StatusOK, http.StatusOK},
+		},
+		{
+			name:     "fail closed for path",
+			paths:    map[string]string{"/test": "closed"},
+			expected: []int{http.StatusServiceUnavailable},
+		},
+		{
+			name:   "local fallback uses per-instance share",
+			policy: "local",
+			// ip_path = DefaultRPS/2 = 2, repartido entre 2 instancias = 1
+			expected: []int{http.StatusOK, http.StatusTooManyRequests},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				DefaultRPS:       4,
+				FailPolicy:       tt.policy,
+				PathFailPolicies: tt.paths,
+				ProxyInstances:   2,
+			}
+			limiter := &mockLimiter{shouldError: true}
+
+			handler := middleware.NewRateLimitMiddleware(limiter, cfg, logger).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			for i, expected := range tt.expected {
+				req := httptest.NewRequest("GET", "/test", nil)
+				req.RemoteAddr = "192.168.1.100:12345"
+				rr := httptest.NewRecorder()
+				handler.ServeHTTP(rr, req)
+
+				if rr.Code != expected {
+					t.Errorf("request %d: expected status %d, got %d", i+1, expected, rr.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddleware_Rules(t *testing.T) {
+	rules, err := ratelimit.ParseRules("rules.yaml", []byte(`rules:
+  - match: {ip: 192.168.1.0/24}
+    limit: 7
+    window: 10s
+  - match: {path: /items/*, method: GET}
+    limit: 500
+    algorithm: gcra
+  - match: {path: /items/*}
+    limit: 100
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cfg := &config.Config{
+		DefaultRPS:    100,
+		Rules:         rules,
+		PathRateLimit: map[string]int{"/items/*": 1},
+	}
+	logger, _ := zap.NewDevelopment()
+	limiter := &recordingLimiter{}
+
+	handler := middleware.NewRateLimitMiddleware(limiter, cfg, logger).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/items/MLA123", nil)
+	req.RemoteAddr = "192.168.1.100:12345"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	ipCfg := limiter.limits[ratelimit.IPKey("192.168.1.100")]
+	if ipCfg.Limit != 7 || ipCfg.Window != 10*time.Second {
+		t.Errorf("expected CIDR rule for ip limit, got %+v", ipCfg)
+	}
+
+	// La primera regla que coincide gana y tiene prioridad sobre PATH_RATE_LIMITS;
+	// como filtra por método, su contador es propio del GET
+	pathCfg := limiter.limits[ratelimit.MethodKey(ratelimit.PathKey("/items/*"), "GET")]
+	if pathCfg.Limit != 500 || pathCfg.Algorithm != ratelimit.AlgorithmGCRA {
+		t.Errorf("expected GET items rule for path limit, got %+v", pathCfg)
+	}
+
+	req = httptest.NewRequest("POST", "/items/MLA123", nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := limiter.limits[ratelimit.PathKey("/items/*")]; got.Limit != 100 {
+		t.Errorf("expected fallback items rule for POST, got %+v", got)
+	}
+	if got := limiter.limits[ratelimit.IPKey("10.0.0.1")]; got.Limit != 100 || got.Window != time.Minute {
+		t.Errorf("expected default ip limit outside CIDR, got %+v", got)
+	}
+}
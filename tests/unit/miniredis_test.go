@@ -0,0 +1,34 @@
+package unit
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// startMiniredis levanta un Redis en memoria para el test; también responde
+// CLUSTER SLOTS como un cluster de un solo nodo
+func startMiniredis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to start miniredis: %v", err)
+	}
+	t.Cleanup(mr.Close)
+	return mr
+}
+
+// newTestRedisClient devuelve un cliente contra un miniredis propio del test
+func newTestRedisClient(t *testing.T) *redis.Client {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: startMiniredis(t).Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// newTestRedisURL devuelve la URL de un miniredis propio del test
+func newTestRedisURL(t *testing.T) string {
+	t.Helper()
+	return "redis://" + startMiniredis(t).Addr()
+}
@@ -0,0 +1,161 @@
+package unit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andress1014/meli-proxy/internal/config"
+	"github.com/andress1014/meli-proxy/internal/middleware"
+	"github.com/andress1014/meli-proxy/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
+func TestParseOverride(t *testing.T) {
+	rule, err := ratelimit.ParseOverride("block-abusive", []byte(`{"match":{"ip":"203.0.113.0/24"},"limit":1,"window":"10s"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rule.Name != "block-abusive" || rule.Scope != ratelimit.ScopeIP || rule.Limit != 1 || rule.Window != 10*time.Second {
+		t.Errorf("unexpected override: %+v", rule)
+	}
+
+	// También acepta YAML y respeta el nombre propio
+	rule, err = ratelimit.ParseOverride("id", []byte("name: items\nmatch: {path: /items/*}\nlimit: 5\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rule.Name != "items" || rule.Scope != ratelimit.ScopePath {
+		t.Errorf("unexpected override: %+v", rule)
+	}
+
+	// Los campos desconocidos se rechazan igual que en el archivo de reglas
+	unknown := map[string]string{
+		`{"match":{"ip":"203.0.113.0/24"},"limt":1}`:                `unknown field "limt"`,
+		`{"match":{"ip":"203.0.113.0/24","methd":"GET"},"limit":1}`: `unknown field "methd"`,
+		`{"limits":[{"limit":1,"windw":"1s"}]}`:                     `unknown field "windw"`,
+	}
+	for data, want := range unknown {
+		_, err := ratelimit.ParseOverride("typo", []byte(data))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q for %s, got %v", want, data, err)
+		}
+	}
+
+	invalid := []string{
+		`{"limit":0}`,
+		`{"match":{"ip":"not-an-ip"},"limit":1}`,
+		`{"limit":"many"}`,
+		`{"limit":1,"algorithm":"unknown"}`,
+	}
+	for _, data := range invalid {
+		if _, err := ratelimit.ParseOverride("bad", []byte(data)); err == nil {
+			t.Errorf("expected error for %s", data)
+		}
+	}
+}
+
+func TestRateLimitMiddleware_OverridesTakePrecedence(t *testing.T) {
+	rules, err := ratelimit.ParseRules("rules.yaml", []byte("rules:\n  - match: {path: /items/*}\n    limit: 100\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	override, err := ratelimit.ParseOverride("hot-items", []byte(`{"match":{"path":"/items/*"},"limit":3}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cfg := &config.Config{DefaultRPS: 100, Rules: rules}
+	limiter := &recordingLimiter{}
+	mw := middleware.NewRateLimitMiddleware(limiter, cfg, zap.NewNop())
+	handler := mw.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func() ratelimit.LimitConfig {
+		req := httptest.NewRequest("GET", "/items/MLA123", nil)
+		req.RemoteAddr = "10.0.0.1:12345"
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		return limiter.limits[ratelimit.PathKey("/items/*")]
+	}
+
+	if got := serve(); got.Limit != 100 {
+		t.Errorf("expected file rule without overrides, got %+v", got)
+	}
+
+	mw.SetOverrides([]ratelimit.Rule{override})
+	if got := serve(); got.Limit != 3 {
+		t.Errorf("expected override to win over file rule, got %+v", got)
+	}
+	if len(mw.Overrides()) != 1 {
+		t.Errorf("expected 1 override, got %d", len(mw.Overrides()))
+	}
+
+	mw.SetOverrides(nil)
+	if got := serve(); got.Limit != 100 {
+		t.Errorf("expected file rule after clearing overrides, got %+v", got)
+	}
+}
+
+func TestOverrideStore(t *testing.T) {
+	client := newTestRedisClient(t)
+	ctx := context.Background()
+
+	key := "meli_proxy:test_overrides"
+	client.Del(ctx, key, key+":expires")
+	defer client.Del(ctx, key, key+":expires")
+
+	// Una entrada inválida no impide cargar las demás
+	client.HSet(ctx, key, "broken", `{"limit":0}`)
+
+	applied := make(chan []ratelimit.Rule, 10)
+	writer := ratelimit.NewOverrideStore(client, key, func([]ratelimit.Rule) {}, zap.NewNop())
+	reader := ratelimit.NewOverrideStore(client, key, func(rules []ratelimit.Rule) { applied <- rules }, zap.NewNop())
+
+	if err := reader.Start(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer reader.Stop()
+
+	if rules := waitForRules(t, applied); len(rules) != 0 {
+		t.Fatalf("expected invalid override to be ignored, got %+v", rules)
+	}
+
+	if err := writer.Set(ctx, "bad", []byte(`{"match":{"ip":"nope"},"limit":1}`), 0); err == nil {
+		t.Error("expected invalid override to be rejected")
+	}
+
+	// El cambio llega a la otra instancia por pub/sub
+	if err := writer.Set(ctx, "block", []byte(`{"match":{"ip":"203.0.113.0/24"},"limit":1}`), 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rules := waitForRules(t, applied)
+	if len(rules) != 1 || rules[0].Name != "block" || rules[0].Limit != 1 {
+		t.Fatalf("expected block override, got %+v", rules)
+	}
+
+	if err := writer.Delete(ctx, "block"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rules := waitForRules(t, applied); len(rules) != 0 {
+		t.Errorf("expected no overrides after delete, got %+v", rules)
+	}
+
+	// Los overrides temporales vencen solos
+	if err := writer.Set(ctx, "temporary", []byte(`{"limit":1}`), 300*time.Millisecond); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rules = waitForRules(t, applied)
+	if len(rules) != 1 || rules[0].ExpiresAt.IsZero() {
+		t.Fatalf("expected temporary override with expiration, got %+v", rules)
+	}
+	if rules := waitForRules(t, applied); len(rules) != 0 {
+		t.Errorf("expected temporary override to expire, got %+v", rules)
+	}
+	if exists, _ := client.HExists(ctx, key, "temporary").Result(); exists {
+		t.Error("expected expired override to be deleted from redis")
+	}
+}
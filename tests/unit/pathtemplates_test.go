@@ -0,0 +1,133 @@
+package unit
+
+import (
+	"testing"
+
+	"github.com/andress1014/meli-proxy/internal/config"
+	"github.com/andress1014/meli-proxy/internal/ratelimit"
+)
+
+func TestPathNormalizer_Templates(t *testing.T) {
+	normalizer, err := ratelimit.NewPathNormalizer([]string{
+		"/orders/{id}",
+		"/questions/*",
+		"/sites/{site}/search",
+		"/users/{id}/items/{item}",
+		"/users/me",
+		"/shipments/{id}/items/**",
+		"/",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/orders/123", "/orders/*"},
+		{"/orders", "/orders"},
+		{"/orders/123/notes", "/orders/123/notes"},
+		{"/questions/456", "/questions/*"},
+		{"/sites/MLA/search", "/sites/*/search"},
+		{"/sites/MLA/categories", "/sites/*"},
+		{"/sites/MLA", "/sites/*"},
+		{"/users/123/items/MLA1", "/users/*/items/*"},
+		{"/users/123/items", "/users/*"},
+		{"/users/me", "/users/me"},
+		{"/users/me/items/MLA1", "/users/*/items/*"},
+		{"/shipments/9/items", "/shipments/*/items"},
+		{"/shipments/9/items/1/2", "/shipments/*/items"},
+		{"/shipments/9", "/shipments/9"},
+		{"/items/MLA1/description", "/items/*"},
+		{"/", "/"},
+		{"/health", "/health"},
+		{"relative/path", "relative/path"},
+	}
+	for _, tt := range tests {
+		if got := normalizer.Normalize(tt.path); got != tt.expected {
+			t.Errorf("Normalize(%s) = %s, want %s", tt.path, got, tt.expected)
+		}
+	}
+
+	if templates := normalizer.Templates(); len(templates) != 11 || templates[0] != "/categories/{id}/**" {
+		t.Errorf("unexpected templates: %v", templates)
+	}
+}
+
+func TestPathNormalizer_InvalidTemplates(t *testing.T) {
+	for _, template := range []string{
+		"orders/{id}",
+		"/orders/**/items",
+		"/orders//items",
+		"/orders/{}",
+		"/orders/{id",
+		"/orders/id*",
+	} {
+		if _, err := ratelimit.NewPathNormalizer([]string{template}); err == nil {
+			t.Errorf("expected error for template %q", template)
+		}
+	}
+}
+
+func TestNormalizePath_ConfiguredTemplates(t *testing.T) {
+	if err := ratelimit.SetPathTemplates([]string{"/orders/{id}"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ratelimit.SetPathTemplates(nil) })
+
+	if got := ratelimit.NormalizePath("/orders/2000001?fields=id"); got != "/orders/*" {
+		t.Errorf("NormalizePath() = %s, want /orders/*", got)
+	}
+	if got := ratelimit.NormalizePath("/items/MLA1/"); got != "/items/*" {
+		t.Errorf("builtin templates should remain active, got %s", got)
+	}
+
+	if err := ratelimit.SetPathTemplates([]string{"bad"}); err == nil {
+		t.Error("expected error for invalid template")
+	}
+	if got := ratelimit.NormalizePath("/orders/2000001"); got != "/orders/*" {
+		t.Errorf("invalid templates should not replace the active ones, got %s", got)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		ratelimit.NormalizePath("/orders/2000001")
+	})
+	if allocs != 0 {
+		t.Errorf("NormalizePath allocated %.0f times", allocs)
+	}
+}
+
+func TestConfigLoad_PathTemplates(t *testing.T) {
+	t.Setenv("PATH_TEMPLATES", "/orders/{id}, /sites/{site}/search")
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.PathTemplates) != 2 || cfg.PathTemplates[1] != "/sites/{site}/search" {
+		t.Errorf("unexpected path templates: %v", cfg.PathTemplates)
+	}
+	if cfg.PathIDDetection {
+		t.Error("expected ID detection disabled by default")
+	}
+
+	t.Setenv("PATH_ID_DETECTION", "true")
+	if cfg, err = config.Load(); err != nil || !cfg.PathIDDetection {
+		t.Errorf("expected ID detection enabled, got %v (%v)", cfg, err)
+	}
+
+	t.Setenv("PATH_TEMPLATES", "/orders/**/x")
+	if _, err := config.Load(); err == nil {
+		t.Error("expected error for invalid path template")
+	}
+}
+
+func BenchmarkNormalizePath(b *testing.B) {
+	normalizer, _ := ratelimit.NewPathNormalizer([]string{"/orders/{id}", "/sites/{site}/search", "/users/{id}/items/{item}"})
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		normalizer.Normalize("/sites/MLA/search")
+	}
+}
@@ -0,0 +1,235 @@
+package unit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andress1014/meli-proxy/internal/config"
+	"github.com/andress1014/meli-proxy/internal/middleware"
+	"github.com/andress1014/meli-proxy/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
+func TestQuotaKey(t *testing.T) {
+	now := time.Date(2026, 10, 16, 23, 30, 0, 0, time.FixedZone("ART", -3*3600))
+
+	// El período se calcula en UTC: las 23:30 ART ya son el 17
+	if got := ratelimit.QuotaKey(ratelimit.QuotaDaily, "10.0.0.1", now); got != "quota:day:20261017::10.0.0.1" {
+		t.Errorf("unexpected daily key %s", got)
+	}
+	if got := ratelimit.QuotaKey(ratelimit.QuotaMonthly, "key:abc", now); got != "quota:month:202610::key:abc" {
+		t.Errorf("unexpected monthly key %s", got)
+	}
+
+	key := ratelimit.QuotaKey(ratelimit.QuotaDaily, "2001:db8::1", now)
+	if !ratelimit.IsQuotaKey(key) || ratelimit.IsQuotaKey(ratelimit.IPKey("10.0.0.1")) {
+		t.Errorf("IsQuotaKey mismatch for %s", key)
+	}
+	// Misma slot que los límites de la IP en Redis Cluster
+	if tag := ratelimit.ClusterHashTag(key); tag != ratelimit.ClusterHashTag(ratelimit.IPKey("2001:db8::1")) {
+		t.Errorf("unexpected hash tag %s", tag)
+	}
+}
+
+func TestQuotaConfig_EndsAtPeriodBoundary(t *testing.T) {
+	now := time.Date(2026, 12, 31, 22, 0, 0, 0, time.UTC)
+
+	daily := ratelimit.QuotaConfig(ratelimit.QuotaDaily, 1000, now)
+	if daily.Window != 2*time.Hour || daily.Limit != 1000 || daily.Algorithm != ratelimit.AlgorithmFixedWindow {
+		t.Errorf("unexpected daily config %+v", daily)
+	}
+
+	monthly := ratelimit.QuotaConfig(ratelimit.QuotaMonthly, 5000, time.Date(2026, 2, 28, 0, 0, 0, 0, time.UTC))
+	if monthly.Window != 24*time.Hour {
+		t.Errorf("expected monthly quota to end on March 1st, got %v", monthly.Window)
+	}
+}
+
+func TestMemoryLimiter_FixedWindow(t *testing.T) {
+	limiter := ratelimit.NewMemoryLimiter(0)
+	defer limiter.Close()
+
+	ctx := context.Background()
+	config := ratelimit.LimitConfig{Limit: 2, Window: time.Hour, Algorithm: ratelimit.AlgorithmFixedWindow}
+	start := time.Now()
+
+	for i := 0; i < 2; i++ {
+		result, err := limiter.CheckLimit(ctx, "quota", config)
+		if err != nil || !result.Allowed {
+			t.Fatalf("request %d: expected allowed, got %+v (%v)", i+1, result, err)
+		}
+		if result.Remaining != 1-i {
+			t.Errorf("request %d: expected remaining %d, got %d", i+1, 1-i, result.Remaining)
+		}
+	}
+
+	result, err := limiter.CheckLimit(ctx, "quota", config)
+	if err != nil || result.Allowed {
+		t.Fatalf("expected third request to be blocked, got %+v (%v)", result, err)
+	}
+	// La ventana no se desliza: el reset es una hora después del primer request
+	if result.ResetTime.Before(start.Add(59*time.Minute)) || result.ResetTime.After(time.Now().Add(time.Hour)) {
+		t.Errorf("unexpected reset time %v", result.ResetTime)
+	}
+	if result.RetryAfter <= 59*time.Minute {
+		t.Errorf("expected retry after close to the window, got %v", result.RetryAfter)
+	}
+}
+
+func TestRedisLimiter_FixedWindow(t *testing.T) {
+	limiter, err := ratelimit.NewRedisLimiter(newTestRedisURL(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer limiter.Close()
+
+	ctx := context.Background()
+	key := ratelimit.QuotaKey(ratelimit.QuotaDaily, "test-"+strconv.FormatInt(time.Now().UnixNano(), 10), time.Now())
+	defer limiter.Reset(ctx, key)
+
+	limits := map[string]ratelimit.LimitConfig{key: ratelimit.QuotaConfig(ratelimit.QuotaDaily, 2, time.Now())}
+	for i := 0; i < 2; i++ {
+		results, err := limiter.CheckMultipleLimits(ctx, limits)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !results[key].Allowed {
+			t.Fatalf("request %d: expected allowed", i+1)
+		}
+	}
+
+	results, err := limiter.CheckMultipleLimits(ctx, limits)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if results[key].Allowed || results[key].Remaining != 0 {
+		t.Errorf("expected quota to be exhausted, got %+v", results[key])
+	}
+}
+
+func TestRateLimitMiddleware_DailyQuota(t *testing.T) {
+	limiter := ratelimit.NewMemoryLimiter(0)
+	defer limiter.Close()
+	cfg := &config.Config{DefaultRPS: 100, QuotaDaily: 2, QuotaMonthly: 10}
+	handler := middleware.NewRateLimitMiddleware(limiter, cfg, zap.NewNop()).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/items/MLA1", nil)
+		req.RemoteAddr = "198.51.100.7:1234"
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve()
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	// Ventana corta (ip_path, la más restrictiva) y cuota en headers separados;
+	// la cuota informada es la diaria
+	if rr.Header().Get("X-RateLimit-Limit") != "50" || rr.Header().Get("X-RateLimit-Remaining") != "49" {
+		t.Errorf("short-window headers mixed with the quota: %v", rr.Header())
+	}
+	if rr.Header().Get("X-RateLimit-Quota-Limit") != "2" || rr.Header().Get("X-RateLimit-Quota-Remaining") != "1" {
+		t.Errorf("unexpected quota headers: %v", rr.Header())
+	}
+	tomorrow := time.Now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	if rr.Header().Get("X-RateLimit-Quota-Reset") != strconv.FormatInt(tomorrow.Unix(), 10) {
+		t.Errorf("expected quota reset at UTC midnight %d, got %s", tomorrow.Unix(), rr.Header().Get("X-RateLimit-Quota-Reset"))
+	}
+
+	serve()
+	rr = serve()
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected quota to block the third request, got %d", rr.Code)
+	}
+	if rr.Header().Get("X-RateLimit-Quota-Remaining") != "0" {
+		t.Errorf("expected exhausted quota header, got %v", rr.Header())
+	}
+	if retry, _ := strconv.Atoi(rr.Header().Get("Retry-After")); retry <= 0 || retry > 24*3600 {
+		t.Errorf("expected retry after until the end of the day, got %s", rr.Header().Get("Retry-After"))
+	}
+}
+
+func TestRateLimitMiddleware_TierQuotas(t *testing.T) {
+	resolver, err := ratelimit.NewIdentityResolver("header:X-API-Key", map[string]string{"key-pro": "pro", "key-free": "free"}, "free")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ratelimit.SetIdentityResolver(resolver)
+	t.Cleanup(func() { ratelimit.SetIdentityResolver(nil) })
+
+	limiter := &recordingLimiter{}
+	cfg := &config.Config{
+		DefaultRPS:        100,
+		QuotaDaily:        1000,
+		IdentityTiers:     map[string]int{"free": 60, "pro": 1000},
+		TierDailyQuotas:   map[string]int{"pro": 1000000},
+		TierMonthlyQuotas: map[string]int{"free": 20000},
+	}
+	handler := middleware.NewRateLimitMiddleware(limiter, cfg, zap.NewNop()).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	quotas := func(apiKey string) map[string]int {
+		req := httptest.NewRequest("GET", "/items/MLA1", nil)
+		req.RemoteAddr = "198.51.100.1:1234"
+		req.Header.Set("X-API-Key", apiKey)
+		limiter.limits = nil
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		found := make(map[string]int)
+		for key, limit := range limiter.limits {
+			if ratelimit.IsQuotaKey(key) {
+				period := strings.SplitN(key, ":", 3)[1]
+				found[period] = limit.Limit
+				if !strings.HasSuffix(key, "::"+ratelimit.DeriveKeys(req).Identity) {
+					t.Errorf("quota key %s is not per client", key)
+				}
+			}
+		}
+		return found
+	}
+
+	// pro: cuota diaria propia, sin mensual
+	if got := quotas("key-pro"); got["day"] != 1000000 || len(got) != 1 {
+		t.Errorf("unexpected pro quotas %v", got)
+	}
+	// free: diaria default y mensual del tier
+	if got := quotas("key-free"); got["day"] != 1000 || got["month"] != 20000 {
+		t.Errorf("unexpected free quotas %v", got)
+	}
+}
+
+func TestConfigLoad_Quotas(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil || cfg.QuotaDaily != 0 || cfg.QuotaMonthly != 0 {
+		t.Fatalf("expected no quotas by default, got %d/%d (%v)", cfg.QuotaDaily, cfg.QuotaMonthly, err)
+	}
+
+	t.Setenv("QUOTA_DAILY", "1000000")
+	t.Setenv("QUOTA_MONTHLY", "20000000")
+	t.Setenv("IDENTITY_TIERS", "free:60,pro:1000")
+	t.Setenv("QUOTA_TIER_DAILY", "free:10000")
+	t.Setenv("QUOTA_TIER_MONTHLY", "pro:100000000")
+	cfg, err = config.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.QuotaDaily != 1000000 || cfg.QuotaMonthly != 20000000 ||
+		cfg.TierDailyQuotas["free"] != 10000 || cfg.TierMonthlyQuotas["pro"] != 100000000 {
+		t.Errorf("unexpected quota config: %+v", cfg)
+	}
+
+	t.Setenv("QUOTA_TIER_DAILY", "gold:10")
+	if _, err := config.Load(); err == nil {
+		t.Error("expected error for quota of unknown tier")
+	}
+}
@@ -0,0 +1,159 @@
+package unit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andress1014/meli-proxy/internal/config"
+	"github.com/andress1014/meli-proxy/internal/middleware"
+	"github.com/andress1014/meli-proxy/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
+func TestParseHeaderMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     ratelimit.HeaderMode
+		legacy   bool
+		standard bool
+	}{
+		{"", ratelimit.HeadersLegacy, true, false},
+		{"legacy", ratelimit.HeadersLegacy, true, false},
+		{"Standard", ratelimit.HeadersStandard, false, true},
+		{" both ", ratelimit.HeadersBoth, true, true},
+	}
+	for _, tt := range tests {
+		mode, err := ratelimit.ParseHeaderMode(tt.name)
+		if err != nil || mode != tt.mode {
+			t.Errorf("ParseHeaderMode(%q) = %q, %v", tt.name, mode, err)
+		}
+		if mode.Legacy() != tt.legacy || mode.Standard() != tt.standard {
+			t.Errorf("%s: unexpected legacy/standard %v/%v", mode, mode.Legacy(), mode.Standard())
+		}
+	}
+
+	if _, err := ratelimit.ParseHeaderMode("ietf"); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
+
+func TestRateLimitHeaderItems(t *testing.T) {
+	tests := []struct {
+		got      string
+		expected string
+	}{
+		{ratelimit.PolicyItem("ip", 100, time.Minute), `"ip";q=100;w=60`},
+		{ratelimit.PolicyItem("ip:500ms", 20, 500*time.Millisecond), `"ip:500ms";q=20;w=1`},
+		{ratelimit.PolicyItem(`a"b\c`, 1, time.Hour), `"a\"b\\c";q=1;w=3600`},
+		{ratelimit.RateLimitItem("path", 9, 59500*time.Millisecond), `"path";r=9;t=60`},
+		{ratelimit.RateLimitItem("path", -1, -time.Second), `"path";r=0;t=0`},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.expected {
+			t.Errorf("got %s, want %s", tt.got, tt.expected)
+		}
+	}
+}
+
+func newHeadersTest(t *testing.T, limiter ratelimit.Limiter, cfg *config.Config) func() *httptest.ResponseRecorder {
+	t.Helper()
+	handler := middleware.NewRateLimitMiddleware(limiter, cfg, zap.NewNop()).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	return func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/items/MLA1", nil)
+		req.RemoteAddr = "198.51.100.20:1234"
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+}
+
+func TestRateLimitMiddleware_StandardHeaders(t *testing.T) {
+	serve := newHeadersTest(t, &recordingLimiter{}, &config.Config{
+		DefaultRPS:       100,
+		PathRateLimit:    map[string]int{"/items/*": 10},
+		RateLimitHeaders: "standard",
+	})
+
+	rr := serve()
+	policy := `"ip";q=100;w=60, "ip_path";q=50;w=60, "path";q=10;w=60`
+	if got := rr.Header().Get("RateLimit-Policy"); got != policy {
+		t.Errorf("RateLimit-Policy = %s, want %s", got, policy)
+	}
+	// El límite propio del path es el más cercano a agotarse
+	if got := rr.Header().Get("RateLimit"); got != `"path";r=9;t=60` {
+		t.Errorf("unexpected RateLimit %s", got)
+	}
+	if rr.Header().Get("X-RateLimit-Limit") != "" {
+		t.Errorf("legacy headers in standard mode: %v", rr.Header())
+	}
+}
+
+func TestRateLimitMiddleware_BothHeaders(t *testing.T) {
+	serve := newHeadersTest(t, &recordingLimiter{}, &config.Config{
+		DefaultRPS:       100,
+		QuotaDaily:       1000,
+		RateLimitHeaders: "both",
+	})
+
+	rr := serve()
+	// El legacy también informa el límite que aplica y no DefaultRPS
+	if rr.Header().Get("X-RateLimit-Limit") != "50" || rr.Header().Get("X-RateLimit-Quota-Limit") != "1000" {
+		t.Errorf("unexpected legacy headers %v", rr.Header())
+	}
+	// La ventana de la cuota es el día completo, no lo que falta para terminar
+	if got := rr.Header().Get("RateLimit-Policy"); !strings.Contains(got, `"quota_day";q=1000;w=86400`) {
+		t.Errorf("expected daily quota policy, got %s", got)
+	}
+	if got := rr.Header().Get("RateLimit"); got != `"ip_path";r=49;t=60` {
+		t.Errorf("unexpected RateLimit %s", got)
+	}
+}
+
+func TestRateLimitMiddleware_StandardHeadersOnReject(t *testing.T) {
+	limiter := ratelimit.NewMemoryLimiter(0)
+	defer limiter.Close()
+	serve := newHeadersTest(t, limiter, &config.Config{
+		DefaultRPS:       100,
+		PathRateLimit:    map[string]int{"/items/*": 1},
+		RateLimitHeaders: "standard",
+	})
+
+	serve()
+	rr := serve()
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rr.Code)
+	}
+	// El 429 nombra la política que rechazó el request, con t igual a Retry-After
+	expected := `"path";r=0;t=` + rr.Header().Get("Retry-After")
+	if got := rr.Header().Get("RateLimit"); got != expected {
+		t.Errorf("RateLimit = %s, want %s", got, expected)
+	}
+	if !strings.Contains(rr.Header().Get("RateLimit-Policy"), `"path";q=1;w=60`) {
+		t.Errorf("unexpected RateLimit-Policy %s", rr.Header().Get("RateLimit-Policy"))
+	}
+	if rr.Header().Get("X-RateLimit-Remaining") != "" {
+		t.Errorf("legacy headers in standard mode: %v", rr.Header())
+	}
+}
+
+func TestConfigLoad_RateLimitHeaders(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil || cfg.RateLimitHeaders != "legacy" {
+		t.Fatalf("expected legacy headers by default, got %q (%v)", cfg.RateLimitHeaders, err)
+	}
+
+	t.Setenv("RATE_LIMIT_HEADERS", "both")
+	if cfg, err = config.Load(); err != nil || cfg.RateLimitHeaders != "both" {
+		t.Errorf("expected both, got %q (%v)", cfg.RateLimitHeaders, err)
+	}
+
+	t.Setenv("RATE_LIMIT_HEADERS", "draft")
+	if _, err := config.Load(); err == nil {
+		t.Error("expected error for unknown header mode")
+	}
+}
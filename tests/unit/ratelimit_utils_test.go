@@ -2,6 +2,7 @@ package unit
 
 import (
 	"net/http"
+	"net/netip"
 	"net/url"
 	"testing"
 
@@ -9,11 +10,20 @@ import (
 )
 
 func TestExtractIP(t *testing.T) {
+	trusted := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("172.16.0.0/12"),
+		netip.MustParsePrefix("127.0.0.1/32"),
+		netip.MustParsePrefix("fd00::/8"),
+	}
+	t.Cleanup(func() { ratelimit.SetTrustedProxies(nil, "") })
+
 	tests := []struct {
-		name       string
-		headers    map[string]string
-		remoteAddr string
-		expectedIP string
+		name        string
+		proxyHeader ratelimit.ProxyHeader // vacío es X-Forwarded-For
+		headers     map[string]string
+		remoteAddr  string
+		expectedIP  string
 	}{
 		{
 			name:       "X-Forwarded-For single IP",
@@ -28,10 +38,24 @@ func TestExtractIP(t *testing.T) {
 			expectedIP: "192.168.1.100",
 		},
 		{
-			name:       "X-Real-IP header",
-			headers:    map[string]string{"X-Real-IP": "203.0.113.10"},
+			name:        "X-Real-IP header",
+			proxyHeader: ratelimit.ProxyHeaderXRealIP,
+			headers:     map[string]string{"X-Real-IP": "203.0.113.10"},
+			remoteAddr:  "10.0.0.1:12345",
+			expectedIP:  "203.0.113.10",
+		},
+		{
+			name:       "X-Real-IP ignored when reading X-Forwarded-For",
+			headers:    map[string]string{"X-Real-IP": "1.2.3.4"},
 			remoteAddr: "10.0.0.1:12345",
-			expectedIP: "203.0.113.10",
+			expectedIP: "10.0.0.1",
+		},
+		{
+			name:        "Invalid X-Real-IP, fallback to RemoteAddr",
+			proxyHeader: ratelimit.ProxyHeaderXRealIP,
+			headers:     map[string]string{"X-Real-IP": "garbage"},
+			remoteAddr:  "10.0.0.1:12345",
+			expectedIP:  "10.0.0.1",
 		},
 		{
 			name:       "RemoteAddr fallback",
@@ -45,10 +69,89 @@ func TestExtractIP(t *testing.T) {
 			remoteAddr: "203.0.113.20:12345",
 			expectedIP: "203.0.113.20",
 		},
+		{
+			name:       "Untrusted peer, headers ignored",
+			headers:    map[string]string{"X-Forwarded-For": "192.168.1.100", "X-Real-IP": "192.168.1.100", "Forwarded": "for=192.168.1.100"},
+			remoteAddr: "203.0.113.30:12345",
+			expectedIP: "203.0.113.30",
+		},
+		{
+			name:       "Spoofed X-Forwarded-For entry is skipped",
+			headers:    map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.7"},
+			remoteAddr: "10.0.0.1:12345",
+			expectedIP: "198.51.100.7",
+		},
+		{
+			name:       "Invalid hop stops the walk",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.7, garbage, 10.0.0.2"},
+			remoteAddr: "10.0.0.1:12345",
+			expectedIP: "10.0.0.2",
+		},
+		{
+			name:       "All hops trusted, leftmost wins",
+			headers:    map[string]string{"X-Forwarded-For": "10.1.1.1, 10.0.0.2"},
+			remoteAddr: "10.0.0.1:12345",
+			expectedIP: "10.1.1.1",
+		},
+		{
+			name:        "Forwarded header",
+			proxyHeader: ratelimit.ProxyHeaderForwarded,
+			headers:     map[string]string{"Forwarded": "for=198.51.100.7;proto=https, for=10.0.0.2;by=10.0.0.1"},
+			remoteAddr:  "10.0.0.1:12345",
+			expectedIP:  "198.51.100.7",
+		},
+		{
+			name:        "Forwarded IPv4 with port",
+			proxyHeader: ratelimit.ProxyHeaderForwarded,
+			headers:     map[string]string{"Forwarded": `For="198.51.100.7:4711"`},
+			remoteAddr:  "10.0.0.1:12345",
+			expectedIP:  "198.51.100.7",
+		},
+		{
+			name:        "Forwarded IPv6 with port",
+			proxyHeader: ratelimit.ProxyHeaderForwarded,
+			headers:     map[string]string{"Forwarded": `for="[2001:db8:cafe::17]:4711"`},
+			remoteAddr:  "[fd00::1]:12345",
+			expectedIP:  "2001:db8:cafe::17",
+		},
+		{
+			name:       "Spoofed Forwarded ignored when reading X-Forwarded-For",
+			headers:    map[string]string{"Forwarded": "for=1.2.3.4", "X-Forwarded-For": "198.51.100.7, 10.0.0.2"},
+			remoteAddr: "10.0.0.1:12345",
+			expectedIP: "198.51.100.7",
+		},
+		{
+			name:        "X-Forwarded-For ignored when reading Forwarded",
+			proxyHeader: ratelimit.ProxyHeaderForwarded,
+			headers:     map[string]string{"Forwarded": "for=198.51.100.7", "X-Forwarded-For": "1.2.3.4"},
+			remoteAddr:  "10.0.0.1:12345",
+			expectedIP:  "198.51.100.7",
+		},
+		{
+			name:        "Forwarded obfuscated node",
+			proxyHeader: ratelimit.ProxyHeaderForwarded,
+			headers:     map[string]string{"Forwarded": "for=_hidden, for=198.51.100.7"},
+			remoteAddr:  "10.0.0.1:12345",
+			expectedIP:  "198.51.100.7",
+		},
+		{
+			name:        "Forwarded unknown from trusted hop",
+			proxyHeader: ratelimit.ProxyHeaderForwarded,
+			headers:     map[string]string{"Forwarded": "for=unknown"},
+			remoteAddr:  "10.0.0.1:12345",
+			expectedIP:  "10.0.0.1",
+		},
+		{
+			name:       "IPv6 RemoteAddr",
+			headers:    map[string]string{},
+			remoteAddr: "[2001:db8::1]:443",
+			expectedIP: "2001:db8::1",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			ratelimit.SetTrustedProxies(trusted, tt.proxyHeader)
 			req := &http.Request{
 				Header:     make(http.Header),
 				RemoteAddr: tt.remoteAddr,
@@ -66,6 +169,34 @@ func TestExtractIP(t *testing.T) {
 	}
 }
 
+func TestExtractIP_NoTrustedProxies(t *testing.T) {
+	req := &http.Request{
+		Header:     make(http.Header),
+		RemoteAddr: "10.0.0.1:12345",
+	}
+	req.Header.Set("X-Forwarded-For", "192.168.1.100")
+	req.Header.Set("Forwarded", "for=192.168.1.100")
+
+	if ip := ratelimit.ExtractIP(req); ip != "10.0.0.1" {
+		t.Errorf("ExtractIP() = %v, want RemoteAddr 10.0.0.1", ip)
+	}
+}
+
+func TestClientIPResolver_MultipleHeaders(t *testing.T) {
+	resolver := ratelimit.NewClientIPResolver([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}, ratelimit.ProxyHeaderXForwardedFor)
+	req := &http.Request{
+		Header:     make(http.Header),
+		RemoteAddr: "10.0.0.1:12345",
+	}
+	// Varios headers X-Forwarded-For equivalen a una sola lista
+	req.Header.Add("X-Forwarded-For", "198.51.100.7")
+	req.Header.Add("X-Forwarded-For", "10.0.0.3, 10.0.0.2")
+
+	if ip := resolver.ClientIP(req); ip != "198.51.100.7" {
+		t.Errorf("ClientIP() = %v, want 198.51.100.7", ip)
+	}
+}
+
 func TestNormalizePath(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -125,6 +256,9 @@ func TestNormalizePath(t *testing.T) {
 }
 
 func TestGetLimitKeys(t *testing.T) {
+	ratelimit.SetTrustedProxies([]netip.Prefix{netip.MustParsePrefix("192.168.1.100/32")}, ratelimit.ProxyHeaderXForwardedFor)
+	t.Cleanup(func() { ratelimit.SetTrustedProxies(nil, "") })
+
 	req := &http.Request{
 		Header:     make(http.Header),
 		RemoteAddr: "192.168.1.100:12345",
@@ -0,0 +1,121 @@
+package unit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/andress1014/meli-proxy/internal/config"
+	"github.com/andress1014/meli-proxy/internal/middleware"
+	"github.com/andress1014/meli-proxy/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
+func writeRules(t *testing.T, file, content string) {
+	t.Helper()
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitForRules(t *testing.T, reloaded chan []ratelimit.Rule) []ratelimit.Rule {
+	t.Helper()
+	select {
+	case rules := <-reloaded:
+		return rules
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for rules reload")
+		return nil
+	}
+}
+
+func TestRulesReloader_FileChange(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rules.yaml")
+	writeRules(t, file, "rules:\n  - match: {path: /items/*}\n    limit: 10\n")
+
+	reloaded := make(chan []ratelimit.Rule, 10)
+	reloader := config.NewRulesReloader(file, 10*time.Millisecond, func(rules []ratelimit.Rule) {
+		reloaded <- rules
+	}, zap.NewNop())
+	reloader.Start()
+	defer reloader.Stop()
+
+	// Sin cambios no se recarga
+	select {
+	case <-reloaded:
+		t.Fatal("unexpected reload without changes")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	writeRules(t, file, "rules:\n  - match: {path: /items/*}\n    limit: 20\n")
+	if rules := waitForRules(t, reloaded); len(rules) != 1 || rules[0].Limit != 20 {
+		t.Errorf("unexpected reloaded rules: %+v", rules)
+	}
+
+	// Un archivo inválido no reemplaza las reglas
+	writeRules(t, file, "rules:\n  - match: {path: /items/*}\n    limit: 0\n")
+	select {
+	case rules := <-reloaded:
+		t.Fatalf("invalid rules should not be applied: %+v", rules)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if err := reloader.Reload(); err == nil {
+		t.Error("expected error reloading invalid rules")
+	}
+}
+
+func TestRulesReloader_SIGHUP(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rules.yaml")
+	writeRules(t, file, "rules:\n  - match: {path: /items/*}\n    limit: 10\n")
+
+	reloaded := make(chan []ratelimit.Rule, 10)
+	reloader := config.NewRulesReloader(file, 0, func(rules []ratelimit.Rule) {
+		reloaded <- rules
+	}, zap.NewNop())
+	reloader.Start()
+	defer reloader.Stop()
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	if rules := waitForRules(t, reloaded); len(rules) != 1 || rules[0].Limit != 10 {
+		t.Errorf("unexpected reloaded rules: %+v", rules)
+	}
+}
+
+func TestRateLimitMiddleware_SetRules(t *testing.T) {
+	cfg := &config.Config{DefaultRPS: 100}
+	limiter := &recordingLimiter{}
+	rateLimit := middleware.NewRateLimitMiddleware(limiter, cfg, zap.NewNop())
+
+	handler := rateLimit.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func() ratelimit.LimitConfig {
+		req := httptest.NewRequest("GET", "/items/MLA123", nil)
+		req.RemoteAddr = "192.168.1.100:12345"
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		return limiter.limits[ratelimit.PathKey("/items/*")]
+	}
+
+	if got := serve(); got.Limit != 100 {
+		t.Fatalf("expected default limit before reload, got %d", got.Limit)
+	}
+
+	rules, err := ratelimit.ParseRules("rules.yaml", []byte("rules:\n  - match: {path: /items/*}\n    limit: 42\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rateLimit.SetRules(rules)
+
+	if got := serve(); got.Limit != 42 {
+		t.Errorf("expected reloaded limit 42, got %d", got.Limit)
+	}
+	if len(rateLimit.Rules()) != 1 {
+		t.Errorf("expected 1 active rule, got %d", len(rateLimit.Rules()))
+	}
+}
@@ -0,0 +1,261 @@
+package unit
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andress1014/meli-proxy/internal/config"
+	"github.com/andress1014/meli-proxy/internal/ratelimit"
+)
+
+const validRulesYAML = `rules:
+  - name: internal
+    match:
+      ip: 10.0.0.0/8
+    limit: 1000
+  - name: items
+    match:
+      path: /items/*
+      method: get
+    limit: 50
+    window: 10s
+    algorithm: token_bucket
+    burst: 20
+  - name: mobile-items
+    match:
+      ip: 192.168.1.100
+      path: /items/*
+      headers:
+        X-Client: mobile
+    limit: 5
+`
+
+func TestParseRules_YAML(t *testing.T) {
+	rules, err := ratelimit.ParseRules("rules.yaml", []byte(validRulesYAML))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rules) != 3 {
+		t.Fatalf("expected 3 rules, got %d", len(rules))
+	}
+
+	internal := rules[0]
+	if internal.Scope != ratelimit.ScopeIP || internal.Window != time.Minute || internal.Line != 2 {
+		t.Errorf("unexpected internal rule: %+v", internal)
+	}
+
+	items := rules[1]
+	if items.Scope != ratelimit.ScopePath {
+		t.Errorf("expected path scope, got %s", items.Scope)
+	}
+	if items.Window != 10*time.Second || items.Algorithm != ratelimit.AlgorithmTokenBucket || items.Burst != 20 {
+		t.Errorf("unexpected items rule: %+v", items)
+	}
+	if items.Match.Method != "GET" {
+		t.Errorf("expected method to be normalized to GET, got %s", items.Match.Method)
+	}
+
+	if rules[2].Scope != ratelimit.ScopeIPPath {
+		t.Errorf("expected ip_path scope, got %s", rules[2].Scope)
+	}
+}
+
+func TestParseRules_JSON(t *testing.T) {
+	data := `{"rules": [{"name": "items", "scope": "path", "match": {"path": "/items/*"}, "limit": 10, "window": "1s", "algorithm": "gcra"}]}`
+
+	rules, err := ratelimit.ParseRules("rules.json", []byte(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rules) != 1 || rules[0].Algorithm != ratelimit.AlgorithmGCRA || rules[0].Window != time.Second {
+		t.Errorf("unexpected rules: %+v", rules)
+	}
+}
+
+func TestParseRules_Errors(t *testing.T) {
+	data := `rules:
+  - name: bad-cidr
+    match:
+      ip: 10.0.0.0/99
+    limit: 10
+  - name: bad-limit
+    limit: 0
+  - name: bad-algorithm
+    limit: 10
+    algorithm: leaky
+  - name: typo
+    limt: 10
+  - name: bad-type
+    limit: many
+  - name: path-with-ip
+    scope: path
+    match:
+      ip: 10.0.0.1
+      path: /items/*
+    limit: 10
+`
+
+	_, err := ratelimit.ParseRules("rules.yaml", []byte(data))
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+
+	msg := err.Error()
+	expected := []string{
+		`rules.yaml:2: rule "bad-cidr": invalid CIDR "10.0.0.0/99"`,
+		`rules.yaml:6: rule "bad-limit": limit must be greater than 0`,
+		`rules.yaml:8: rule "bad-algorithm": unknown rate limit algorithm "leaky"`,
+		`rules.yaml:12: unknown field "limt"`,
+		`rules.yaml:14: cannot unmarshal`,
+		`rules.yaml:15: rule "path-with-ip": match.ip is not allowed with scope path`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected error to contain %q, got:\n%s", want, msg)
+		}
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	rules, err := ratelimit.ParseRules("rules.yaml", []byte(validRulesYAML))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		rule     int
+		method   string
+		path     string
+		ip       string
+		headers  map[string]string
+		expected bool
+	}{
+		{"ip inside CIDR", 0, "GET", "/sites/MLA", "10.1.2.3", nil, true},
+		{"ip outside CIDR", 0, "GET", "/sites/MLA", "11.1.2.3", nil, false},
+		{"path and method", 1, "GET", "/items/MLA123", "1.1.1.1", nil, true},
+		{"wrong method", 1, "POST", "/items/MLA123", "1.1.1.1", nil, false},
+		{"wrong path", 1, "GET", "/users/123", "1.1.1.1", nil, false},
+		{"header present", 2, "GET", "/items/MLA1", "192.168.1.100", map[string]string{"X-Client": "mobile"}, true},
+		{"header mismatch", 2, "GET", "/items/MLA1", "192.168.1.100", map[string]string{"X-Client": "web"}, false},
+		{"header missing", 2, "GET", "/items/MLA1", "192.168.1.100", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			got := rules[tt.rule].Matches(req, tt.ip, ratelimit.NormalizePath(tt.path))
+			if got != tt.expected {
+				t.Errorf("Matches() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRuleSet_LongestPrefix(t *testing.T) {
+	rules, err := ratelimit.ParseRules("rules.yaml", []byte(`rules:
+  - name: items
+    scope: ip
+    match: {path: /items/*}
+    limit: 300
+  - name: office
+    scope: ip
+    match: {ip: 203.0.113.0/24}
+    limit: 100
+  - name: office-writes
+    scope: ip
+    match: {ip: 203.0.113.7, method: POST}
+    limit: 5
+  - name: partner
+    scope: ip
+    match: {ip: 203.0.113.7}
+    limit: 1000
+  - name: v6
+    scope: ip
+    match: {ip: 2001:db8::/32}
+    limit: 50
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	set := ratelimit.NewRuleSet(rules)
+
+	tests := []struct {
+		method   string
+		path     string
+		ip       string
+		expected string
+	}{
+		// La /32 gana sobre la /24 aunque esté después en el archivo
+		{"GET", "/users/1", "203.0.113.7", "partner"},
+		// A igual prefijo se prueban en orden: la de POST primero
+		{"POST", "/users/1", "203.0.113.7", "office-writes"},
+		{"GET", "/users/1", "203.0.113.8", "office"},
+		// Las reglas con IP tienen prioridad sobre las que no filtran por IP
+		{"GET", "/items/MLA1", "203.0.113.8", "office"},
+		{"GET", "/items/MLA1", "198.51.100.1", "items"},
+		{"GET", "/users/1", "::ffff:203.0.113.7", "partner"},
+		{"GET", "/users/1", "2001:db8::1", "v6"},
+		{"GET", "/users/1", "198.51.100.1", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		var got string
+		if rule := set.Match(ratelimit.ScopeIP, req, tt.ip, ratelimit.NormalizePath(tt.path)); rule != nil {
+			got = rule.Name
+		}
+		if got != tt.expected {
+			t.Errorf("%s %s from %s: got rule %q, want %q", tt.method, tt.path, tt.ip, got, tt.expected)
+		}
+		if set.Match(ratelimit.ScopePath, req, tt.ip, ratelimit.NormalizePath(tt.path)) != nil {
+			t.Errorf("%s from %s: matched a rule of another scope", tt.path, tt.ip)
+		}
+	}
+}
+
+func TestConfigLoad_RulesFile(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "rules.yaml")
+	if err := os.WriteFile(valid, []byte(validRulesYAML), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("RATE_LIMIT_RULES_FILE", valid)
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Rules) != 3 {
+		t.Errorf("expected 3 rules, got %d", len(cfg.Rules))
+	}
+
+	invalid := filepath.Join(dir, "invalid.yaml")
+	if err := os.WriteFile(invalid, []byte("rules:\n  - limit: -1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("RATE_LIMIT_RULES_FILE", invalid)
+
+	if _, err := config.Load(); err == nil || !strings.Contains(err.Error(), "invalid.yaml:2:") {
+		t.Errorf("expected line-numbered error, got %v", err)
+	}
+
+	t.Setenv("RATE_LIMIT_RULES_FILE", filepath.Join(dir, "missing.yaml"))
+	if _, err := config.Load(); err == nil {
+		t.Error("expected error for missing rules file")
+	}
+}
+
+func TestParseRules_ExampleFile(t *testing.T) {
+	if _, err := ratelimit.LoadRulesFile("../../rules.example.yaml"); err != nil {
+		t.Errorf("rules.example.yaml should be valid: %v", err)
+	}
+}
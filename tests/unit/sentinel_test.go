@@ -0,0 +1,104 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/andress1014/meli-proxy/internal/config"
+	"github.com/andress1014/meli-proxy/internal/middleware"
+	"github.com/andress1014/meli-proxy/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
+func TestSentinelLimiter_InvalidConfig(t *testing.T) {
+	logger := zap.NewNop()
+
+	if _, err := ratelimit.NewSentinelLimiter(ratelimit.SentinelConfig{
+		SentinelAddrs: []string{"localhost:26379"},
+	}, logger); err == nil {
+		t.Error("expected error without master name")
+	}
+
+	if _, err := ratelimit.NewSentinelLimiter(ratelimit.SentinelConfig{
+		MasterName: "mymaster",
+	}, logger); err == nil {
+		t.Error("expected error without sentinel addresses")
+	}
+}
+
+func TestSentinelLimiter(t *testing.T) {
+	limiter, err := ratelimit.NewSentinelLimiter(ratelimit.SentinelConfig{
+		MasterName:    "mymaster",
+		SentinelAddrs: []string{"localhost:26379"},
+		DialTimeout:   200 * time.Millisecond,
+	}, zap.NewNop())
+	if err != nil {
+		t.Skipf("Redis Sentinel not available: %v", err)
+	}
+	defer limiter.Close()
+
+	if limiter.FailingOver() {
+		t.Error("expected no failover in progress right after start")
+	}
+
+	ctx := context.Background()
+	key := "test:sentinel:" + time.Now().Format("150405.000000")
+	limits := map[string]ratelimit.LimitConfig{
+		key: {Limit: 2, Window: time.Minute},
+	}
+
+	for i := 0; i < 2; i++ {
+		results, err := limiter.CheckMultipleLimits(ctx, limits)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !results[key].Allowed {
+			t.Errorf("request %d should be allowed", i+1)
+		}
+	}
+
+	results, err := limiter.CheckMultipleLimits(ctx, limits)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if results[key].Allowed {
+		t.Error("third request should be blocked")
+	}
+}
+
+// failoverLimiter falla como el SentinelLimiter mientras hay un failover en curso
+type failoverLimiter struct{}
+
+func (failoverLimiter) CheckMultipleLimits(ctx context.Context, limits map[string]ratelimit.LimitConfig) (map[string]*ratelimit.LimitResult, error) {
+	return nil, fmt.Errorf("%w: %w", ratelimit.ErrFailover, errors.New("READONLY You can't write against a read only replica"))
+}
+
+func (failoverLimiter) Close() error { return nil }
+
+func TestSentinelFailover_AppliesFailPolicy(t *testing.T) {
+	cfg := &config.Config{
+		DefaultRPS:       100,
+		PathFailPolicies: map[string]string{"/payments": "closed"},
+	}
+	handler := middleware.NewRateLimitMiddleware(failoverLimiter{}, cfg, zap.NewNop()).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for path, expected := range map[string]int{
+		"/payments": http.StatusServiceUnavailable,
+		"/items":    http.StatusOK,
+	} {
+		req := httptest.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != expected {
+			t.Errorf("%s during failover: expected status %d, got %d", path, expected, rr.Code)
+		}
+	}
+}
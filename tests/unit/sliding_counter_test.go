@@ -0,0 +1,114 @@
+package unit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/andress1014/meli-proxy/internal/ratelimit"
+	"github.com/go-redis/redis/v8"
+)
+
+const benchRedisURL = "redis://localhost:6379"
+
+func TestSlidingWindowCounterLimiter_Limit(t *testing.T) {
+	client := newTestRedisClient(t)
+	ctx := context.Background()
+
+	limiter := ratelimit.NewSlidingWindowCounterLimiter(client)
+	key := "test::sliding_counter::" + time.Now().String()
+	defer client.Del(ctx, key)
+
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		result, err := limiter.CheckLimit(ctx, key, 5, time.Minute)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Allowed {
+			allowed++
+		} else if result.RetryAfter <= 0 {
+			t.Error("expected retry after on rejected request")
+		}
+	}
+
+	// Puede permitir menos de 5 si la ventana anterior tenía requests, nunca más
+	if allowed > 5 {
+		t.Errorf("expected at most 5 allowed requests, got %d", allowed)
+	}
+
+	// Memoria O(1): un solo hash por key
+	if n, _ := client.HLen(ctx, key).Result(); n != 3 {
+		t.Errorf("expected 3 hash fields, got %d", n)
+	}
+}
+
+func TestSlidingWindowCounterLimiter_InvalidConfig(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	defer client.Close()
+
+	limiter := ratelimit.NewSlidingWindowCounterLimiter(client)
+
+	if _, err := limiter.CheckLimit(context.Background(), "key", 10, 0); err == nil {
+		t.Error("expected error for zero window")
+	}
+}
+
+// BenchmarkSlidingWindowLimiters compara latencia y memoria en Redis del ZSET
+// (RedisLimiter.CheckLimit) contra el sliding window counter con límite de 10k/min.
+// Ejecutar con: go test -bench=SlidingWindow -benchmem ./tests/unit/
+func BenchmarkSlidingWindowLimiters(b *testing.B) {
+	client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	defer client.Close()
+
+	ctx := context.Background()
+	if err := client.Ping(ctx).Err(); err != nil {
+		b.Skipf("Redis not available: %v", err)
+	}
+
+	zsetLimiter, err := ratelimit.NewRedisLimiter(benchRedisURL)
+	if err != nil {
+		b.Skipf("Redis not available: %v", err)
+	}
+	defer zsetLimiter.Close()
+
+	counterLimiter := ratelimit.NewSlidingWindowCounterLimiter(client)
+
+	const limit = 10000
+	window := time.Minute
+
+	limiters := []struct {
+		name  string
+		check func(key string) error
+	}{
+		{"zset", func(key string) error {
+			_, err := zsetLimiter.CheckLimit(ctx, key, limit, window)
+			return err
+		}},
+		{"counter", func(key string) error {
+			_, err := counterLimiter.CheckLimit(ctx, key, limit, window)
+			return err
+		}},
+	}
+
+	for _, l := range limiters {
+		b.Run(l.name, func(b *testing.B) {
+			key := fmt.Sprintf("bench::%s::%d", l.name, time.Now().UnixNano())
+			defer client.Del(ctx, key)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := l.check(key); err != nil {
+					b.Fatalf("check failed: %v", err)
+				}
+			}
+			b.StopTimer()
+
+			// Bytes que ocupa la key en Redis tras b.N requests
+			if bytes, err := client.MemoryUsage(ctx, key).Result(); err == nil {
+				b.ReportMetric(float64(bytes), "redis-bytes/key")
+			}
+		})
+	}
+}
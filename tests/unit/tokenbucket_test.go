@@ -0,0 +1,84 @@
+package unit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/andress1014/meli-proxy/internal/ratelimit"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestParseAlgorithm(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    ratelimit.Algorithm
+		expectError bool
+	}{
+		{"", ratelimit.AlgorithmSlidingWindow, false},
+		{"sliding_window", ratelimit.AlgorithmSlidingWindow, false},
+		{"token_bucket", ratelimit.AlgorithmTokenBucket, false},
+		{" Token_Bucket ", ratelimit.AlgorithmTokenBucket, false},
+		{"gcra", ratelimit.AlgorithmGCRA, false},
+		{"sliding_window_counter", ratelimit.AlgorithmSlidingWindowCounter, false},
+		{"leaky", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			algorithm, err := ratelimit.ParseAlgorithm(tt.input)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error for %q", tt.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if algorithm != tt.expected {
+				t.Errorf("ParseAlgorithm(%q) = %s, want %s", tt.input, algorithm, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTokenBucketLimiter_Burst(t *testing.T) {
+	client := newTestRedisClient(t)
+	ctx := context.Background()
+
+	limiter := ratelimit.NewTokenBucketLimiter(client)
+	key := "test::token_bucket::" + time.Now().String()
+	defer client.Del(ctx, key)
+
+	// Burst de 5 con recarga lenta: solo 5 requests pasan de inmediato
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		result, err := limiter.CheckLimit(ctx, key, 1, 5, time.Minute)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Allowed {
+			allowed++
+		}
+	}
+
+	if allowed != 5 {
+		t.Errorf("expected 5 allowed requests (burst), got %d", allowed)
+	}
+}
+
+func TestTokenBucketLimiter_InvalidConfig(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	defer client.Close()
+
+	limiter := ratelimit.NewTokenBucketLimiter(client)
+
+	// La validación ocurre antes de tocar Redis
+	if _, err := limiter.CheckLimit(context.Background(), "key", 0, 5, time.Minute); err == nil {
+		t.Error("expected error for zero limit")
+	}
+	if _, err := limiter.CheckLimit(context.Background(), "key", 10, 5, 0); err == nil {
+		t.Error("expected error for zero window")
+	}
+}
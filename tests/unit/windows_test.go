@@ -0,0 +1,211 @@
+package unit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andress1014/meli-proxy/internal/config"
+	"github.com/andress1014/meli-proxy/internal/middleware"
+	"github.com/andress1014/meli-proxy/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
+func TestWindowKey(t *testing.T) {
+	tests := []struct {
+		key      string
+		window   time.Duration
+		expected string
+	}{
+		{ratelimit.IPKey("10.0.0.1"), time.Second, "ip:1s::10.0.0.1"},
+		{ratelimit.MethodKey(ratelimit.PathKey("/items"), "POST"), time.Minute, "path:POST:1m::/items"},
+		{ratelimit.IPPathKey("2001:db8::1", "/items/*"), time.Hour, "ip_path:1h::2001:db8::1::/items/*"},
+		{ratelimit.IPKey("10.0.0.1"), 90 * time.Minute, "ip:1h30m::10.0.0.1"},
+		{ratelimit.IPKey("10.0.0.1"), 500 * time.Millisecond, "ip:500ms::10.0.0.1"},
+	}
+	for _, tt := range tests {
+		got := ratelimit.WindowKey(tt.key, tt.window)
+		if got != tt.expected {
+			t.Errorf("WindowKey(%s, %v) = %s, want %s", tt.key, tt.window, got, tt.expected)
+		}
+		if ratelimit.ClusterHashTag(got) != ratelimit.ClusterHashTag(tt.key) {
+			t.Errorf("hash tag changed for %s", got)
+		}
+	}
+}
+
+func TestParseRules_StackedWindows(t *testing.T) {
+	rules, err := ratelimit.ParseRules("rules.yaml", []byte(`rules:
+  - name: api
+    scope: ip
+    limits:
+      - {limit: 20, window: 1s}
+      - {limit: 600, window: 1m}
+      - {limit: 10000, window: 1h}
+  - name: hourly
+    limit: 5000
+    window: 1h
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	api := rules[0]
+	if api.Limit != 20 || api.Window != time.Second || len(api.Stacked) != 2 {
+		t.Fatalf("unexpected windows: %+v", api)
+	}
+	if api.Stacked[0] != (ratelimit.WindowLimit{Limit: 600, Window: time.Minute}) ||
+		api.Stacked[1] != (ratelimit.WindowLimit{Limit: 10000, Window: time.Hour}) {
+		t.Errorf("unexpected stacked windows: %+v", api.Stacked)
+	}
+	if rules[1].Window != time.Hour || len(rules[1].Stacked) != 0 {
+		t.Errorf("unexpected single window: %+v", rules[1])
+	}
+}
+
+func TestParseRules_StackedWindowErrors(t *testing.T) {
+	_, err := ratelimit.ParseRules("rules.yaml", []byte(`rules:
+  - name: both
+    limit: 10
+    limits:
+      - {limit: 20, window: 1s}
+  - name: duplicate
+    limits:
+      - {limit: 20, window: 60s}
+      - {limit: 30, window: 1m}
+  - name: invalid
+    limits:
+      - {limit: 0, window: 1s}
+      - {limit: 10, window: soon}
+  - name: typo
+    limits:
+      - {limit: 10, windw: 1s}
+`))
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+
+	msg := err.Error()
+	expected := []string{
+		`rules.yaml:2: rule "both": use either limit/window or limits, not both`,
+		`rules.yaml:6: rule "duplicate": duplicate window 1m`,
+		`rules.yaml:10: rule "invalid": limit must be greater than 0`,
+		`rules.yaml:10: rule "invalid": invalid window "soon"`,
+		`rules.yaml:16: unknown field "windw"`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected error to contain %q, got:\n%s", want, msg)
+		}
+	}
+}
+
+func TestRateLimitMiddleware_StackedWindows(t *testing.T) {
+	rules, err := ratelimit.ParseRules("rules.yaml", []byte(`rules:
+  - name: burst-and-minute
+    scope: ip
+    limits:
+      - {limit: 2, window: 100ms}
+      - {limit: 3, window: 1m}
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	limiter := ratelimit.NewMemoryLimiter(0)
+	defer limiter.Close()
+	cfg := &config.Config{DefaultRPS: 100, Rules: rules}
+	handler := middleware.NewRateLimitMiddleware(limiter, cfg, zap.NewNop()).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/users/42", nil)
+		req.RemoteAddr = "198.51.100.9:1234"
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i := 0; i < 2; i++ {
+		if rr := serve(); rr.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i+1, rr.Code)
+		}
+	}
+	// La ventana corta se agota primero
+	if rr := serve(); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the 100ms window to block, got %d", rr.Code)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	rr := serve()
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 after the short window, got %d", rr.Code)
+	}
+	// Los headers informan la ventana más cercana a agotarse: la del minuto
+	if rr.Header().Get("X-RateLimit-Limit") != "3" || rr.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Errorf("unexpected headers %v", rr.Header())
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if rr := serve(); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the 1m window to block, got %d", rr.Code)
+	}
+}
+
+func TestRateLimitMiddleware_DefaultWindow(t *testing.T) {
+	limiter := &recordingLimiter{}
+	cfg := &config.Config{
+		DefaultLimit:       20,
+		DefaultWindow:      time.Second,
+		DefaultIPPathLimit: 5,
+		PathRateLimit:      map[string]int{"/items/*": 50},
+	}
+	m := middleware.NewRateLimitMiddleware(limiter, cfg, zap.NewNop())
+
+	req := httptest.NewRequest("GET", "/items/MLA1", nil)
+	req.RemoteAddr = "198.51.100.1:1234"
+	keys, limits := m.LimitConfigs(req)
+
+	expected := map[string]int{"ip": 20, "path": 50, "ip_path": 5}
+	for limitType, limit := range expected {
+		config := limits[keys[limitType]]
+		if config.Limit != limit || config.Window != time.Second {
+			t.Errorf("%s: expected %d per second, got %d per %v", limitType, limit, config.Limit, config.Window)
+		}
+	}
+}
+
+func TestConfigLoad_DefaultWindow(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.DefaultLimit != 100 || cfg.DefaultWindow != time.Minute || cfg.DefaultIPPathLimit != 0 {
+		t.Errorf("unexpected defaults: %d per %v, ip_path %d", cfg.DefaultLimit, cfg.DefaultWindow, cfg.DefaultIPPathLimit)
+	}
+
+	// DEFAULT_RPS sigue funcionando como límite por defecto
+	t.Setenv("DEFAULT_RPS", "300")
+	if cfg, _ = config.Load(); cfg.DefaultLimit != 300 || cfg.DefaultRPS != 300 {
+		t.Errorf("expected DEFAULT_RPS fallback, got %d", cfg.DefaultLimit)
+	}
+
+	t.Setenv("DEFAULT_LIMIT", "20")
+	t.Setenv("RATE_LIMIT_WINDOW", "1s")
+	t.Setenv("IP_PATH_DEFAULT_LIMIT", "5")
+	cfg, err = config.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.DefaultLimit != 20 || cfg.DefaultRPS != 20 || cfg.DefaultWindow != time.Second || cfg.DefaultIPPathLimit != 5 {
+		t.Errorf("unexpected config: %d per %v, ip_path %d", cfg.DefaultLimit, cfg.DefaultWindow, cfg.DefaultIPPathLimit)
+	}
+
+	t.Setenv("RATE_LIMIT_WINDOW", "-1s")
+	if _, err := config.Load(); err == nil {
+		t.Error("expected error for negative window")
+	}
+}